@@ -0,0 +1,318 @@
+// Package breaker 提供熔断器，和 limit 包的限流器一起用于服务的过载保护
+//
+// 熔断器和限流器有相同的 Allow() 形状，实现了 limit.RateLimiter，
+// 另外通过 MarkSuccess / MarkFailure 反馈下游调用的结果：
+//
+//	b := breaker.NewSRE()
+//	if !b.Allow() {
+//		return ErrServiceUnavailable
+//	}
+//	if err := callDependency(); err != nil {
+//		b.MarkFailure()
+//		return err
+//	}
+//	b.MarkSuccess()
+//
+// 用 limit.NewChain(limiter, b) 组合后可以放进同一个中间件（见 Middleware）
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/CocaineCong/BiliBili-Code/limit"
+)
+
+// ErrOpen 熔断器拒绝请求时返回的错误
+var ErrOpen = errors.New("breaker: circuit open")
+
+// Breaker 熔断器接口
+type Breaker interface {
+	limit.RateLimiter
+	MarkSuccess()
+	MarkFailure()
+}
+
+// State 熔断器状态
+type State int
+
+const (
+	Closed   State = iota // 关闭：正常放行
+	Open                  // 打开：拒绝所有请求
+	HalfOpen              // 半开：放行少量探测请求
+)
+
+// String 状态名称
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half_open"
+	default:
+		return "unknown"
+	}
+}
+
+// Option 熔断器的可选配置
+type Option func(*options)
+
+// options 熔断器的可选配置项，标注了适用的熔断器
+type options struct {
+	clock         limit.Clock          // 时钟
+	window        time.Duration        // 统计窗口
+	buckets       int                  // 统计窗口的桶数量
+	minRequests   int64                // 窗口内请求数达到该值后才会熔断
+	k             float64              // SRE：倍率 K
+	failureRatio  float64              // 经典：失败率阈值
+	openTimeout   time.Duration        // 经典：打开后多久进入半开
+	halfOpenProbe int64                // 经典：半开时放行的探测请求数
+	onStateChange func(from, to State) // 经典：状态变化回调
+}
+
+// WithClock 设置时钟，默认使用系统时间
+func WithClock(clock limit.Clock) Option {
+	return func(o *options) {
+		o.clock = clock
+	}
+}
+
+// WithWindow 设置统计窗口和桶数量，默认 10s、40 个桶
+func WithWindow(window time.Duration, buckets int) Option {
+	return func(o *options) {
+		o.window = window
+		o.buckets = buckets
+	}
+}
+
+// WithMinRequests 设置窗口内的请求数达到多少后才会熔断，避免请求很少时误判，SRE 默认 100，经典默认 20
+func WithMinRequests(n int64) Option {
+	return func(o *options) {
+		o.minRequests = n
+	}
+}
+
+// WithK 设置 SRE 熔断器的倍率 K，默认 1.5；K 越小越激进
+func WithK(k float64) Option {
+	return func(o *options) {
+		o.k = k
+	}
+}
+
+// WithFailureRatio 设置经典熔断器的失败率阈值，默认 0.5
+func WithFailureRatio(ratio float64) Option {
+	return func(o *options) {
+		o.failureRatio = ratio
+	}
+}
+
+// WithOpenTimeout 设置经典熔断器打开后多久进入半开，默认 5s
+func WithOpenTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.openTimeout = d
+	}
+}
+
+// WithHalfOpenProbes 设置经典熔断器半开时放行的探测请求数，全部成功后关闭，默认 1
+func WithHalfOpenProbes(n int64) Option {
+	return func(o *options) {
+		o.halfOpenProbe = max(n, 1)
+	}
+}
+
+// WithOnStateChange 设置经典熔断器的状态变化回调，回调在持有锁时调用，不能再调用熔断器的方法
+func WithOnStateChange(fn func(from, to State)) Option {
+	return func(o *options) {
+		o.onStateChange = fn
+	}
+}
+
+// newOptions 应用可选配置
+func newOptions(minRequests int64, opts []Option) options {
+	o := options{
+		clock:         limit.SystemClock(),
+		window:        10 * time.Second,
+		buckets:       40,
+		minRequests:   minRequests,
+		k:             1.5,
+		failureRatio:  0.5,
+		openTimeout:   5 * time.Second,
+		halfOpenProbe: 1,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// CircuitBreaker 经典的三态熔断器
+// 1. 关闭：窗口内请求数达到 MinRequests 且失败率达到 FailureRatio 时打开
+// 2. 打开：拒绝所有请求，OpenTimeout 后进入半开
+// 3. 半开：放行 HalfOpenProbes 个探测请求，全部成功后关闭，任意一个失败重新打开；
+// 探测请求放行后 OpenTimeout 内没有标记结果（如调用方忘记调用 MarkSuccess / MarkFailure）时重新放行一轮探测
+//
+// MarkSuccess / MarkFailure 不知道结果属于哪个请求，总是计入当前状态：关闭时放行的慢请求在半开时才成功，会被当作探测请求的结果。
+// 使用 Admit 返回的 done 标记结果时，状态切换前放行的请求的结果会被忽略
+type CircuitBreaker struct {
+	options
+	state      State      // 当前状态
+	generation uint64     // 状态切换或重新放行一轮探测时加一
+	stats      *window    // 关闭状态下的统计
+	openedAt   time.Time  // 打开的时间
+	probedAt   time.Time  // 半开时最后一次放行探测请求的时间
+	probes     int64      // 半开时已经放行的探测请求数
+	passed     int64      // 半开时成功的探测请求数
+	mutex      sync.Mutex // 互斥锁
+}
+
+// NewCircuitBreaker 创建经典熔断器
+func NewCircuitBreaker(opts ...Option) *CircuitBreaker {
+	o := newOptions(20, opts)
+	return &CircuitBreaker{
+		options: o,
+		stats:   newWindow(o.window, o.buckets),
+	}
+}
+
+// setState 切换状态，调用方需持有锁
+func (cb *CircuitBreaker) setState(state State, now time.Time) {
+	if cb.state == state {
+		return
+	}
+	from := cb.state
+	cb.state = state
+	cb.generation++
+	switch state {
+	case Open:
+		cb.openedAt = now
+	case HalfOpen:
+		cb.probes, cb.passed = 0, 0
+	case Closed:
+		cb.stats.reset()
+	}
+	if cb.onStateChange != nil {
+		cb.onStateChange(from, state)
+	}
+}
+
+// refresh 打开超时后进入半开；半开时探测请求超时没有结果则视为丢失，重新放行一轮探测，调用方需持有锁
+func (cb *CircuitBreaker) refresh(now time.Time) {
+	switch cb.state {
+	case Open:
+		if now.Sub(cb.openedAt) >= cb.openTimeout {
+			cb.setState(HalfOpen, now)
+		}
+	case HalfOpen:
+		if cb.probes >= cb.halfOpenProbe && now.Sub(cb.probedAt) >= cb.openTimeout {
+			cb.probes, cb.passed = 0, 0
+			cb.generation++
+		}
+	}
+}
+
+// Allow 检查是否允许请求通过
+func (cb *CircuitBreaker) Allow() bool {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	return cb.allow()
+}
+
+// Admit 检查是否允许请求通过，放行时返回标记结果的 done，done 只能调用一次
+// done 记住放行时熔断器的代数，熔断器在结果返回前切换过状态时忽略该结果
+func (cb *CircuitBreaker) Admit() (done func(success bool), ok bool) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	if !cb.allow() {
+		return nil, false
+	}
+	generation := cb.generation
+	return func(success bool) {
+		cb.mutex.Lock()
+		defer cb.mutex.Unlock()
+		if cb.generation == generation {
+			cb.mark(success)
+		}
+	}, true
+}
+
+// allow 检查是否允许请求通过，调用方需持有锁
+func (cb *CircuitBreaker) allow() bool {
+	now := cb.clock.Now()
+	cb.refresh(now)
+	switch cb.state {
+	case Closed:
+		return true
+	case HalfOpen:
+		if cb.probes < cb.halfOpenProbe {
+			cb.probes++
+			cb.probedAt = now
+			return true
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+// MarkSuccess 记录一次成功的调用
+func (cb *CircuitBreaker) MarkSuccess() {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	cb.mark(true)
+}
+
+// MarkFailure 记录一次失败的调用
+func (cb *CircuitBreaker) MarkFailure() {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	cb.mark(false)
+}
+
+// mark 按当前状态记录一次调用的结果，调用方需持有锁
+func (cb *CircuitBreaker) mark(success bool) {
+	now := cb.clock.Now()
+	switch cb.state {
+	case Closed:
+		cb.stats.add(now, success)
+		if success {
+			return
+		}
+		total, accepts := cb.stats.sum(now)
+		if total >= cb.minRequests && float64(total-accepts) >= cb.failureRatio*float64(total) {
+			cb.setState(Open, now)
+		}
+	case HalfOpen:
+		if !success {
+			cb.setState(Open, now)
+			return
+		}
+		cb.passed++
+		if cb.passed >= cb.halfOpenProbe {
+			cb.setState(Closed, now)
+		}
+	}
+}
+
+// State 获取当前状态
+func (cb *CircuitBreaker) State() State {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	cb.refresh(cb.clock.Now())
+	return cb.state
+}
+
+// GetStatus 获取窗口内的失败数和请求数
+func (cb *CircuitBreaker) GetStatus() (int64, int64) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	total, success := cb.stats.sum(cb.clock.Now())
+	return total - success, total
+}
+
+// Algorithm 获取算法名称
+func (cb *CircuitBreaker) Algorithm() string {
+	return "circuit_breaker"
+}
@@ -0,0 +1,163 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CocaineCong/BiliBili-Code/limit"
+	"github.com/CocaineCong/BiliBili-Code/limittest"
+)
+
+// 熔断器实现了限流器接口
+var (
+	_ limit.RateLimiter = (*CircuitBreaker)(nil)
+	_ Breaker           = (*CircuitBreaker)(nil)
+	_ Breaker           = (*SREBreaker)(nil)
+)
+
+// TestCircuitBreaker_States 测试关闭、打开、半开之间的切换
+func TestCircuitBreaker_States(t *testing.T) {
+	clock := limittest.NewFakeClock(time.Unix(0, 0))
+	var changes []State
+	cb := NewCircuitBreaker(WithClock(clock), WithMinRequests(4), WithFailureRatio(0.5),
+		WithOpenTimeout(time.Second), WithHalfOpenProbes(2),
+		WithOnStateChange(func(from, to State) { changes = append(changes, to) }))
+
+	// 请求数不够时不会打开
+	for i := 0; i < 3; i++ {
+		if !cb.Allow() {
+			t.Fatal("关闭状态应该放行")
+		}
+		cb.MarkFailure()
+	}
+	if cb.State() != Closed {
+		t.Fatalf("请求数不够时不应该打开: %s", cb.State())
+	}
+	cb.MarkSuccess()
+	cb.MarkFailure()
+	if cb.State() != Open || cb.Allow() {
+		t.Fatalf("失败率达到阈值后应该打开: %s", cb.State())
+	}
+
+	// 超时后进入半开，只放行2个探测请求
+	clock.Advance(time.Second)
+	if !cb.Allow() || !cb.Allow() || cb.Allow() {
+		t.Fatal("半开状态只放行2个探测请求")
+	}
+	cb.MarkFailure()
+	if cb.State() != Open {
+		t.Fatalf("探测失败后应该重新打开: %s", cb.State())
+	}
+
+	clock.Advance(time.Second)
+	cb.Allow()
+	cb.Allow()
+	cb.MarkSuccess()
+	if cb.State() != HalfOpen {
+		t.Fatalf("探测请求没有全部成功: %s", cb.State())
+	}
+	cb.MarkSuccess()
+	if cb.State() != Closed || !cb.Allow() {
+		t.Fatalf("探测全部成功后应该关闭: %s", cb.State())
+	}
+	if failures, total := cb.GetStatus(); failures != 0 || total != 0 {
+		t.Errorf("关闭后统计应该清空: failures=%d, total=%d", failures, total)
+	}
+
+	want := []State{Open, HalfOpen, Open, HalfOpen, Closed}
+	if len(changes) != len(want) {
+		t.Fatalf("状态变化错误: %v", changes)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("第%d次状态变化应该是 %s: %s", i+1, want[i], changes[i])
+		}
+	}
+}
+
+// TestCircuitBreaker_LostProbe 测试探测请求放行后一直没有标记结果时重新放行探测
+func TestCircuitBreaker_LostProbe(t *testing.T) {
+	clock := limittest.NewFakeClock(time.Unix(0, 0))
+	cb := NewCircuitBreaker(WithClock(clock), WithMinRequests(1), WithOpenTimeout(time.Second))
+
+	cb.MarkFailure()
+	clock.Advance(time.Second)
+	// 探测请求放行后调用方没有调用 MarkSuccess / MarkFailure
+	if !cb.Allow() {
+		t.Fatal("半开状态应该放行探测请求")
+	}
+	clock.Advance(500 * time.Millisecond)
+	if cb.Allow() {
+		t.Fatal("探测请求还没有超时，不应该放行新的探测")
+	}
+
+	clock.Advance(500 * time.Millisecond)
+	if !cb.Allow() {
+		t.Fatal("探测请求超时没有结果后应该重新放行探测")
+	}
+	if cb.Allow() {
+		t.Error("每轮只放行1个探测请求")
+	}
+	cb.MarkSuccess()
+	if cb.State() != Closed {
+		t.Errorf("新的探测成功后应该关闭: %s", cb.State())
+	}
+}
+
+// TestCircuitBreaker_Window 测试失败统计随窗口滑动过期
+func TestCircuitBreaker_Window(t *testing.T) {
+	clock := limittest.NewFakeClock(time.Unix(0, 0))
+	cb := NewCircuitBreaker(WithClock(clock), WithWindow(time.Second, 10), WithMinRequests(4))
+
+	for i := 0; i < 3; i++ {
+		cb.MarkFailure()
+	}
+	if failures, total := cb.GetStatus(); failures != 3 || total != 3 {
+		t.Errorf("状态错误: failures=%d, total=%d", failures, total)
+	}
+	clock.Advance(time.Second)
+	if _, total := cb.GetStatus(); total != 0 {
+		t.Errorf("窗口外的统计应该过期: %d", total)
+	}
+	cb.MarkFailure()
+	if cb.State() != Closed {
+		t.Error("过期的失败不应该计入")
+	}
+	if got := limit.Algorithm(cb); got != "circuit_breaker" {
+		t.Errorf("算法名称错误: %s", got)
+	}
+}
+
+// TestCircuitBreaker_Generation 测试状态切换前放行的请求的结果被忽略，不会被当作探测请求的结果
+func TestCircuitBreaker_Generation(t *testing.T) {
+	clock := limittest.NewFakeClock(time.Unix(0, 0))
+	cb := NewCircuitBreaker(WithClock(clock), WithMinRequests(1), WithOpenTimeout(time.Second))
+
+	// 关闭时放行的两个慢请求
+	slow, ok := cb.Admit()
+	slower, ok2 := cb.Admit()
+	if !ok || !ok2 {
+		t.Fatal("关闭状态应该放行")
+	}
+	cb.MarkFailure()
+	clock.Advance(time.Second)
+	probe, ok := cb.Admit()
+	if !ok || cb.State() != HalfOpen {
+		t.Fatalf("半开状态应该放行探测请求: %s", cb.State())
+	}
+
+	slow(true)
+	if cb.State() != HalfOpen {
+		t.Fatalf("关闭时放行的请求不应该被当作探测请求的结果: %s", cb.State())
+	}
+	probe(true)
+	if cb.State() != Closed {
+		t.Fatalf("探测成功后应该关闭: %s", cb.State())
+	}
+
+	// 重新关闭后，更早放行的请求的失败也不计入统计
+	slower(false)
+	if failures, total := cb.GetStatus(); failures != 0 || total != 0 || cb.State() != Closed {
+		t.Errorf("过期的结果不应该计入: failures=%d, total=%d, state=%s", failures, total, cb.State())
+	}
+}
@@ -0,0 +1,91 @@
+package breaker
+
+import "net/http"
+
+// admitter 放行时返回标记结果的函数的熔断器，见 CircuitBreaker.Admit
+type admitter interface {
+	Admit() (done func(success bool), ok bool)
+}
+
+// admit 检查是否允许请求通过，放行时返回标记结果的函数
+// b 实现了 Admit 时使用它，状态切换前放行的请求的结果会被忽略；否则调用 MarkSuccess / MarkFailure
+func admit(b Breaker) (func(success bool), bool) {
+	if a, ok := b.(admitter); ok {
+		return a.Admit()
+	}
+	if !b.Allow() {
+		return nil, false
+	}
+	return func(success bool) {
+		if success {
+			b.MarkSuccess()
+		} else {
+			b.MarkFailure()
+		}
+	}, true
+}
+
+// Do 在熔断器的保护下调用 fn，熔断器拒绝时返回 ErrOpen
+// fn 返回 nil 记为成功，否则记为失败
+func Do(b Breaker, fn func() error) error {
+	done, ok := admit(b)
+	if !ok {
+		return ErrOpen
+	}
+	err := fn()
+	done(err == nil)
+	return err
+}
+
+// IsServerError 5xx 记为失败，Middleware 的默认判定
+func IsServerError(status int) bool {
+	return status >= http.StatusInternalServerError
+}
+
+// Middleware HTTP 熔断中间件，被拒绝的请求返回 503
+// 根据响应状态码调用 MarkSuccess / MarkFailure，isFailure 为 nil 时按 IsServerError 判定，handler panic 时记为失败
+// 和限流器一起使用时传入 limit.NewChain(limiter, breaker)，被任意一个成员拒绝都返回 503
+func Middleware(b Breaker, isFailure func(status int) bool) func(http.Handler) http.Handler {
+	if isFailure == nil {
+		isFailure = IsServerError
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			done, ok := admit(b)
+			if !ok {
+				http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+				return
+			}
+			sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			defer func() {
+				if p := recover(); p != nil {
+					done(false)
+					panic(p)
+				}
+				done(!isFailure(sw.status))
+			}()
+			next.ServeHTTP(sw, r)
+		})
+	}
+}
+
+// statusWriter 记录响应状态码的 http.ResponseWriter
+type statusWriter struct {
+	http.ResponseWriter
+	status      int  // 响应状态码
+	wroteHeader bool // 是否已经写入状态码
+}
+
+// WriteHeader 记录状态码
+func (w *statusWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap 获取底层的 http.ResponseWriter，供 http.ResponseController 使用
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
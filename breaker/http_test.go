@@ -0,0 +1,75 @@
+package breaker
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/CocaineCong/BiliBili-Code/limit"
+	"github.com/CocaineCong/BiliBili-Code/limittest"
+)
+
+// TestDo 测试 Do 根据返回值记录结果
+func TestDo(t *testing.T) {
+	cb := NewCircuitBreaker(WithMinRequests(1))
+	if err := Do(cb, func() error { return nil }); err != nil {
+		t.Fatalf("调用应该成功: %v", err)
+	}
+	boom := errors.New("boom")
+	if err := Do(cb, func() error { return boom }); !errors.Is(err, boom) {
+		t.Fatalf("应该返回 fn 的错误: %v", err)
+	}
+	if err := Do(cb, func() error { return nil }); !errors.Is(err, ErrOpen) {
+		t.Errorf("熔断后应该返回 ErrOpen: %v", err)
+	}
+}
+
+// TestMiddleware_Chain 测试限流器和熔断器放进同一个中间件
+func TestMiddleware_Chain(t *testing.T) {
+	clock := limittest.NewFakeClock(time.Unix(0, 0))
+	cb := NewCircuitBreaker(WithClock(clock), WithMinRequests(2), WithOpenTimeout(time.Second))
+	limiter := limit.NewFixedWindowCounter(4, time.Minute, limit.WithClock(clock))
+	chain := limit.NewChain(limiter, cb)
+	defer chain.Stop()
+
+	status := http.StatusInternalServerError
+	handler := Middleware(chain, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	serve := func() int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rec.Code
+	}
+
+	// 两个 500 之后熔断
+	for i := 0; i < 2; i++ {
+		if code := serve(); code != http.StatusInternalServerError {
+			t.Fatalf("第%d个请求应该到达 handler: %d", i+1, code)
+		}
+	}
+	if cb.State() != Open {
+		t.Fatalf("连续失败后应该熔断: %s", cb.State())
+	}
+	if code := serve(); code != http.StatusServiceUnavailable {
+		t.Errorf("熔断后应该返回 503: %d", code)
+	}
+
+	// 半开探测成功后关闭，之后被限流器拒绝
+	clock.Advance(time.Second)
+	status = http.StatusOK
+	if code := serve(); code != http.StatusOK {
+		t.Fatalf("探测请求应该到达 handler: %d", code)
+	}
+	if cb.State() != Closed {
+		t.Errorf("探测成功后应该关闭: %s", cb.State())
+	}
+	if code := serve(); code != http.StatusServiceUnavailable {
+		t.Errorf("超过限流后应该被拒绝: %d", code)
+	}
+	if current, capacity := chain.GetStatus(); current != 4 || capacity != 4 {
+		t.Errorf("链的状态应该是限流器的状态: current=%d, capacity=%d", current, capacity)
+	}
+}
@@ -0,0 +1,84 @@
+package breaker
+
+import (
+	"math"
+	"math/rand/v2"
+	"sync"
+)
+
+// SREBreaker Google SRE 的自适应客户端限流（adaptive throttling）
+// 统计窗口内的请求数 requests 和成功数 accepts，按概率拒绝请求：
+//
+//	p = max(0, (requests - K*accepts) / (requests + 1))
+//
+// 下游正常时 requests ≈ accepts，不会拒绝；下游失败越多拒绝越多，恢复后自动放开，没有打开/半开状态
+// 被熔断器拒绝的请求也计入 requests，这样下游完全不可用时仍然会有少量请求去探测
+type SREBreaker struct {
+	options
+	stats *window    // 统计窗口
+	mutex sync.Mutex // 互斥锁
+}
+
+// NewSRE 创建 SRE 自适应熔断器
+func NewSRE(opts ...Option) *SREBreaker {
+	o := newOptions(100, opts)
+	return &SREBreaker{
+		options: o,
+		stats:   newWindow(o.window, o.buckets),
+	}
+}
+
+// dropRatio 计算拒绝概率，调用方需持有锁
+func (sb *SREBreaker) dropRatio() float64 {
+	requests, accepts := sb.stats.sum(sb.clock.Now())
+	if requests < sb.minRequests {
+		return 0
+	}
+	return math.Max(0, (float64(requests)-sb.k*float64(accepts))/float64(requests+1))
+}
+
+// Allow 检查是否允许请求通过
+func (sb *SREBreaker) Allow() bool {
+	sb.mutex.Lock()
+	defer sb.mutex.Unlock()
+
+	if p := sb.dropRatio(); p > 0 && rand.Float64() < p {
+		sb.stats.add(sb.clock.Now(), false)
+		return false
+	}
+	return true
+}
+
+// MarkSuccess 记录一次成功的调用
+func (sb *SREBreaker) MarkSuccess() {
+	sb.mutex.Lock()
+	defer sb.mutex.Unlock()
+	sb.stats.add(sb.clock.Now(), true)
+}
+
+// MarkFailure 记录一次失败的调用
+func (sb *SREBreaker) MarkFailure() {
+	sb.mutex.Lock()
+	defer sb.mutex.Unlock()
+	sb.stats.add(sb.clock.Now(), false)
+}
+
+// DropRatio 获取当前的拒绝概率
+func (sb *SREBreaker) DropRatio() float64 {
+	sb.mutex.Lock()
+	defer sb.mutex.Unlock()
+	return sb.dropRatio()
+}
+
+// GetStatus 获取窗口内未成功的请求数和总请求数
+func (sb *SREBreaker) GetStatus() (int64, int64) {
+	sb.mutex.Lock()
+	defer sb.mutex.Unlock()
+	requests, accepts := sb.stats.sum(sb.clock.Now())
+	return requests - accepts, requests
+}
+
+// Algorithm 获取算法名称
+func (sb *SREBreaker) Algorithm() string {
+	return "sre_breaker"
+}
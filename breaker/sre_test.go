@@ -0,0 +1,66 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CocaineCong/BiliBili-Code/limittest"
+)
+
+// TestSREBreaker_Throttle 测试下游失败时按概率拒绝
+func TestSREBreaker_Throttle(t *testing.T) {
+	clock := limittest.NewFakeClock(time.Unix(0, 0))
+	sb := NewSRE(WithClock(clock), WithMinRequests(10))
+
+	// 全部成功时不拒绝
+	for i := 0; i < 100; i++ {
+		if !sb.Allow() {
+			t.Fatal("下游正常时不应该拒绝")
+		}
+		sb.MarkSuccess()
+	}
+	if p := sb.DropRatio(); p != 0 {
+		t.Fatalf("下游正常时拒绝概率应该为0: %f", p)
+	}
+
+	// 下游开始全部失败，requests 增长而 accepts 不变，拒绝概率逐渐上升
+	rejected := 0
+	for i := 0; i < 1000; i++ {
+		if !sb.Allow() {
+			rejected++
+			continue
+		}
+		sb.MarkFailure()
+	}
+	// 稳定后 p = (requests - 1.5*100) / (requests + 1) ≈ 0.86
+	if p := sb.DropRatio(); p < 0.8 || p > 0.9 {
+		t.Errorf("拒绝概率错误: %f", p)
+	}
+	if rejected < 500 {
+		t.Errorf("下游失败时应该拒绝大部分请求: %d", rejected)
+	}
+	if failures, requests := sb.GetStatus(); requests != 1100 || failures != 1000 {
+		t.Errorf("状态错误: failures=%d, requests=%d", failures, requests)
+	}
+
+	// 窗口滑过后恢复
+	clock.Advance(10 * time.Second)
+	if p := sb.DropRatio(); p != 0 {
+		t.Errorf("窗口滑过后拒绝概率应该为0: %f", p)
+	}
+}
+
+// TestSREBreaker_MinRequests 测试请求数不够时不拒绝
+func TestSREBreaker_MinRequests(t *testing.T) {
+	clock := limittest.NewFakeClock(time.Unix(0, 0))
+	sb := NewSRE(WithClock(clock))
+	for i := 0; i < 99; i++ {
+		if !sb.Allow() {
+			t.Fatal("请求数不够时不应该拒绝")
+		}
+		sb.MarkFailure()
+	}
+	if p := sb.DropRatio(); p != 0 {
+		t.Errorf("请求数不够时拒绝概率应该为0: %f", p)
+	}
+}
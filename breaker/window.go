@@ -0,0 +1,63 @@
+package breaker
+
+import "time"
+
+// bucket 滑动窗口中的一个桶
+type bucket struct {
+	start   int64 // 桶的开始时间（UnixNano，按桶大小对齐）
+	total   int64 // 请求数
+	success int64 // 成功数
+}
+
+// window 按时间分桶的滑动窗口计数器，调用方需持有锁
+type window struct {
+	size       time.Duration // 窗口大小
+	bucketSize time.Duration // 每个桶的时长
+	buckets    []bucket
+}
+
+// newWindow 创建滑动窗口，n 为桶的数量
+func newWindow(size time.Duration, n int) *window {
+	n = max(n, 1)
+	return &window{
+		size:       size,
+		bucketSize: max(size/time.Duration(n), time.Nanosecond),
+		buckets:    make([]bucket, n),
+	}
+}
+
+// current 获取 now 所在的桶，桶已经过期时先清空
+func (w *window) current(now time.Time) *bucket {
+	start := now.UnixNano() / int64(w.bucketSize) * int64(w.bucketSize)
+	b := &w.buckets[(start/int64(w.bucketSize))%int64(len(w.buckets))]
+	if b.start != start {
+		*b = bucket{start: start}
+	}
+	return b
+}
+
+// add 记录一次请求的结果
+func (w *window) add(now time.Time, success bool) {
+	b := w.current(now)
+	b.total++
+	if success {
+		b.success++
+	}
+}
+
+// sum 统计窗口内的请求数和成功数
+func (w *window) sum(now time.Time) (total, success int64) {
+	cutoff := now.UnixNano() - int64(w.size)
+	for _, b := range w.buckets {
+		if b.start > cutoff {
+			total += b.total
+			success += b.success
+		}
+	}
+	return total, success
+}
+
+// reset 清空窗口
+func (w *window) reset() {
+	clear(w.buckets)
+}
@@ -0,0 +1,253 @@
+// Package rlsconfig ratelimitd 的规则配置（domains / descriptors），ratelimitd 加载它提供服务，limitctl 用它校验和回放
+package rlsconfig
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/CocaineCong/BiliBili-Code/limit"
+)
+
+// Config 限流服务的规则配置
+//
+//	shadow_mode: false
+//	max_keys: 100000
+//	idle_timeout: 10m
+//	domains:
+//	  - domain: mesh
+//	    descriptors:
+//	      - key: remote_address
+//	        rate_limit: {algorithm: fixed_window, limit: 100, window: 1s}
+//	      - key: path
+//	        value: /login
+//	        shadow_mode: true
+//	        rate_limit: {algorithm: sliding_window, limit: 10, window: 1m}
+//	      - key: tenant
+//	        descriptors:
+//	          - key: path
+//	            rate_limit: {algorithm: token_bucket, limit: 50, rate: 20}
+type Config struct {
+	ShadowMode  bool           `yaml:"shadow_mode"`  // 全局影子模式：只记录，总是放行
+	MaxKeys     int            `yaml:"max_keys"`     // 每条规则最多保存的描述符数，超过后新描述符判为超限，默认 100000
+	IdleTimeout limit.Duration `yaml:"idle_timeout"` // 描述符超过该时长没有请求时删除其限流器，默认 10m
+	Domains     []Domain       `yaml:"domains"`      // 各个域的规则
+}
+
+// 描述符数量和清理的默认值
+const (
+	DefaultMaxKeys     = 100000
+	DefaultIdleTimeout = 10 * time.Minute
+)
+
+// KeyLimit 每条规则最多保存的描述符数，没有配置时为 DefaultMaxKeys
+func (c *Config) KeyLimit() int {
+	if c.MaxKeys == 0 {
+		return DefaultMaxKeys
+	}
+	return c.MaxKeys
+}
+
+// IdleTime 描述符空闲多久后删除，没有配置时为 DefaultIdleTimeout
+func (c *Config) IdleTime() time.Duration {
+	if c.IdleTimeout == 0 {
+		return DefaultIdleTimeout
+	}
+	return time.Duration(c.IdleTimeout)
+}
+
+// Domain 一个域下的规则，对应 RateLimitRequest.domain
+type Domain struct {
+	Domain      string `yaml:"domain"`      // 域名称
+	Descriptors []Rule `yaml:"descriptors"` // 描述符规则
+}
+
+// Rule 描述符规则，按描述符条目逐级匹配
+// Value 为空时匹配该 key 的任意值，且每个值分别限流
+type Rule struct {
+	Key         string        `yaml:"key"`         // 描述符条目的 key
+	Value       string        `yaml:"value"`       // 描述符条目的值，为空匹配任意值
+	RateLimit   *limit.Config `yaml:"rate_limit"`  // 限流配置，为空时只作为中间层级
+	ShadowMode  bool          `yaml:"shadow_mode"` // 影子模式：超限时只记录，仍然放行
+	Descriptors []Rule        `yaml:"descriptors"` // 下一级规则
+}
+
+// LoadConfig 从文件加载配置
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseConfig(data)
+}
+
+// ParseConfig 解析 YAML 配置，未知字段视为错误
+func ParseConfig(data []byte) (*Config, error) {
+	var c Config
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&c); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parse config: %w", err)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Validate 校验配置
+func (c *Config) Validate() error {
+	if c.MaxKeys < 0 {
+		return errors.New("max_keys must not be negative")
+	}
+	if c.IdleTimeout < 0 {
+		return errors.New("idle_timeout must not be negative")
+	}
+	domains := make(map[string]bool, len(c.Domains))
+	for _, d := range c.Domains {
+		if d.Domain == "" {
+			return errors.New("domain name is required")
+		}
+		if domains[d.Domain] {
+			return fmt.Errorf("duplicate domain %q", d.Domain)
+		}
+		domains[d.Domain] = true
+		if err := validateRules(DomainName(d.Domain), d.Descriptors); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateRules 递归校验同一层级的规则
+func validateRules(path string, rules []Rule) error {
+	seen := make(map[string]bool, len(rules))
+	for _, r := range rules {
+		if r.Key == "" {
+			return fmt.Errorf("%s: descriptor key is required", path)
+		}
+		rulePath := path + "." + RuleName(r.Key, r.Value)
+		if seen[rulePath] {
+			return fmt.Errorf("%s: duplicate descriptor", rulePath)
+		}
+		seen[rulePath] = true
+
+		if r.RateLimit != nil {
+			if err := r.RateLimit.Validate(); err != nil {
+				return fmt.Errorf("%s: %w", rulePath, err)
+			}
+			// 漏桶通过阻塞调用方来整形，不适合在服务端判定
+			if r.RateLimit.Algorithm == "leaky_bucket" {
+				return fmt.Errorf("%s: leaky_bucket is not supported", rulePath)
+			}
+		}
+		if err := validateRules(rulePath, r.Descriptors); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nameEscaper 转义名称中的 %、层级分隔符 . 和键值分隔符 =，使规则的完整路径和规则一一对应
+// 例如值为 a.b 的规则和值为 a、下一级 key 为 b 的规则不会得到相同的路径
+var nameEscaper = strings.NewReplacer("%", "%25", ".", "%2E", "=", "%3D")
+
+// DomainName 域在规则完整路径中的名称
+func DomainName(domain string) string {
+	return nameEscaper.Replace(domain)
+}
+
+// RuleName 规则在所属层级中的名称：匹配任意值时为 key，否则为 key=value
+// 规则的完整路径为 域名称.名称.名称，如 mesh.tenant.path=/login
+func RuleName(key, value string) string {
+	if value == "" {
+		return nameEscaper.Replace(key)
+	}
+	return nameEscaper.Replace(key) + "=" + nameEscaper.Replace(value)
+}
+
+// Entry 描述符的一个条目
+type Entry struct {
+	Key   string // 条目的 key
+	Value string // 条目的值
+}
+
+// Match 按描述符条目逐级匹配 domain 的规则，精确匹配 key 和值优先，其次匹配任意值
+// 返回命中规则的完整路径；没有命中或命中的规则只是中间层级（没有 rate_limit）时返回 false
+func (c *Config) Match(domain string, entries []Entry) (string, *Rule, bool) {
+	var rules []Rule
+	for _, d := range c.Domains {
+		if d.Domain == domain {
+			rules = d.Descriptors
+			break
+		}
+	}
+	if rules == nil || len(entries) == 0 {
+		return "", nil, false
+	}
+	path := DomainName(domain)
+	var rule *Rule
+	for _, e := range entries {
+		rule = findRule(rules, e)
+		if rule == nil {
+			return "", nil, false
+		}
+		path += "." + RuleName(rule.Key, rule.Value)
+		rules = rule.Descriptors
+	}
+	if rule.RateLimit == nil {
+		return "", nil, false
+	}
+	return path, rule, true
+}
+
+// findRule 在同一层级中查找匹配条目的规则
+func findRule(rules []Rule, e Entry) *Rule {
+	var wildcard *Rule
+	for i := range rules {
+		r := &rules[i]
+		if r.Key != e.Key {
+			continue
+		}
+		if r.Value == e.Value {
+			return r
+		}
+		if r.Value == "" {
+			wildcard = r
+		}
+	}
+	return wildcard
+}
+
+// DescriptorKey 描述符对应的限流器 key，如 tenant=a|path=/api，规则按它为每个描述符创建限流器
+func DescriptorKey(entries []Entry) string {
+	parts := make([]string, len(entries))
+	for i, e := range entries {
+		parts[i] = e.Key + "=" + e.Value
+	}
+	return strings.Join(parts, "|")
+}
+
+// allowN 支持一次消耗多个配额的限流器
+type allowN interface {
+	AllowN(n int64) bool
+}
+
+// AllowHits 消耗 hits 个配额，限流器不支持 AllowN 时逐个调用 Allow，遇到拒绝就停止
+func AllowHits(limiter limit.RateLimiter, hits int64) bool {
+	if l, ok := limiter.(allowN); ok {
+		return l.AllowN(hits)
+	}
+	for i := int64(0); i < hits; i++ {
+		if !limiter.Allow() {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,164 @@
+package rlsconfig
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CocaineCong/BiliBili-Code/limit"
+)
+
+// TestParseConfig 测试解析规则配置
+func TestParseConfig(t *testing.T) {
+	c, err := ParseConfig([]byte(`
+shadow_mode: true
+domains:
+  - domain: mesh
+    descriptors:
+      - key: path
+        value: /login
+        shadow_mode: true
+        rate_limit: {algorithm: sliding_window, limit: 10, window: 1m}
+      - key: tenant
+        descriptors:
+          - key: path
+            rate_limit: {algorithm: token_bucket, limit: 50, rate: 20}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.ShadowMode || len(c.Domains) != 1 || len(c.Domains[0].Descriptors) != 2 {
+		t.Fatalf("解析结果错误: %+v", c)
+	}
+	login := c.Domains[0].Descriptors[0]
+	want := limit.Config{Algorithm: "sliding_window", Limit: 10, Window: limit.Duration(time.Minute)}
+	if login.Value != "/login" || !login.ShadowMode || *login.RateLimit != want {
+		t.Errorf("规则解析错误: %+v", login)
+	}
+	if nested := c.Domains[0].Descriptors[1].Descriptors[0]; nested.RateLimit.Rate != 20 {
+		t.Errorf("嵌套规则解析错误: %+v", nested)
+	}
+}
+
+// TestParseConfig_Invalid 测试非法配置
+func TestParseConfig_Invalid(t *testing.T) {
+	cases := map[string]string{
+		"未知字段":   "domains:\n  - domain: mesh\n    limit: 1\n",
+		"缺少域名":   "domains:\n  - descriptors: []\n",
+		"重复的域":   "domains:\n  - domain: a\n  - domain: a\n",
+		"缺少 key": "domains:\n  - domain: a\n    descriptors:\n      - value: x\n",
+		"重复的规则":  "domains:\n  - domain: a\n    descriptors:\n      - key: k\n      - key: k\n",
+		"非法限流配置": "domains:\n  - domain: a\n    descriptors:\n      - key: k\n        rate_limit: {algorithm: token_bucket, limit: 1}\n",
+		"不支持漏桶":  "domains:\n  - domain: a\n    descriptors:\n      - key: k\n        rate_limit: {algorithm: leaky_bucket, limit: 1, interval: 1s}\n",
+	}
+	for name, data := range cases {
+		if _, err := ParseConfig([]byte(data)); err == nil {
+			t.Errorf("%s: 应该解析失败", name)
+		}
+	}
+
+	_, err := ParseConfig([]byte("domains:\n  - domain: a\n    descriptors:\n      - key: k\n        descriptors:\n          - key: x\n          - key: x\n"))
+	if err == nil || !strings.Contains(err.Error(), "a.k.x") {
+		t.Errorf("错误信息应该包含规则路径: %v", err)
+	}
+}
+
+// TestLoadConfig_Example 测试示例配置可以正常加载
+func TestLoadConfig_Example(t *testing.T) {
+	if _, err := LoadConfig("../../ratelimitd/ratelimit.yaml"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestConfig_Match 测试按描述符条目匹配规则
+func TestConfig_Match(t *testing.T) {
+	c, err := LoadConfig("../../ratelimitd/ratelimit.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		domain  string
+		entries []Entry
+		want    string
+	}{
+		{"mesh", []Entry{{"remote_address", "10.0.0.1"}}, "mesh.remote_address"},
+		{"mesh", []Entry{{"path", "/login"}}, "mesh.path=/login"},
+		{"mesh", []Entry{{"tenant", "a"}, {"path", "/api"}}, "mesh.tenant.path"},
+		{"mesh", []Entry{{"path", "/search"}}, ""},
+		{"mesh", []Entry{{"tenant", "a"}}, ""},
+		{"other", []Entry{{"remote_address", "10.0.0.1"}}, ""},
+	}
+	for _, tc := range cases {
+		name, rule, ok := c.Match(tc.domain, tc.entries)
+		if name != tc.want || ok != (tc.want != "") || ok && rule.RateLimit == nil {
+			t.Errorf("Match(%s, %v) = %q, %v", tc.domain, tc.entries, name, ok)
+		}
+	}
+}
+
+// TestConfig_MatchNames 测试 key 和值分开比较，名称中的分隔符被转义，不同的规则不会得到相同的路径
+func TestConfig_MatchNames(t *testing.T) {
+	c, err := ParseConfig([]byte(`
+domains:
+  - domain: mesh
+    descriptors:
+      - key: path
+        value: x
+        rate_limit: {algorithm: fixed_window, limit: 1, window: 1s}
+      - key: version
+        value: v1.2
+        rate_limit: {algorithm: fixed_window, limit: 1, window: 1s}
+      - key: version
+        value: v1
+        descriptors:
+          - key: "2"
+            rate_limit: {algorithm: fixed_window, limit: 1, window: 1s}
+`))
+	if err != nil {
+		t.Fatalf("值中带有 . 的规则和嵌套规则不应该冲突: %v", err)
+	}
+	cases := []struct {
+		entries []Entry
+		want    string
+	}{
+		{[]Entry{{"path", "x"}}, "mesh.path=x"},
+		{[]Entry{{"path_x", ""}}, ""},
+		{[]Entry{{"path=x", ""}}, ""},
+		{[]Entry{{"version", "v1.2"}}, "mesh.version=v1%2E2"},
+		{[]Entry{{"version", "v1"}, {"2", "a"}}, "mesh.version=v1.2"},
+	}
+	for _, tc := range cases {
+		name, _, _ := c.Match("mesh", tc.entries)
+		if name != tc.want {
+			t.Errorf("Match(%v) = %q，期望 %q", tc.entries, name, tc.want)
+		}
+	}
+	if got := RuleName("a%.=b", "c=d"); got != "a%25%2E%3Db=c%3Dd" {
+		t.Errorf("名称转义错误: %s", got)
+	}
+}
+
+// TestDescriptorKey 测试描述符对应的限流器 key
+func TestDescriptorKey(t *testing.T) {
+	if key := DescriptorKey([]Entry{{"tenant", "a"}, {"path", "/api?x=1"}}); key != "tenant=a|path=/api?x=1" {
+		t.Errorf("限流器 key 错误: %s", key)
+	}
+}
+
+// TestAllowHits 测试限流器不支持 AllowN 时逐个调用 Allow，遇到拒绝就停止
+func TestAllowHits(t *testing.T) {
+	// 嵌入接口后只保留 RateLimiter 的方法，没有 AllowN
+	limiter := struct{ limit.RateLimiter }{limit.NewFixedWindowCounter(3, time.Minute)}
+	if _, ok := any(limiter).(allowN); ok {
+		t.Fatal("测试用的限流器不应该支持 AllowN")
+	}
+	if !AllowHits(limiter, 2) {
+		t.Error("配额足够时应该通过")
+	}
+	if AllowHits(limiter, 2) {
+		t.Error("配额不足时应该被拒绝")
+	}
+	if current, _ := limiter.GetStatus(); current != 3 {
+		t.Errorf("拒绝前已经消耗的配额不会退回: %d", current)
+	}
+}
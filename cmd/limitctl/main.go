@@ -0,0 +1,174 @@
+// limitctl ratelimitd 配置的命令行工具：校验配置文件，用请求日志回放配置（what-if）
+//
+// 用法：
+//
+//	limitctl validate -config ratelimit.yaml
+//	limitctl whatif -config ratelimit.yaml -log access.log [-format text|json]
+//
+// 配置文件和 ratelimitd 相同（domains/descriptors）。请求日志每行为 "时间 key [cost]"，
+// key 为 domain|k=v|k=v，一个请求的多个描述符用 ; 分隔，cost 对应 hits_addend，
+// 例如 "2024-05-01T10:00:00Z mesh|remote_address=10.0.0.1;path=/login 1"，-log 为 - 时从标准输入读取。
+// 上线新规则前可以先用前一天的访问日志回放，查看哪些 key 会被拒绝、从什么时候开始被拒绝。
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/CocaineCong/BiliBili-Code/cmd/internal/rlsconfig"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// usage 命令的用法
+const usage = `usage:
+  limitctl validate -config ratelimit.yaml
+  limitctl whatif -config ratelimit.yaml -log access.log [-format text|json]
+`
+
+// run 执行命令，返回进程的退出码：0 成功，1 失败，2 用法错误
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	switch args[0] {
+	case "validate":
+		return validate(args[1:], stdout, stderr)
+	case "whatif":
+		return whatIf(args[1:], stdin, stdout, stderr)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "unknown command %q\n%s", args[0], usage)
+		return 2
+	}
+}
+
+// validate 校验配置文件
+func validate(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	configPath := flags.String("config", "ratelimit.yaml", "ratelimitd 的配置文件")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	c, err := rlsconfig.LoadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: invalid\n%v\n", *configPath, err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "%s: ok, %d rules\n", *configPath, countRules(c))
+	return 0
+}
+
+// whatIf 用请求日志回放配置
+func whatIf(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("whatif", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	configPath := flags.String("config", "ratelimit.yaml", "ratelimitd 的配置文件")
+	logPath := flags.String("log", "-", "请求日志，- 表示标准输入")
+	format := flags.String("format", "text", "输出格式：text 或 json")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(stderr, "unknown format %q\n", *format)
+		return 2
+	}
+
+	c, err := rlsconfig.LoadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", *configPath, err)
+		return 1
+	}
+	sim, err := NewSimulator(c)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	in := stdin
+	if *logPath != "-" {
+		file, err := os.Open(*logPath)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		defer file.Close()
+		in = file
+	}
+	err = ReadLog(in, func(req Request) error {
+		sim.Apply(req)
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", *logPath, err)
+		return 1
+	}
+
+	report := sim.Report()
+	if *format == "json" {
+		err = writeJSON(stdout, report)
+	} else {
+		err = writeText(stdout, report)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// writeJSON 以 JSON 输出回放结果
+func writeJSON(w io.Writer, report Report) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// writeText 以表格输出回放结果
+func writeText(w io.Writer, report Report) error {
+	if report.Requests == 0 {
+		_, err := fmt.Fprintln(w, "no requests")
+		return err
+	}
+	fmt.Fprintf(w, "requests %d, accepted %d, rejected %d, from %s to %s\n\n",
+		report.Requests, report.Accepted, report.Rejected,
+		report.Start.Format(time.RFC3339Nano), report.End.Format(time.RFC3339Nano))
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RULE\tACCEPTED\tREJECTED")
+	for _, r := range report.Rules {
+		name := r.Name
+		if r.Shadow {
+			name += " (shadow)"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\n", name, r.Accepted, r.Rejected)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintln(w)
+
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tREQUESTS\tACCEPTED\tREJECTED\tFIRST REJECTION\tRULE")
+	for _, k := range report.Keys {
+		first, rule := "-", "-"
+		if k.FirstRejection != nil {
+			first = k.FirstRejection.Format(time.RFC3339Nano)
+			rule = k.FirstRejectedBy
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%s\t%s\n", k.Key, k.Requests, k.Accepted, k.Rejected, first, rule)
+	}
+	return tw.Flush()
+}
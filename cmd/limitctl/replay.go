@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CocaineCong/BiliBili-Code/cmd/internal/rlsconfig"
+	"github.com/CocaineCong/BiliBili-Code/limit"
+)
+
+// Request 请求日志中的一条请求
+type Request struct {
+	Time        time.Time           // 请求时间
+	Key         string              // 日志中的 key，格式为 domain|k=v|k=v，多个描述符用 ; 分隔
+	Domain      string              // 从 key 解析出的域
+	Descriptors [][]rlsconfig.Entry // 从 key 解析出的描述符
+	Cost        int64               // 消耗的配额，对应 hits_addend，默认为 1
+}
+
+// ReadLog 逐行读取请求日志，每行为 "时间 key [cost]"，字段之间用空白或逗号分隔
+// 时间支持 RFC3339 和 Unix 秒数（可以带小数），key 见 parseDescriptors，空行和 # 开头的行会被忽略
+func ReadLog(r io.Reader, fn func(Request) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		req, err := parseRequest(text)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		if err := fn(req); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// parseRequest 解析一行请求日志
+func parseRequest(text string) (Request, error) {
+	fields := strings.FieldsFunc(text, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+	if len(fields) < 2 || len(fields) > 3 {
+		return Request{}, fmt.Errorf("expected \"timestamp key [cost]\", got %q", text)
+	}
+	t, err := parseTime(fields[0])
+	if err != nil {
+		return Request{}, err
+	}
+	domain, descriptors, err := parseDescriptors(fields[1])
+	if err != nil {
+		return Request{}, err
+	}
+	req := Request{Time: t, Key: fields[1], Domain: domain, Descriptors: descriptors, Cost: 1}
+	if len(fields) == 3 {
+		req.Cost, err = strconv.ParseInt(fields[2], 10, 64)
+		if err != nil || req.Cost <= 0 {
+			return Request{}, fmt.Errorf("invalid cost %q", fields[2])
+		}
+	}
+	return req, nil
+}
+
+// parseTime 解析 RFC3339 或 Unix 秒数
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	seconds, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q", s)
+	}
+	sec := int64(seconds)
+	return time.Unix(sec, int64((seconds-float64(sec))*float64(time.Second))).UTC(), nil
+}
+
+// replayClock 回放请求日志的时钟，时间由日志中的请求时间驱动，只会前进
+type replayClock struct {
+	now   time.Time
+	mutex sync.Mutex
+}
+
+// Now 返回当前时间
+func (c *replayClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+// Sleep 把时间拨快 d
+func (c *replayClock) Sleep(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// advance 把时间拨到 t，早于当前时间时不变（日志中乱序的请求按当前时间计算）
+func (c *replayClock) advance(t time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if t.After(c.now) {
+		c.now = t
+	}
+}
+
+// simRule 回放中的一条规则
+type simRule struct {
+	name     string               // 规则的完整路径，如 mesh.tenant.path
+	shadow   bool                 // 影子模式：超限时只记录，仍然放行
+	limiters *limit.KeyedRegistry // 描述符到限流器的映射
+	accepted int64                // 规则放行的请求数
+	rejected int64                // 规则拒绝的请求数
+}
+
+// KeyResult 一个 key 的回放结果
+type KeyResult struct {
+	Key             string     `json:"key"`                         // 日志中的 key
+	Requests        int64      `json:"requests"`                    // 请求数
+	Accepted        int64      `json:"accepted"`                    // 放行的请求数
+	Rejected        int64      `json:"rejected"`                    // 拒绝的请求数
+	FirstRejection  *time.Time `json:"first_rejection,omitempty"`   // 第一次被拒绝的时间
+	FirstRejectedBy string     `json:"first_rejected_by,omitempty"` // 第一次拒绝该 key 的规则
+}
+
+// RuleResult 一条规则的回放结果
+type RuleResult struct {
+	Name     string `json:"name"`             // 规则的完整路径
+	Shadow   bool   `json:"shadow,omitempty"` // 影子模式，拒绝只计数，不影响请求
+	Accepted int64  `json:"accepted"`         // 规则放行的请求数
+	Rejected int64  `json:"rejected"`         // 规则拒绝的请求数
+}
+
+// Report 回放的结果
+type Report struct {
+	Requests int64        `json:"requests"` // 请求数
+	Accepted int64        `json:"accepted"` // 放行的请求数
+	Rejected int64        `json:"rejected"` // 拒绝的请求数
+	Start    time.Time    `json:"start"`    // 第一个请求的时间
+	End      time.Time    `json:"end"`      // 最后一个请求的时间
+	Rules    []RuleResult `json:"rules"`    // 每条规则的结果，按配置文件中的顺序
+	Keys     []KeyResult  `json:"keys"`     // 每个 key 的结果，按拒绝数从多到少排序
+}
+
+// Simulator 用请求日志回放 ratelimitd 的配置（what-if），所有限流器使用由日志时间驱动的时钟
+// 与 ratelimitd 相同，请求的每个描述符匹配一条规则，规则按描述符分别计数，任意一个描述符超限即为拒绝；
+// 影子模式的规则只计数，全局影子模式下所有请求都放行
+type Simulator struct {
+	config *rlsconfig.Config
+	rules  []*simRule          // 按配置文件中的顺序
+	byName map[string]*simRule // 规则完整路径到规则的映射
+	clock  *replayClock
+	keys   map[string]*KeyResult
+	report Report
+}
+
+// NewSimulator 根据 ratelimitd 的配置创建回放器
+func NewSimulator(c *rlsconfig.Config) (*Simulator, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	s := &Simulator{
+		config: c,
+		byName: make(map[string]*simRule),
+		clock:  &replayClock{},
+		keys:   make(map[string]*KeyResult),
+	}
+	for _, d := range c.Domains {
+		s.addRules(rlsconfig.DomainName(d.Domain), d.Descriptors)
+	}
+	return s, nil
+}
+
+// addRules 按配置文件中的顺序递归添加带有限流配置的规则
+func (s *Simulator) addRules(prefix string, rules []rlsconfig.Rule) {
+	for _, r := range rules {
+		name := prefix + "." + rlsconfig.RuleName(r.Key, r.Value)
+		if r.RateLimit != nil {
+			// 与 ratelimitd 相同，按配置为每个描述符创建限流器；配置已经校验过，不会出错
+			limiters, _ := limit.NewKeyedRegistryFromConfig(*r.RateLimit,
+				limit.WithClock(s.clock), limit.WithMaxKeys(s.config.KeyLimit()))
+			rule := &simRule{name: name, shadow: r.ShadowMode, limiters: limiters}
+			s.rules = append(s.rules, rule)
+			s.byName[name] = rule
+		}
+		s.addRules(name, r.Descriptors)
+	}
+}
+
+// Apply 回放一个请求，返回是否放行
+func (s *Simulator) Apply(req Request) bool {
+	s.clock.advance(req.Time)
+	if s.report.Requests == 0 || req.Time.Before(s.report.Start) {
+		s.report.Start = req.Time
+	}
+	if req.Time.After(s.report.End) {
+		s.report.End = req.Time
+	}
+
+	kr := s.keys[req.Key]
+	if kr == nil {
+		kr = &KeyResult{Key: req.Key}
+		s.keys[req.Key] = kr
+	}
+	allowed := true
+	for _, entries := range req.Descriptors {
+		name, _, ok := s.config.Match(req.Domain, entries)
+		if !ok {
+			continue
+		}
+		r := s.byName[name]
+		// 和 ratelimitd 使用同样的限流器 key 和配额消耗方式
+		if rlsconfig.AllowHits(r.limiters.Get(rlsconfig.DescriptorKey(entries)), req.Cost) {
+			r.accepted++
+			continue
+		}
+		r.rejected++
+		if r.shadow || s.config.ShadowMode {
+			continue
+		}
+		if allowed && kr.FirstRejection == nil {
+			t := s.clock.Now()
+			kr.FirstRejection = &t
+			kr.FirstRejectedBy = r.name
+		}
+		allowed = false
+	}
+
+	s.report.Requests++
+	kr.Requests++
+	if allowed {
+		s.report.Accepted++
+		kr.Accepted++
+	} else {
+		s.report.Rejected++
+		kr.Rejected++
+	}
+	return allowed
+}
+
+// Report 获取回放的结果
+func (s *Simulator) Report() Report {
+	report := s.report
+	report.Rules = make([]RuleResult, 0, len(s.rules))
+	for _, r := range s.rules {
+		report.Rules = append(report.Rules, RuleResult{Name: r.name, Shadow: r.shadow, Accepted: r.accepted, Rejected: r.rejected})
+	}
+	report.Keys = make([]KeyResult, 0, len(s.keys))
+	for _, kr := range s.keys {
+		report.Keys = append(report.Keys, *kr)
+	}
+	sort.Slice(report.Keys, func(i, j int) bool {
+		if report.Keys[i].Rejected != report.Keys[j].Rejected {
+			return report.Keys[i].Rejected > report.Keys[j].Rejected
+		}
+		return report.Keys[i].Key < report.Keys[j].Key
+	})
+	return report
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CocaineCong/BiliBili-Code/cmd/internal/rlsconfig"
+)
+
+// testConfig 回放测试使用的 ratelimitd 配置
+const testConfig = `
+domains:
+  - domain: mesh
+    descriptors:
+      - key: user
+        rate_limit: {algorithm: token_bucket, limit: 2, rate: 1}
+      - key: path
+        value: /login
+        shadow_mode: true
+        rate_limit: {algorithm: fixed_window, limit: 1, window: 10s}
+      - key: tenant
+        descriptors:
+          - key: path
+            rate_limit: {algorithm: fixed_window, limit: 4, window: 10s}
+`
+
+// testLog 回放测试使用的请求日志
+const testLog = `
+# 时间 key cost
+2024-05-01T10:00:00Z mesh|user=1
+2024-05-01T10:00:00.5Z mesh|user=1
+2024-05-01T10:00:00.8Z mesh|user=1
+1714557601,mesh|user=2,1
+2024-05-01T10:00:02Z mesh|user=1;path=/login
+2024-05-01T10:00:03Z mesh|user=1;path=/login 1
+2024-05-01T10:00:03Z mesh|tenant=a|path=/api 2
+2024-05-01T10:00:04Z mesh|tenant=a|path=/api 3
+2024-05-01T10:00:04Z mesh|ip=9
+`
+
+// TestReadLog 测试解析请求日志
+func TestReadLog(t *testing.T) {
+	var reqs []Request
+	err := ReadLog(strings.NewReader(testLog), func(req Request) error {
+		reqs = append(reqs, req)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reqs) != 9 {
+		t.Fatalf("请求数错误: %d", len(reqs))
+	}
+	if want := time.Date(2024, 5, 1, 10, 0, 1, 0, time.UTC); !reqs[3].Time.Equal(want) || reqs[3].Key != "mesh|user=2" {
+		t.Errorf("Unix 秒数解析错误: %+v", reqs[3])
+	}
+	if reqs[6].Cost != 2 || reqs[0].Cost != 1 {
+		t.Errorf("cost 解析错误: %+v", reqs)
+	}
+	if r := reqs[4]; r.Domain != "mesh" || len(r.Descriptors) != 2 || r.Descriptors[1][0].Value != "/login" {
+		t.Errorf("描述符解析错误: %+v", r)
+	}
+
+	for _, log := range []string{"yesterday mesh|user=1", "2024-05-01T10:00:00Z user:1"} {
+		err = ReadLog(strings.NewReader("2024-05-01T10:00:00Z mesh|user=1\n"+log+"\n"), func(Request) error { return nil })
+		if err == nil || !strings.Contains(err.Error(), "line 2") {
+			t.Errorf("错误应该包含行号: %v", err)
+		}
+	}
+}
+
+// newTestSimulator 按配置创建回放器并回放 testLog，返回每个请求的判定
+func newTestSimulator(t *testing.T, config string) (*Simulator, []bool) {
+	t.Helper()
+	c, err := rlsconfig.ParseConfig([]byte(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim, err := NewSimulator(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []bool
+	err = ReadLog(strings.NewReader(testLog), func(req Request) error {
+		got = append(got, sim.Apply(req))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sim, got
+}
+
+// TestSimulator 测试回放的判定和统计
+func TestSimulator(t *testing.T) {
+	sim, got := newTestSimulator(t, testConfig)
+	// user=1 的突发容量为 2，第三个请求被拒绝，2s 后补充了令牌；/login 是影子模式，超限仍然放行；
+	// tenant=a 的 /api 10s 内只允许 4 个配额；ip 没有匹配的规则，总是放行
+	want := []bool{true, true, false, true, true, true, true, false, true}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("第%d个请求的判定错误: %v", i+1, got)
+		}
+	}
+
+	report := sim.Report()
+	if report.Requests != 9 || report.Accepted != 7 || report.Rejected != 2 {
+		t.Errorf("汇总错误: %+v", report)
+	}
+	wantRules := []RuleResult{
+		{Name: "mesh.user", Accepted: 5, Rejected: 1},
+		{Name: "mesh.path=/login", Shadow: true, Accepted: 1, Rejected: 1},
+		{Name: "mesh.tenant.path", Accepted: 1, Rejected: 1},
+	}
+	if !reflect.DeepEqual(report.Rules, wantRules) {
+		t.Errorf("规则的统计错误: %+v", report.Rules)
+	}
+	api := report.Keys[0]
+	if api.Key != "mesh|tenant=a|path=/api" || api.Rejected != 1 || api.FirstRejectedBy != "mesh.tenant.path" {
+		t.Errorf("tenant=a 的结果错误: %+v", api)
+	}
+	user1 := report.Keys[1]
+	first := time.Date(2024, 5, 1, 10, 0, 0, 800_000_000, time.UTC)
+	if user1.Key != "mesh|user=1" || user1.Rejected != 1 || !user1.FirstRejection.Equal(first) || user1.FirstRejectedBy != "mesh.user" {
+		t.Errorf("user=1 的结果错误: %+v", user1)
+	}
+	if login := report.Keys[3]; login.Key != "mesh|user=1;path=/login" || login.Requests != 2 || login.FirstRejection != nil {
+		t.Errorf("影子模式的规则不应该拒绝请求: %+v", login)
+	}
+}
+
+// TestSimulator_Shadow 测试全局影子模式下所有请求都放行，规则仍然计数
+func TestSimulator_Shadow(t *testing.T) {
+	sim, got := newTestSimulator(t, "shadow_mode: true\n"+testConfig)
+	for i, allowed := range got {
+		if !allowed {
+			t.Fatalf("第%d个请求应该放行: %v", i+1, got)
+		}
+	}
+	report := sim.Report()
+	if report.Rejected != 0 || report.Rules[0].Rejected != 1 || report.Rules[2].Rejected != 1 {
+		t.Errorf("全局影子模式的统计错误: %+v", report)
+	}
+}
+
+// TestRun 测试命令行的输出和退出码
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	config := filepath.Join(dir, "ratelimit.yaml")
+	os.WriteFile(config, []byte(testConfig), 0o644)
+	bad := filepath.Join(dir, "bad.yaml")
+	os.WriteFile(bad, []byte("domains: [{domain: mesh, descriptors: [{value: x}]}]"), 0o644)
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"validate", "-config", config}, nil, &stdout, &stderr); code != 0 || !strings.Contains(stdout.String(), "ok, 3 rules") {
+		t.Errorf("校验合法的配置失败: %d %s %s", code, stdout.String(), stderr.String())
+	}
+	stdout.Reset()
+	stderr.Reset()
+	if code := run([]string{"validate", "-config", bad}, nil, &stdout, &stderr); code != 1 || !strings.Contains(stderr.String(), "descriptor key is required") {
+		t.Errorf("非法的配置应该失败: %d %s", code, stderr.String())
+	}
+
+	stdout.Reset()
+	if code := run([]string{"whatif", "-config", config}, strings.NewReader(testLog), &stdout, &stderr); code != 0 {
+		t.Fatalf("回放失败: %s", stderr.String())
+	}
+	text := stdout.String()
+	for _, want := range []string{"requests 9, accepted 7, rejected 2", "mesh.path=/login (shadow)", "mesh|user=1              3         2         1         2024-05-01T10:00:00.8Z  mesh.user"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("文本输出应该包含 %q:\n%s", want, text)
+		}
+	}
+
+	stdout.Reset()
+	if code := run([]string{"whatif", "-config", config, "-format", "json"}, strings.NewReader(testLog), &stdout, &stderr); code != 0 {
+		t.Fatalf("回放失败: %s", stderr.String())
+	}
+	var report Report
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil || report.Rejected != 2 || len(report.Keys) != 5 {
+		t.Errorf("JSON 输出错误: %v %s", err, stdout.String())
+	}
+
+	if code := run([]string{"whatif", "-format", "xml"}, nil, &stdout, &stderr); code != 2 {
+		t.Errorf("未知的格式应该是用法错误: %d", code)
+	}
+	if code := run(nil, nil, &stdout, &stderr); code != 2 {
+		t.Errorf("缺少命令应该是用法错误: %d", code)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/CocaineCong/BiliBili-Code/cmd/internal/rlsconfig"
+)
+
+// countRules 统计配置中带有限流配置的规则数，中间层级不计入
+func countRules(c *rlsconfig.Config) int {
+	var count func(rules []rlsconfig.Rule) int
+	count = func(rules []rlsconfig.Rule) int {
+		n := 0
+		for _, r := range rules {
+			if r.RateLimit != nil {
+				n++
+			}
+			n += count(r.Descriptors)
+		}
+		return n
+	}
+	n := 0
+	for _, d := range c.Domains {
+		n += count(d.Descriptors)
+	}
+	return n
+}
+
+// parseDescriptors 解析请求日志中的 key：domain|k=v|k=v，一个请求的多个描述符之间用 ; 分隔
+// 例如 mesh|remote_address=10.0.0.1;path=/login 对应 Envoy 在 mesh 域发送的两个描述符
+func parseDescriptors(key string) (string, [][]rlsconfig.Entry, error) {
+	domain, rest, ok := strings.Cut(key, "|")
+	if !ok || domain == "" || rest == "" {
+		return "", nil, fmt.Errorf("expected \"domain|key=value\", got %q", key)
+	}
+	var descriptors [][]rlsconfig.Entry
+	for _, d := range strings.Split(rest, ";") {
+		var entries []rlsconfig.Entry
+		for _, e := range strings.Split(d, "|") {
+			k, v, ok := strings.Cut(e, "=")
+			if !ok || k == "" {
+				return "", nil, fmt.Errorf("invalid descriptor entry %q in %q", e, key)
+			}
+			entries = append(entries, rlsconfig.Entry{Key: k, Value: v})
+		}
+		descriptors = append(descriptors, entries)
+	}
+	return domain, descriptors, nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/CocaineCong/BiliBili-Code/cmd/internal/rlsconfig"
+)
+
+// TestCountRules 测试统计 ratelimitd 示例配置的规则数
+func TestCountRules(t *testing.T) {
+	c, err := rlsconfig.LoadConfig("../ratelimitd/ratelimit.yaml")
+	if err != nil {
+		t.Fatalf("示例配置应该合法: %v", err)
+	}
+	if n := countRules(c); n != 3 {
+		t.Errorf("规则数错误: %d", n)
+	}
+}
+
+// TestParseDescriptors 测试解析请求日志中的描述符
+func TestParseDescriptors(t *testing.T) {
+	domain, descriptors, err := parseDescriptors("mesh|remote_address=10.0.0.1;tenant=a|path=/api?x=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]rlsconfig.Entry{
+		{{Key: "remote_address", Value: "10.0.0.1"}},
+		{{Key: "tenant", Value: "a"}, {Key: "path", Value: "/api?x=1"}},
+	}
+	if domain != "mesh" || !reflect.DeepEqual(descriptors, want) {
+		t.Errorf("解析结果错误: %s %v", domain, descriptors)
+	}
+
+	for _, key := range []string{"user:1", "mesh|", "|path=/", "mesh|path", "mesh|=x"} {
+		if _, _, err := parseDescriptors(key); err == nil {
+			t.Errorf("%q 应该解析失败", key)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// ratelimitd 兼容 Envoy RateLimitService v3 协议的全局限流服务
+//
+// 用法：
+//
+//	ratelimitd -config ratelimit.yaml -addr :8081
+//
+// 收到 SIGHUP 时重新加载配置，已有规则的计数不会丢失。
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	rlsv3 "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/CocaineCong/BiliBili-Code/cmd/internal/rlsconfig"
+)
+
+func main() {
+	configPath := flag.String("config", "ratelimit.yaml", "规则配置文件")
+	addr := flag.String("addr", ":8081", "gRPC 监听地址")
+	flag.Parse()
+
+	c, err := rlsconfig.LoadConfig(*configPath)
+	if err != nil {
+		slog.Error("load config", "path", *configPath, "err", err)
+		os.Exit(1)
+	}
+	service, err := NewService(c)
+	if err != nil {
+		slog.Error("create service", "err", err)
+		os.Exit(1)
+	}
+	defer service.Stop()
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		slog.Error("listen", "addr", *addr, "err", err)
+		os.Exit(1)
+	}
+	server := grpc.NewServer()
+	rlsv3.RegisterRateLimitServiceServer(server, service)
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(server, healthServer)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		for sig := range signals {
+			if sig != syscall.SIGHUP {
+				healthServer.Shutdown()
+				server.GracefulStop()
+				return
+			}
+			c, err := rlsconfig.LoadConfig(*configPath)
+			if err == nil {
+				err = service.Load(c)
+			}
+			if err != nil {
+				slog.Error("reload config", "path", *configPath, "err", err)
+				continue
+			}
+			slog.Info("config reloaded", "path", *configPath)
+		}
+	}()
+
+	slog.Info("ratelimitd listening", "addr", listener.Addr().String())
+	if err := server.Serve(listener); err != nil {
+		slog.Error("serve", "err", err)
+		os.Exit(1)
+	}
+}
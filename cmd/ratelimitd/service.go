@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	ratelimitv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/common/ratelimit/v3"
+	rlsv3 "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/CocaineCong/BiliBili-Code/cmd/internal/rlsconfig"
+	"github.com/CocaineCong/BiliBili-Code/limit"
+	"github.com/CocaineCong/BiliBili-Code/limit/limitotel"
+)
+
+// Service 实现 Envoy 的 envoy.service.ratelimit.v3.RateLimitService
+// 1. 按 domain 和描述符条目逐级匹配规则（rlsconfig.Config.Match，与 limitctl 的回放相同），最后一个条目命中的规则生效
+// 2. 每个描述符（包含所有条目的值）对应一个独立的限流器
+// 3. 任意一个描述符超限时整体返回 OVER_LIMIT；影子模式下只记录日志，仍然放行
+// 4. 描述符的值来自客户端（如 remote_address），后台定期删除空闲的描述符，每条规则的描述符数达到 max_keys 后新描述符判为超限
+type Service struct {
+	rlsv3.UnimplementedRateLimitServiceServer
+
+	rules    atomic.Pointer[ruleSet] // 当前生效的规则
+	mutex    sync.Mutex              // 串行化规则加载
+	logger   *slog.Logger            // 日志
+	tracer   trace.Tracer            // 每次判定记录一个 span，描述符的判定记录为 span 事件
+	stopCh   chan struct{}           // 停止后台清理
+	stopOnce sync.Once
+}
+
+// ruleSet 编译后的规则
+type ruleSet struct {
+	config  *rlsconfig.Config // 规则配置，用于匹配描述符
+	shadow  bool              // 全局影子模式
+	maxKeys int               // 每条规则最多保存的描述符数
+	idle    time.Duration     // 描述符空闲多久后删除
+	nodes   map[string]*node  // 规则完整路径到带有限流配置的规则的映射
+}
+
+// node 带有限流配置的规则
+type node struct {
+	name     string               // 规则完整路径，如 mesh.tenant.path=/login
+	config   limit.Config         // 限流配置
+	shadow   bool                 // 影子模式
+	limiters *limit.KeyedRegistry // 描述符到限流器的映射
+}
+
+// NewService 根据配置创建限流服务
+func NewService(c *rlsconfig.Config) (*Service, error) {
+	s := &Service{logger: slog.Default(), tracer: otel.Tracer("ratelimitd"), stopCh: make(chan struct{})}
+	if err := s.Load(c); err != nil {
+		return nil, err
+	}
+	go s.evictLoop()
+	return s, nil
+}
+
+// evictLoop 每隔半个空闲时长清理一次空闲的描述符
+func (s *Service) evictLoop() {
+	for {
+		timer := time.NewTimer(s.rules.Load().idle / 2)
+		select {
+		case <-timer.C:
+			if n := s.EvictIdle(); n > 0 {
+				s.logger.Debug("evicted idle descriptors", "count", n)
+			}
+		case <-s.stopCh:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// EvictIdle 删除空闲的描述符，返回删除的数量
+// 空闲时长不小于规则恢复到初始状态需要的时间，删除后重新创建的限流器和删除前的状态相同
+func (s *Service) EvictIdle() int {
+	rules := s.rules.Load()
+	evicted := 0
+	rules.walk(func(n *node) {
+		evicted += n.limiters.EvictIdle(max(rules.idle, recoveryTime(n.config)))
+	})
+	return evicted
+}
+
+// recoveryTime 限流器从用尽配额恢复到初始状态需要的时间
+func recoveryTime(c limit.Config) time.Duration {
+	switch c.Algorithm {
+	case "fixed_window":
+		return time.Duration(c.Window)
+	case "sliding_window":
+		// 子窗口整个离开窗口后才过期，精度默认为窗口的 1/10
+		precision := c.Precision
+		if precision == 0 {
+			precision = c.Window / 10
+		}
+		return time.Duration(c.Window + precision)
+	case "token_bucket":
+		return time.Duration(c.Limit+c.Debt) * time.Second / time.Duration(c.Rate)
+	case "warmup_token_bucket":
+		return time.Duration(c.WarmUp)
+	default:
+		return 0
+	}
+}
+
+// Load 加载新的规则
+// 路径相同且算法不变的规则会沿用原来的限流器并原地调整参数，已有的计数不会丢失
+func (s *Service) Load(c *rlsconfig.Config) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var previous map[string]*node
+	if old := s.rules.Load(); old != nil {
+		previous = old.nodes
+	}
+
+	rules := &ruleSet{
+		config:  c,
+		shadow:  c.ShadowMode,
+		maxKeys: c.KeyLimit(),
+		idle:    c.IdleTime(),
+		nodes:   make(map[string]*node),
+	}
+	for _, d := range c.Domains {
+		if err := rules.build(rlsconfig.DomainName(d.Domain), d.Descriptors, previous); err != nil {
+			// 只停止新创建的限流器，沿用的仍由旧规则使用
+			rules.walk(func(n *node) {
+				if old := previous[n.name]; old == nil || old.limiters != n.limiters {
+					n.limiters.Stop()
+				}
+			})
+			return err
+		}
+	}
+	s.rules.Store(rules)
+
+	// 停止不再使用的限流器
+	reused := make(map[*limit.KeyedRegistry]bool)
+	rules.walk(func(n *node) { reused[n.limiters] = true })
+	for _, n := range previous {
+		if !reused[n.limiters] {
+			n.limiters.Stop()
+		}
+	}
+	return nil
+}
+
+// build 递归编译 prefix 下一级的规则
+func (rs *ruleSet) build(prefix string, rules []rlsconfig.Rule, previous map[string]*node) error {
+	for _, r := range rules {
+		name := prefix + "." + rlsconfig.RuleName(r.Key, r.Value)
+		if r.RateLimit != nil {
+			n := &node{name: name, config: *r.RateLimit, shadow: r.ShadowMode}
+			limiters, err := reuseLimiters(previous[name], n.config, rs.maxKeys)
+			if err != nil {
+				return err
+			}
+			n.limiters = limiters
+			rs.nodes[name] = n
+		}
+		if err := rs.build(name, r.Descriptors, previous); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reuseLimiters 沿用旧规则的限流器，算法变化或无法调整时重新创建
+func reuseLimiters(old *node, c limit.Config, maxKeys int) (*limit.KeyedRegistry, error) {
+	if old != nil && old.config.Algorithm == c.Algorithm {
+		if err := old.limiters.SetConfig(c); err == nil {
+			old.limiters.SetMaxKeys(maxKeys)
+			return old.limiters, nil
+		}
+	}
+	return limit.NewKeyedRegistryFromConfig(c, limit.WithMaxKeys(maxKeys))
+}
+
+// walk 遍历所有带有限流配置的规则
+func (rs *ruleSet) walk(fn func(*node)) {
+	for _, n := range rs.nodes {
+		fn(n)
+	}
+}
+
+// Stop 停止后台清理和所有限流器
+func (s *Service) Stop() {
+	s.stopOnce.Do(func() { close(s.stopCh) })
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if rules := s.rules.Load(); rules != nil {
+		rules.walk(func(n *node) { n.limiters.Stop() })
+	}
+}
+
+// ShouldRateLimit 判断请求是否超限
+func (s *Service) ShouldRateLimit(ctx context.Context, req *rlsv3.RateLimitRequest) (*rlsv3.RateLimitResponse, error) {
+	if req.GetDomain() == "" {
+		return nil, status.Error(codes.InvalidArgument, "domain is required")
+	}
+	if len(req.GetDescriptors()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "descriptors are required")
+	}
+
+	ctx, span := s.tracer.Start(ctx, "ratelimit.ShouldRateLimit",
+		trace.WithAttributes(attribute.String("ratelimit.domain", req.GetDomain())))
+	defer span.End()
+
+	rules := s.rules.Load()
+	hits := uint64(req.GetHitsAddend())
+	if hits == 0 {
+		hits = 1
+	}
+
+	resp := &rlsv3.RateLimitResponse{
+		OverallCode: rlsv3.RateLimitResponse_OK,
+		Statuses:    make([]*rlsv3.RateLimitResponse_DescriptorStatus, 0, len(req.GetDescriptors())),
+	}
+	for _, d := range req.GetDescriptors() {
+		descriptorHits := hits
+		if h := d.GetHitsAddend(); h != nil {
+			descriptorHits = h.GetValue()
+		}
+		st := s.check(ctx, rules, req.GetDomain(), d, descriptorHits)
+		if st.Code == rlsv3.RateLimitResponse_OVER_LIMIT {
+			resp.OverallCode = rlsv3.RateLimitResponse_OVER_LIMIT
+		}
+		resp.Statuses = append(resp.Statuses, st)
+	}
+
+	// 全局影子模式：保留各描述符的真实结果，整体放行
+	if rules.shadow && resp.OverallCode == rlsv3.RateLimitResponse_OVER_LIMIT {
+		s.logger.Info("rate limit exceeded in shadow mode", "domain", req.GetDomain())
+		resp.OverallCode = rlsv3.RateLimitResponse_OK
+	}
+	return resp, nil
+}
+
+// check 判断单个描述符是否超限，并把判定记录到 ctx 的 span 中
+func (s *Service) check(ctx context.Context, rules *ruleSet, domain string, d *ratelimitv3.RateLimitDescriptor, hits uint64) *rlsv3.RateLimitResponse_DescriptorStatus {
+	entries := make([]rlsconfig.Entry, len(d.GetEntries()))
+	for i, e := range d.GetEntries() {
+		entries[i] = rlsconfig.Entry{Key: e.GetKey(), Value: e.GetValue()}
+	}
+	path, _, ok := rules.config.Match(domain, entries)
+	n := rules.nodes[path]
+	if !ok || n == nil {
+		return &rlsv3.RateLimitResponse_DescriptorStatus{Code: rlsv3.RateLimitResponse_OK}
+	}
+
+	key := rlsconfig.DescriptorKey(entries)
+	limiter := n.limiters.Get(key)
+	allowed := rlsconfig.AllowHits(limiter, int64(min(hits, math.MaxInt64)))
+
+	// 预热令牌桶没有固定的剩余配额，返回 0
+	left, ok := limit.Remaining(limiter)
+	st := &rlsv3.RateLimitResponse_DescriptorStatus{
+		Code:           rlsv3.RateLimitResponse_OK,
+		CurrentLimit:   currentLimit(n),
+		LimitRemaining: clampUint32(left),
+	}
+	if !ok {
+		left = -1
+	}
+	limitotel.RecordDecision(ctx, limit.Decision{
+		Name:      n.name,
+		Algorithm: n.config.Algorithm,
+		Key:       key,
+		Allowed:   allowed,
+		Shadow:    n.shadow,
+	}, left, 0)
+	if !allowed {
+		if n.shadow {
+			s.logger.Info("rate limit exceeded in shadow mode", "rule", n.name, "descriptor", key, "hits", hits)
+		} else {
+			st.Code = rlsv3.RateLimitResponse_OVER_LIMIT
+		}
+	}
+	return st
+}
+
+// units 时间窗口到 Envoy 时间单位的映射
+var units = map[time.Duration]rlsv3.RateLimitResponse_RateLimit_Unit{
+	time.Second:    rlsv3.RateLimitResponse_RateLimit_SECOND,
+	time.Minute:    rlsv3.RateLimitResponse_RateLimit_MINUTE,
+	time.Hour:      rlsv3.RateLimitResponse_RateLimit_HOUR,
+	24 * time.Hour: rlsv3.RateLimitResponse_RateLimit_DAY,
+}
+
+// currentLimit 规则的限制，窗口不是整秒、分、时、天时单位为 UNKNOWN
+func currentLimit(n *node) *rlsv3.RateLimitResponse_RateLimit {
+	c := n.config
+	switch c.Algorithm {
+	case "fixed_window", "sliding_window":
+		return &rlsv3.RateLimitResponse_RateLimit{
+			Name:            n.name,
+			RequestsPerUnit: clampUint32(c.Limit),
+			Unit:            units[time.Duration(c.Window)],
+		}
+	default:
+		return &rlsv3.RateLimitResponse_RateLimit{
+			Name:            n.name,
+			RequestsPerUnit: clampUint32(c.Rate),
+			Unit:            rlsv3.RateLimitResponse_RateLimit_SECOND,
+		}
+	}
+}
+
+// clampUint32 把 int64 限制在 uint32 范围内
+func clampUint32(v int64) uint32 {
+	return uint32(max(0, min(v, math.MaxUint32)))
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	ratelimitv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/common/ratelimit/v3"
+	rlsv3 "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/CocaineCong/BiliBili-Code/cmd/internal/rlsconfig"
+	"github.com/CocaineCong/BiliBili-Code/limit/limitotel"
+)
+
+const testConfig = `
+domains:
+  - domain: mesh
+    descriptors:
+      - key: remote_address
+        rate_limit: {algorithm: fixed_window, limit: 2, window: 1m}
+      - key: path
+        value: /login
+        rate_limit: {algorithm: sliding_window, limit: 1, window: 1m}
+      - key: path
+        value: /search
+        shadow_mode: true
+        rate_limit: {algorithm: fixed_window, limit: 1, window: 1m}
+      - key: tenant
+        descriptors:
+          - key: path
+            rate_limit: {algorithm: token_bucket, limit: 5, rate: 1}
+`
+
+// startServer 在进程内启动限流服务，返回 gRPC 客户端
+func startServer(t *testing.T, config string) (rlsv3.RateLimitServiceClient, *Service) {
+	t.Helper()
+	c, err := rlsconfig.ParseConfig([]byte(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	service, err := NewService(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	rlsv3.RegisterRateLimitServiceServer(server, service)
+	go server.Serve(listener)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		server.Stop()
+		service.Stop()
+	})
+	return rlsv3.NewRateLimitServiceClient(conn), service
+}
+
+// descriptor 构造描述符，参数依次为 key、value
+func descriptor(kv ...string) *ratelimitv3.RateLimitDescriptor {
+	d := &ratelimitv3.RateLimitDescriptor{}
+	for i := 0; i+1 < len(kv); i += 2 {
+		d.Entries = append(d.Entries, &ratelimitv3.RateLimitDescriptor_Entry{Key: kv[i], Value: kv[i+1]})
+	}
+	return d
+}
+
+// shouldRateLimit 发送限流请求
+func shouldRateLimit(t *testing.T, client rlsv3.RateLimitServiceClient, req *rlsv3.RateLimitRequest) *rlsv3.RateLimitResponse {
+	t.Helper()
+	if req.Domain == "" {
+		req.Domain = "mesh"
+	}
+	resp, err := client.ShouldRateLimit(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+// TestService_Basic 测试按描述符限流，每个值独立计数
+func TestService_Basic(t *testing.T) {
+	client, _ := startServer(t, testConfig)
+	req := func(ip string) *rlsv3.RateLimitRequest {
+		return &rlsv3.RateLimitRequest{Descriptors: []*ratelimitv3.RateLimitDescriptor{descriptor("remote_address", ip)}}
+	}
+
+	for i := 0; i < 2; i++ {
+		resp := shouldRateLimit(t, client, req("10.0.0.1"))
+		if resp.OverallCode != rlsv3.RateLimitResponse_OK {
+			t.Errorf("第%d个请求应该通过", i+1)
+		}
+		st := resp.Statuses[0]
+		if st.LimitRemaining != uint32(1-i) || st.CurrentLimit.RequestsPerUnit != 2 ||
+			st.CurrentLimit.Unit != rlsv3.RateLimitResponse_RateLimit_MINUTE {
+			t.Errorf("描述符状态错误: %+v", st)
+		}
+	}
+	if resp := shouldRateLimit(t, client, req("10.0.0.1")); resp.OverallCode != rlsv3.RateLimitResponse_OVER_LIMIT {
+		t.Error("第3个请求应该被拒绝")
+	}
+	if resp := shouldRateLimit(t, client, req("10.0.0.2")); resp.OverallCode != rlsv3.RateLimitResponse_OK {
+		t.Error("其他 IP 不应该受影响")
+	}
+}
+
+// TestService_Match 测试精确匹配、嵌套规则和未命中规则
+func TestService_Match(t *testing.T) {
+	client, _ := startServer(t, testConfig)
+
+	resp := shouldRateLimit(t, client, &rlsv3.RateLimitRequest{Descriptors: []*ratelimitv3.RateLimitDescriptor{
+		descriptor("path", "/login"),
+		descriptor("path", "/about"),
+		descriptor("tenant", "acme", "path", "/orders"),
+		descriptor("unknown", "x"),
+	}})
+	if resp.OverallCode != rlsv3.RateLimitResponse_OK || len(resp.Statuses) != 4 {
+		t.Fatalf("响应错误: %+v", resp)
+	}
+	if resp.Statuses[0].CurrentLimit.GetName() != "mesh.path=/login" {
+		t.Errorf("精确匹配的规则错误: %+v", resp.Statuses[0])
+	}
+	if resp.Statuses[1].CurrentLimit != nil || resp.Statuses[3].CurrentLimit != nil {
+		t.Error("未命中规则的描述符不应该有限制")
+	}
+	if st := resp.Statuses[2]; st.CurrentLimit.GetName() != "mesh.tenant.path" || st.LimitRemaining != 4 {
+		t.Errorf("嵌套规则错误: %+v", st)
+	}
+
+	// 只有 tenant 一级时没有限制
+	resp = shouldRateLimit(t, client, &rlsv3.RateLimitRequest{Descriptors: []*ratelimitv3.RateLimitDescriptor{descriptor("tenant", "acme")}})
+	if resp.Statuses[0].CurrentLimit != nil {
+		t.Error("中间层级不应该有限制")
+	}
+
+	// key 和值分开比较，和规则名称相同的 key 不会命中规则
+	resp = shouldRateLimit(t, client, &rlsv3.RateLimitRequest{Descriptors: []*ratelimitv3.RateLimitDescriptor{
+		descriptor("path_/login", ""),
+		descriptor("path=/login", ""),
+	}})
+	for _, st := range resp.Statuses {
+		if st.CurrentLimit != nil {
+			t.Errorf("key 为规则名称的描述符不应该命中规则: %+v", st)
+		}
+	}
+
+	resp = shouldRateLimit(t, client, &rlsv3.RateLimitRequest{Descriptors: []*ratelimitv3.RateLimitDescriptor{descriptor("path", "/login")}})
+	if resp.OverallCode != rlsv3.RateLimitResponse_OVER_LIMIT {
+		t.Error("/login 第2个请求应该被拒绝")
+	}
+}
+
+// TestService_HitsAddend 测试一次消耗多个配额
+func TestService_HitsAddend(t *testing.T) {
+	client, _ := startServer(t, testConfig)
+	d := descriptor("tenant", "acme", "path", "/upload")
+
+	resp := shouldRateLimit(t, client, &rlsv3.RateLimitRequest{HitsAddend: 3, Descriptors: []*ratelimitv3.RateLimitDescriptor{d}})
+	if resp.OverallCode != rlsv3.RateLimitResponse_OK || resp.Statuses[0].LimitRemaining != 2 {
+		t.Errorf("消耗3个配额后应该剩余2个: %+v", resp.Statuses[0])
+	}
+	// 描述符上的 hits_addend 优先于请求上的
+	d.HitsAddend = wrapperspb.UInt64(3)
+	resp = shouldRateLimit(t, client, &rlsv3.RateLimitRequest{HitsAddend: 1, Descriptors: []*ratelimitv3.RateLimitDescriptor{d}})
+	if resp.OverallCode != rlsv3.RateLimitResponse_OVER_LIMIT || resp.Statuses[0].LimitRemaining != 2 {
+		t.Errorf("配额不足时应该被拒绝且不消耗配额: %+v", resp.Statuses[0])
+	}
+}
+
+// TestService_ShadowMode 测试规则级和全局影子模式
+func TestService_ShadowMode(t *testing.T) {
+	client, _ := startServer(t, testConfig)
+	search := &rlsv3.RateLimitRequest{Descriptors: []*ratelimitv3.RateLimitDescriptor{descriptor("path", "/search")}}
+	for i := 0; i < 3; i++ {
+		if resp := shouldRateLimit(t, client, search); resp.OverallCode != rlsv3.RateLimitResponse_OK {
+			t.Errorf("影子模式的规则不应该拒绝请求: 第%d个", i+1)
+		}
+	}
+
+	client, _ = startServer(t, "shadow_mode: true\n"+testConfig)
+	login := &rlsv3.RateLimitRequest{Descriptors: []*ratelimitv3.RateLimitDescriptor{descriptor("path", "/login")}}
+	shouldRateLimit(t, client, login)
+	resp := shouldRateLimit(t, client, login)
+	if resp.OverallCode != rlsv3.RateLimitResponse_OK {
+		t.Error("全局影子模式下应该放行")
+	}
+	if resp.Statuses[0].Code != rlsv3.RateLimitResponse_OVER_LIMIT {
+		t.Error("全局影子模式下描述符状态应该保留真实结果")
+	}
+}
+
+// TestService_Reload 测试重新加载配置时保留计数
+func TestService_Reload(t *testing.T) {
+	client, service := startServer(t, testConfig)
+	login := &rlsv3.RateLimitRequest{Descriptors: []*ratelimitv3.RateLimitDescriptor{descriptor("path", "/login")}}
+	shouldRateLimit(t, client, login)
+
+	c, err := rlsconfig.ParseConfig([]byte(`
+domains:
+  - domain: mesh
+    descriptors:
+      - key: path
+        value: /login
+        rate_limit: {algorithm: sliding_window, limit: 2, window: 1m}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Load(c); err != nil {
+		t.Fatal(err)
+	}
+	if resp := shouldRateLimit(t, client, login); resp.OverallCode != rlsv3.RateLimitResponse_OK || resp.Statuses[0].LimitRemaining != 0 {
+		t.Errorf("提高限制后应该沿用已有计数: %+v", resp.Statuses[0])
+	}
+	if resp := shouldRateLimit(t, client, login); resp.OverallCode != rlsv3.RateLimitResponse_OVER_LIMIT {
+		t.Error("第3个请求应该被拒绝")
+	}
+	resp := shouldRateLimit(t, client, &rlsv3.RateLimitRequest{Descriptors: []*ratelimitv3.RateLimitDescriptor{descriptor("remote_address", "10.0.0.1")}})
+	if resp.Statuses[0].CurrentLimit != nil {
+		t.Error("删除的规则不应该再生效")
+	}
+}
+
+// TestService_InvalidRequest 测试非法请求
+func TestService_InvalidRequest(t *testing.T) {
+	client, _ := startServer(t, testConfig)
+	requests := []*rlsv3.RateLimitRequest{
+		{Descriptors: []*ratelimitv3.RateLimitDescriptor{descriptor("path", "/login")}},
+		{Domain: "mesh"},
+	}
+	for _, req := range requests {
+		_, err := client.ShouldRateLimit(context.Background(), req)
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("应该返回 InvalidArgument: %v", err)
+		}
+	}
+	resp := shouldRateLimit(t, client, &rlsv3.RateLimitRequest{Domain: "other", Descriptors: []*ratelimitv3.RateLimitDescriptor{descriptor("path", "/login")}})
+	if resp.OverallCode != rlsv3.RateLimitResponse_OK {
+		t.Error("未配置的域应该放行")
+	}
+}
+
+// TestService_Trace 测试每次请求记录一个 span，描述符的判定记录为事件
+func TestService_Trace(t *testing.T) {
+	_, service := startServer(t, testConfig)
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	defer tp.Shutdown(context.Background())
+	service.tracer = tp.Tracer("ratelimitd")
+
+	_, err := service.ShouldRateLimit(context.Background(), &rlsv3.RateLimitRequest{
+		Domain: "mesh",
+		Descriptors: []*ratelimitv3.RateLimitDescriptor{
+			descriptor("path", "/search"),
+			descriptor("path", "/search"),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 || spans[0].Name != "ratelimit.ShouldRateLimit" {
+		t.Fatalf("应该记录一个 span: %+v", spans)
+	}
+	events := spans[0].Events
+	if len(events) != 2 {
+		t.Fatalf("每个描述符应该记录一个事件: %d", len(events))
+	}
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range events[1].Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	if attrs[limitotel.AttrName].AsString() != "mesh.path=/search" ||
+		attrs[limitotel.AttrKey].AsString() != "path=/search" ||
+		attrs[limitotel.AttrDecision].AsString() != "rejected" ||
+		!attrs[limitotel.AttrShadow].AsBool() ||
+		attrs[limitotel.AttrRemaining].AsInt64() != 0 {
+		t.Errorf("判定事件的属性错误: %v", events[1].Attributes)
+	}
+}
+
+// TestService_MaxKeys 测试描述符数达到上限后新描述符判为超限
+func TestService_MaxKeys(t *testing.T) {
+	client, _ := startServer(t, "max_keys: 2\n"+testConfig)
+	req := func(ip string) *rlsv3.RateLimitRequest {
+		return &rlsv3.RateLimitRequest{Descriptors: []*ratelimitv3.RateLimitDescriptor{descriptor("remote_address", ip)}}
+	}
+
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2"} {
+		if resp := shouldRateLimit(t, client, req(ip)); resp.OverallCode != rlsv3.RateLimitResponse_OK {
+			t.Errorf("%s 应该通过", ip)
+		}
+	}
+	if resp := shouldRateLimit(t, client, req("10.0.0.3")); resp.OverallCode != rlsv3.RateLimitResponse_OVER_LIMIT {
+		t.Error("超过描述符上限的新值应该被拒绝")
+	}
+	if resp := shouldRateLimit(t, client, req("10.0.0.1")); resp.OverallCode != rlsv3.RateLimitResponse_OK {
+		t.Error("已有的描述符不受上限影响")
+	}
+}
+
+// TestService_EvictIdle 测试删除空闲的描述符，删除时间不早于规则的窗口
+func TestService_EvictIdle(t *testing.T) {
+	client, service := startServer(t, `
+idle_timeout: 10ms
+domains:
+  - domain: mesh
+    descriptors:
+      - key: remote_address
+        rate_limit: {algorithm: fixed_window, limit: 1, window: 50ms}
+`)
+	for i := 0; i < 3; i++ {
+		shouldRateLimit(t, client, &rlsv3.RateLimitRequest{Descriptors: []*ratelimitv3.RateLimitDescriptor{
+			descriptor("remote_address", fmt.Sprintf("10.0.0.%d", i)),
+		}})
+	}
+
+	// 后台也在清理，直接检查规则中保存的描述符数
+	limiters := service.rules.Load().nodes["mesh.remote_address"].limiters
+	// 超过 idle_timeout 但还在窗口内，删除会丢失计数
+	time.Sleep(20 * time.Millisecond)
+	service.EvictIdle()
+	if n := limiters.Len(); n != 3 {
+		t.Errorf("窗口结束前不应该删除描述符，剩余 %d 个", n)
+	}
+	time.Sleep(40 * time.Millisecond)
+	service.EvictIdle()
+	if n := limiters.Len(); n != 0 {
+		t.Errorf("空闲的描述符应该被删除，剩余 %d 个", n)
+	}
+}
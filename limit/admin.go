@@ -0,0 +1,413 @@
+package limit
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// Registry 命名限流器注册表，供管理接口查看和修改线上限流器
+type Registry struct {
+	limiters map[string]RateLimiter  // 名称到普通限流器的映射
+	keyed    map[string]KeyedLimiter // 名称到 key 限流器的映射
+	mutex    sync.RWMutex            // 读写锁
+}
+
+// NewRegistry 创建限流器注册表
+func NewRegistry() *Registry {
+	return &Registry{
+		limiters: make(map[string]RateLimiter),
+		keyed:    make(map[string]KeyedLimiter),
+	}
+}
+
+// Register 注册普通限流器，同名限流器会被覆盖
+func (r *Registry) Register(name string, limiter RateLimiter) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.keyed, name)
+	r.limiters[name] = limiter
+}
+
+// RegisterKeyed 注册 key 限流器，同名限流器会被覆盖
+func (r *Registry) RegisterKeyed(name string, limiter KeyedLimiter) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.limiters, name)
+	r.keyed[name] = limiter
+}
+
+// Unregister 取消注册
+func (r *Registry) Unregister(name string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.limiters, name)
+	delete(r.keyed, name)
+}
+
+// Names 获取所有限流器名称（已排序）
+func (r *Registry) Names() []string {
+	r.mutex.RLock()
+	names := make([]string, 0, len(r.limiters)+len(r.keyed))
+	for name := range r.limiters {
+		names = append(names, name)
+	}
+	for name := range r.keyed {
+		names = append(names, name)
+	}
+	r.mutex.RUnlock()
+
+	sort.Strings(names)
+	return names
+}
+
+// lookup 按名称查找限流器，两个返回值最多只有一个非空
+func (r *Registry) lookup(name string) (RateLimiter, KeyedLimiter, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if l, ok := r.limiters[name]; ok {
+		return l, nil, true
+	}
+	if k, ok := r.keyed[name]; ok {
+		return nil, k, true
+	}
+	return nil, nil, false
+}
+
+// KeyStatus 限流状态
+type KeyStatus struct {
+	Key     string `json:"key,omitempty"` // 限流 key，非 key 限流器为空
+	Current int64  `json:"current"`       // 当前值
+	Limit   int64  `json:"limit"`         // 限制
+}
+
+// LimiterInfo 管理接口返回的限流器信息
+type LimiterInfo struct {
+	Name      string          `json:"name"`              // 限流器名称
+	Algorithm string          `json:"algorithm"`         // 限流算法
+	Keyed     bool            `json:"keyed"`             // 是否为 key 限流器
+	Config    *Config         `json:"config,omitempty"`  // 当前参数，无法获取时为空
+	Status    *KeyStatus      `json:"status,omitempty"`  // 普通限流器的状态
+	Keys      *int            `json:"keys,omitempty"`    // key 限流器当前的 key 数量
+	Shadow    *bool           `json:"shadow,omitempty"`  // 是否处于影子模式，不支持影子模式时为空
+	Stats     *ObserveStats   `json:"stats,omitempty"`   // 判定统计，未包装 ObservedLimiter 时为空
+	Classes   []PriorityStats `json:"classes,omitempty"` // 各优先级类别的统计，未包装 PriorityLimiter 时为空
+}
+
+// shadowSwitch 支持切换影子模式的限流器
+type shadowSwitch interface {
+	SetShadow(shadow bool)
+	Shadow() bool
+}
+
+// statsReporter 支持判定统计的限流器
+type statsReporter interface {
+	Stats() ObserveStats
+}
+
+// classStatsReporter 支持按优先级类别统计的限流器
+type classStatsReporter interface {
+	ClassStats() []PriorityStats
+}
+
+// keyedConfigurable 支持按配置调整的 key 限流器
+type keyedConfigurable interface {
+	Config() (Config, bool)
+	SetConfig(c Config) error
+}
+
+// info 生成限流器信息
+func (r *Registry) info(name string) (LimiterInfo, bool) {
+	limiter, keyed, ok := r.lookup(name)
+	if !ok {
+		return LimiterInfo{}, false
+	}
+
+	info := LimiterInfo{Name: name}
+	if limiter != nil {
+		info.Algorithm = Algorithm(limiter)
+		if c, ok := ConfigOf(limiter); ok {
+			info.Config = &c
+		}
+		current, limit := limiter.GetStatus()
+		info.Status = &KeyStatus{Current: current, Limit: limit}
+		if s, ok := findLimiter[shadowSwitch](limiter); ok {
+			shadow := s.Shadow()
+			info.Shadow = &shadow
+		}
+		if s, ok := findLimiter[statsReporter](limiter); ok {
+			stats := s.Stats()
+			info.Stats = &stats
+		}
+		if s, ok := findLimiter[classStatsReporter](limiter); ok {
+			info.Classes = s.ClassStats()
+		}
+		return info, true
+	}
+
+	info.Keyed = true
+	info.Algorithm = KeyedAlgorithm(keyed)
+	if c, ok := findKeyed[keyedConfigurable](keyed); ok {
+		if config, ok := c.Config(); ok {
+			info.Config = &config
+		}
+	}
+	if l, ok := findKeyed[interface{ Len() int }](keyed); ok {
+		n := l.Len()
+		info.Keys = &n
+	}
+	if s, ok := findKeyed[shadowSwitch](keyed); ok {
+		shadow := s.Shadow()
+		info.Shadow = &shadow
+	}
+	if s, ok := findKeyed[statsReporter](keyed); ok {
+		stats := s.Stats()
+		info.Stats = &stats
+	}
+	return info, true
+}
+
+// admin 管理接口
+type admin struct {
+	registry *Registry
+	auth     func(r *http.Request) bool
+}
+
+// NewAdminHandler 创建限流器管理接口
+// auth: 鉴权钩子，返回 false 时响应 401，为 nil 时不鉴权
+//
+// 接口列表：
+//
+//	GET    /limiters                    列出所有限流器
+//	GET    /limiters/{name}             查看限流器
+//	GET    /limiters/{name}/keys        查看 key 限流器的所有 key
+//	GET    /limiters/{name}/keys/{key}  查看 key 的状态
+//	DELETE /limiters/{name}/keys/{key}  重置 key
+//	PUT    /limiters/{name}/config      修改参数，body 为 Config，未提供的字段保持不变
+//	PUT    /limiters/{name}/shadow      切换影子模式，body 为 {"shadow": true}
+func NewAdminHandler(registry *Registry, auth func(r *http.Request) bool) http.Handler {
+	a := &admin{registry: registry, auth: auth}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /limiters", a.list)
+	mux.HandleFunc("GET /limiters/{name}", a.get)
+	mux.HandleFunc("GET /limiters/{name}/keys", a.keys)
+	mux.HandleFunc("GET /limiters/{name}/keys/{key...}", a.getKey)
+	mux.HandleFunc("DELETE /limiters/{name}/keys/{key...}", a.resetKey)
+	mux.HandleFunc("PUT /limiters/{name}/config", a.setConfig)
+	mux.HandleFunc("PUT /limiters/{name}/shadow", a.setShadow)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.auth != nil && !a.auth(r) {
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// list 列出所有限流器
+func (a *admin) list(w http.ResponseWriter, r *http.Request) {
+	names := a.registry.Names()
+	infos := make([]LimiterInfo, 0, len(names))
+	for _, name := range names {
+		if info, ok := a.registry.info(name); ok {
+			infos = append(infos, info)
+		}
+	}
+	writeJSON(w, http.StatusOK, infos)
+}
+
+// get 查看限流器
+func (a *admin) get(w http.ResponseWriter, r *http.Request) {
+	info, ok := a.registry.info(r.PathValue("name"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "limiter not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+// keyedLimiter 获取 key 限流器，不存在或不是 key 限流器时写入错误响应
+func (a *admin) keyedLimiter(w http.ResponseWriter, r *http.Request) (KeyedLimiter, bool) {
+	_, keyed, ok := a.registry.lookup(r.PathValue("name"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "limiter not found")
+		return nil, false
+	}
+	if keyed == nil {
+		writeError(w, http.StatusBadRequest, "limiter is not keyed")
+		return nil, false
+	}
+	return keyed, true
+}
+
+// keyLookup 支持查询 key 而不创建限流器的 key 限流器
+type keyLookup interface {
+	Keys() []string
+	Lookup(key string) (RateLimiter, bool)
+}
+
+// keys 查看 key 限流器的所有 key
+func (a *admin) keys(w http.ResponseWriter, r *http.Request) {
+	keyed, ok := a.keyedLimiter(w, r)
+	if !ok {
+		return
+	}
+	lookup, ok := findKeyed[keyLookup](keyed)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, "limiter cannot list keys")
+		return
+	}
+
+	keys := lookup.Keys()
+	statuses := make([]KeyStatus, 0, len(keys))
+	for _, key := range keys {
+		if limiter, ok := lookup.Lookup(key); ok {
+			current, limit := limiter.GetStatus()
+			statuses = append(statuses, KeyStatus{Key: key, Current: current, Limit: limit})
+		}
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+// getKey 查看 key 的状态
+func (a *admin) getKey(w http.ResponseWriter, r *http.Request) {
+	keyed, ok := a.keyedLimiter(w, r)
+	if !ok {
+		return
+	}
+	key := r.PathValue("key")
+	// 优先使用不会创建限流器的查询，避免查看操作本身产生新的 key
+	if lookup, ok := findKeyed[keyLookup](keyed); ok {
+		limiter, ok := lookup.Lookup(key)
+		if !ok {
+			writeError(w, http.StatusNotFound, "key not found")
+			return
+		}
+		current, limit := limiter.GetStatus()
+		writeJSON(w, http.StatusOK, KeyStatus{Key: key, Current: current, Limit: limit})
+		return
+	}
+	current, limit := keyed.GetKeyStatus(key)
+	writeJSON(w, http.StatusOK, KeyStatus{Key: key, Current: current, Limit: limit})
+}
+
+// resetKey 重置 key
+func (a *admin) resetKey(w http.ResponseWriter, r *http.Request) {
+	keyed, ok := a.keyedLimiter(w, r)
+	if !ok {
+		return
+	}
+	resetter, ok := findKeyed[interface{ Reset(key string) }](keyed)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, "limiter cannot reset keys")
+		return
+	}
+	resetter.Reset(r.PathValue("key"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setConfig 修改参数
+func (a *admin) setConfig(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	limiter, keyed, ok := a.registry.lookup(name)
+	if !ok {
+		writeError(w, http.StatusNotFound, "limiter not found")
+		return
+	}
+
+	var err error
+	if limiter != nil {
+		config, ok := ConfigOf(limiter)
+		if !ok {
+			writeError(w, http.StatusNotImplemented, "limiter cannot be reconfigured")
+			return
+		}
+		if !decodeJSON(w, r, &config) {
+			return
+		}
+		err = Reconfigure(limiter, config)
+	} else {
+		configurable, ok := findKeyed[keyedConfigurable](keyed)
+		if !ok {
+			writeError(w, http.StatusNotImplemented, "limiter cannot be reconfigured")
+			return
+		}
+		config, ok := configurable.Config()
+		if !ok {
+			writeError(w, http.StatusNotImplemented, "limiter cannot be reconfigured")
+			return
+		}
+		if !decodeJSON(w, r, &config) {
+			return
+		}
+		err = configurable.SetConfig(config)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	info, _ := a.registry.info(name)
+	writeJSON(w, http.StatusOK, info)
+}
+
+// setShadow 切换影子模式
+func (a *admin) setShadow(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	limiter, keyed, ok := a.registry.lookup(name)
+	if !ok {
+		writeError(w, http.StatusNotFound, "limiter not found")
+		return
+	}
+
+	var s shadowSwitch
+	if limiter != nil {
+		s, ok = findLimiter[shadowSwitch](limiter)
+	} else {
+		s, ok = findKeyed[shadowSwitch](keyed)
+	}
+	if !ok {
+		writeError(w, http.StatusNotImplemented, "limiter does not support shadow mode")
+		return
+	}
+
+	var body struct {
+		Shadow *bool `json:"shadow"`
+	}
+	if !decodeJSON(w, r, &body) {
+		return
+	}
+	if body.Shadow == nil {
+		writeError(w, http.StatusBadRequest, "shadow is required")
+		return
+	}
+	s.SetShadow(*body.Shadow)
+
+	info, _ := a.registry.info(name)
+	writeJSON(w, http.StatusOK, info)
+}
+
+// decodeJSON 解析请求体，失败时写入错误响应
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// writeJSON 写入 JSON 响应
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError 写入错误响应
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
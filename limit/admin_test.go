@@ -0,0 +1,184 @@
+package limit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestAdmin 创建带有一个普通限流器和一个 key 限流器的管理接口
+func newTestAdmin(t *testing.T) (http.Handler, *ObservedLimiter, *KeyedRegistry) {
+	t.Helper()
+	global := NewObservedLimiter("global", NewTokenBucket(10, 5))
+	t.Cleanup(global.Stop)
+	perUser, err := NewKeyedRegistryFromConfig(Config{Algorithm: "fixed_window", Limit: 2, Window: Duration(time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(perUser.Stop)
+
+	registry := NewRegistry()
+	registry.Register("global", global)
+	registry.RegisterKeyed("per_user", NewObservedKeyedLimiter("per_user", perUser))
+	handler := NewAdminHandler(registry, func(r *http.Request) bool {
+		return r.Header.Get("Authorization") == "Bearer ops"
+	})
+	return handler, global, perUser
+}
+
+// doAdmin 发送管理请求
+func doAdmin(t *testing.T, h http.Handler, method, path, body string, out any) int {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer ops")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if out != nil && rec.Code < 300 {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("解析响应失败: %v: %s", err, rec.Body.String())
+		}
+	}
+	return rec.Code
+}
+
+// TestAdmin_List 测试列出限流器
+func TestAdmin_List(t *testing.T) {
+	h, global, perUser := newTestAdmin(t)
+	global.Allow()
+	perUser.AllowKey("uid:1")
+
+	var infos []LimiterInfo
+	if code := doAdmin(t, h, "GET", "/limiters", "", &infos); code != http.StatusOK {
+		t.Fatalf("状态码错误: %d", code)
+	}
+	if len(infos) != 2 {
+		t.Fatalf("限流器数量错误: %+v", infos)
+	}
+
+	g := infos[0]
+	if g.Name != "global" || g.Algorithm != "token_bucket" || g.Keyed || g.Config.Rate != 5 ||
+		g.Status.Current != 9 || g.Shadow == nil || *g.Shadow || g.Stats.Allowed != 1 {
+		t.Errorf("普通限流器信息错误: %+v", g)
+	}
+	u := infos[1]
+	if u.Name != "per_user" || u.Algorithm != "fixed_window" || !u.Keyed || u.Config.Limit != 2 || *u.Keys != 1 {
+		t.Errorf("key 限流器信息错误: %+v", u)
+	}
+}
+
+// TestAdmin_Auth 测试鉴权钩子
+func TestAdmin_Auth(t *testing.T) {
+	h, _, _ := newTestAdmin(t)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/limiters", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("未鉴权请求应该返回401: %d", rec.Code)
+	}
+}
+
+// TestAdmin_Keys 测试查看和重置 key
+func TestAdmin_Keys(t *testing.T) {
+	h, _, perUser := newTestAdmin(t)
+	perUser.AllowKey("uid:1")
+	perUser.AllowKey("uid:1")
+	perUser.AllowKey("2001:db8::/64")
+
+	var keys []KeyStatus
+	doAdmin(t, h, "GET", "/limiters/per_user/keys", "", &keys)
+	if len(keys) != 2 || keys[1].Key != "uid:1" || keys[1].Current != 2 {
+		t.Errorf("key 列表错误: %+v", keys)
+	}
+
+	var status KeyStatus
+	if code := doAdmin(t, h, "GET", "/limiters/per_user/keys/"+url.PathEscape("2001:db8::/64"), "", &status); code != http.StatusOK {
+		t.Fatalf("查询带 / 的 key 失败: %d", code)
+	}
+	if status.Current != 1 || status.Limit != 2 {
+		t.Errorf("key 状态错误: %+v", status)
+	}
+	if code := doAdmin(t, h, "GET", "/limiters/per_user/keys/uid:404", "", nil); code != http.StatusNotFound {
+		t.Errorf("不存在的 key 应该返回404: %d", code)
+	}
+	if perUser.Len() != 2 {
+		t.Error("查询不存在的 key 不应该创建限流器")
+	}
+
+	if code := doAdmin(t, h, "DELETE", "/limiters/per_user/keys/uid:1", "", nil); code != http.StatusNoContent {
+		t.Fatalf("重置 key 失败: %d", code)
+	}
+	if !perUser.AllowKey("uid:1") {
+		t.Error("重置后请求应该通过")
+	}
+	if code := doAdmin(t, h, "GET", "/limiters/global/keys", "", nil); code != http.StatusBadRequest {
+		t.Errorf("普通限流器没有 key，应该返回400: %d", code)
+	}
+}
+
+// TestAdmin_Config 测试运行时修改参数
+func TestAdmin_Config(t *testing.T) {
+	h, global, perUser := newTestAdmin(t)
+
+	var info LimiterInfo
+	if code := doAdmin(t, h, "PUT", "/limiters/global/config", `{"rate":50}`, &info); code != http.StatusOK {
+		t.Fatalf("修改参数失败: %d", code)
+	}
+	if c, _ := ConfigOf(global); c.Rate != 50 || c.Limit != 10 {
+		t.Errorf("修改后参数错误: %+v", c)
+	}
+
+	doAdmin(t, h, "PUT", "/limiters/per_user/config", `{"limit":5}`, &info)
+	if c, _ := perUser.Config(); c.Limit != 5 || info.Config.Limit != 5 {
+		t.Errorf("key 限流器修改后参数错误: %+v", c)
+	}
+
+	for _, body := range []string{`{"algorithm":"leaky_bucket"}`, `{"rate":-1}`, `{"bogus":1}`, `not json`} {
+		if code := doAdmin(t, h, "PUT", "/limiters/global/config", body, nil); code != http.StatusBadRequest {
+			t.Errorf("%s 应该返回400: %d", body, code)
+		}
+	}
+	if code := doAdmin(t, h, "PUT", "/limiters/nope/config", `{}`, nil); code != http.StatusNotFound {
+		t.Errorf("不存在的限流器应该返回404: %d", code)
+	}
+}
+
+// TestAdmin_Shadow 测试切换影子模式
+func TestAdmin_Shadow(t *testing.T) {
+	h, global, _ := newTestAdmin(t)
+
+	var info LimiterInfo
+	if code := doAdmin(t, h, "PUT", "/limiters/per_user/shadow", `{"shadow":true}`, &info); code != http.StatusOK {
+		t.Fatalf("切换影子模式失败: %d", code)
+	}
+	if info.Shadow == nil || !*info.Shadow {
+		t.Errorf("切换后应该处于影子模式: %+v", info)
+	}
+
+	doAdmin(t, h, "PUT", "/limiters/global/shadow", `{"shadow":true}`, nil)
+	if !global.Shadow() {
+		t.Error("普通限流器应该处于影子模式")
+	}
+	if code := doAdmin(t, h, "PUT", "/limiters/global/shadow", `{}`, nil); code != http.StatusBadRequest {
+		t.Errorf("缺少 shadow 字段应该返回400: %d", code)
+	}
+}
+
+// TestAdmin_PriorityClasses 测试返回各优先级类别的统计
+func TestAdmin_PriorityClasses(t *testing.T) {
+	limiter := NewPriorityLimiter(NewFixedWindowCounter(10, time.Minute), testClasses)
+	limiter.AllowContext(WithPriorityClass(context.Background(), "payment"))
+	registry := NewRegistry()
+	registry.Register("callback", limiter)
+
+	var info LimiterInfo
+	if code := doAdmin(t, NewAdminHandler(registry, nil), "GET", "/limiters/callback", "", &info); code != http.StatusOK {
+		t.Fatalf("状态码错误: %d", code)
+	}
+	if len(info.Classes) != 2 || info.Classes[0].Class != "payment" || info.Classes[0].Allowed != 1 {
+		t.Errorf("优先级类别统计错误: %+v", info.Classes)
+	}
+}
@@ -0,0 +1,156 @@
+package limit
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 本文件的基准测试覆盖所有限流器放行请求的路径，基线保存在 testdata/bench/allow.txt
+// 修改热路径后用同样的参数重新运行，用 benchstat 和基线比较：
+//
+//	go test -run '^$' -bench '^BenchmarkAllow' -benchmem -benchtime 200ms -count 6 ./limit > new.txt
+//	benchstat testdata/bench/allow.txt new.txt
+//
+// 只有在同样的硬件上运行的结果才能和基线比较，基线的机器见 testdata/bench/README.md
+// 协程数超过 CPU 核数时多出的协程只能轮流运行，名称中的 procs 是实际并行的核数，procs=1 的结果不包含锁竞争
+
+// benchLimit 足够大的配额，基准测试只覆盖放行的路径
+const benchLimit = 1 << 40
+
+// benchGoroutines 并发的协程数
+var benchGoroutines = []int{1, 4, 16, 64, 256}
+
+// benchKeys 按 key 限流时的 key 数量
+const benchKeys = 1024
+
+// allowFuncs 所有限流器的放行函数，key 限流器固定使用同一个 key
+// Shaper 没有放行函数：Submit 把任务交给执行协程按速率执行，耗时取决于执行协程而不是放行判断，不在这里覆盖
+func allowFuncs(tb testing.TB) map[string]func() bool {
+	keyed := NewKeyedRegistry(func(string) RateLimiter { return NewTokenBucket(benchLimit, benchLimit) })
+	htb := NewHTB(HTBClass{Rate: benchLimit}, []HTBClass{{Rate: benchLimit}, {Rate: benchLimit}})
+	metrics := NewMetrics()
+	scheduled, err := NewScheduledLimiter(NewTokenBucket(benchLimit, benchLimit), time.UTC,
+		Schedule{Name: "default", Limit: benchLimit, Rate: benchLimit}, nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	penalty := NewPenaltyBox(keyed, 100, time.Second, nil)
+	meteredKeyed := metrics.WrapKeyed("bench", keyed)
+	fair := NewFairLimiter(time.Nanosecond, benchKeys)
+	tb.Cleanup(fair.Stop)
+
+	return map[string]func() bool{
+		"FixedWindowCounter":   NewFixedWindowCounter(benchLimit, time.Hour).Allow,
+		"SlidingWindowCounter": NewSlidingWindowCounter(benchLimit, time.Hour, time.Second).Allow,
+		"TokenBucket":          NewTokenBucket(benchLimit, benchLimit).Allow,
+		"WarmUpTokenBucket":    NewWarmUpTokenBucket(1e9, time.Millisecond).Allow,
+		"LeakyBucket":          NewLeakyBucket(benchLimit, time.Nanosecond).Allow,
+		"LeakyBucketPolicer":   NewLeakyBucketPolicer(benchLimit, time.Nanosecond).Allow,
+		"SingleRateMarker":     NewSingleRateMarker(benchLimit, benchLimit, benchLimit).Allow,
+		"TwoRateMarker":        NewTwoRateMarker(benchLimit, benchLimit, benchLimit, benchLimit).Allow,
+		"PriorityLimiter":      NewPriorityLimiter(NewTokenBucket(benchLimit, benchLimit), []PriorityClass{{Name: "batch", Threshold: 0.9}}).Allow,
+		"ScheduledLimiter":     scheduled.Allow,
+		"Chain":                NewChain(NewTokenBucket(benchLimit, benchLimit), NewFixedWindowCounter(benchLimit, time.Hour)).Allow,
+		"RetryBudget":          NewRetryBudget(NewTokenBucket(benchLimit, benchLimit), 0.1).Allow,
+		"ObservedLimiter":      NewObservedLimiter("bench", NewTokenBucket(benchLimit, benchLimit)).Allow,
+		"MeteredLimiter":       metrics.Wrap("bench", NewTokenBucket(benchLimit, benchLimit)).Allow,
+		"KeyedRegistry":        func() bool { return keyed.AllowKey("key") },
+		"HTB":                  func() bool { return htb.Allow("tenant", "user") },
+		"HTBKey":               func() bool { return htb.AllowKey("tenant|user") },
+		"PenaltyBox":           func() bool { return penalty.AllowKey("key") },
+		"MeteredKeyedLimiter":  func() bool { return meteredKeyed.AllowKey("key") },
+		"FairLimiter":          func() bool { return fair.AllowKey("key") },
+	}
+}
+
+// benchProcs goroutines 个协程实际并行的核数
+func benchProcs(goroutines int) int {
+	return min(goroutines, runtime.NumCPU())
+}
+
+// benchName 子基准测试的名称，记录协程数和实际并行的核数
+func benchName(name string, goroutines int) string {
+	return fmt.Sprintf("%s/goroutines=%d/procs=%d", name, goroutines, benchProcs(goroutines))
+}
+
+// runParallel 以 goroutines 个协程并发运行 body
+// RunParallel 启动 GOMAXPROCS*parallelism 个协程，这里同时调整两者使协程数等于 goroutines
+func runParallel(b *testing.B, goroutines int, body func(pb *testing.PB)) {
+	procs := benchProcs(goroutines)
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(procs))
+	b.SetParallelism((goroutines + procs - 1) / procs)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(body)
+}
+
+// BenchmarkAllow 所有协程共享同一个限流器
+func BenchmarkAllow(b *testing.B) {
+	type limiter struct {
+		name  string
+		allow func() bool
+	}
+	var limiters []limiter
+	for name, allow := range allowFuncs(b) {
+		limiters = append(limiters, limiter{name, allow})
+	}
+	// map 的遍历顺序随机，按名称排序使输出稳定
+	sort.Slice(limiters, func(i, j int) bool { return limiters[i].name < limiters[j].name })
+	for _, l := range limiters {
+		for _, g := range benchGoroutines {
+			b.Run(benchName(l.name, g), func(b *testing.B) {
+				runParallel(b, g, func(pb *testing.PB) {
+					for pb.Next() {
+						l.allow()
+					}
+				})
+			})
+		}
+	}
+}
+
+// BenchmarkAllowKey 协程轮流访问 benchKeys 个 key
+func BenchmarkAllowKey(b *testing.B) {
+	keys := make([]string, benchKeys)
+	for i := range keys {
+		keys[i] = "tenant|user:" + strconv.Itoa(i)
+	}
+	metrics := NewMetrics()
+	keyed := func() KeyedLimiter {
+		return NewKeyedRegistry(func(string) RateLimiter { return NewTokenBucket(benchLimit, benchLimit) })
+	}
+	limiters := []struct {
+		name    string
+		limiter func() KeyedLimiter
+	}{
+		{"KeyedRegistry", keyed},
+		{"HTB", func() KeyedLimiter {
+			return NewHTB(HTBClass{Rate: benchLimit}, []HTBClass{{Rate: benchLimit}, {Rate: benchLimit}})
+		}},
+		{"PenaltyBox", func() KeyedLimiter { return NewPenaltyBox(keyed(), 100, time.Second, nil) }},
+		{"MeteredKeyedLimiter", func() KeyedLimiter { return metrics.WrapKeyed("bench", keyed()) }},
+	}
+	for _, l := range limiters {
+		for _, g := range benchGoroutines {
+			b.Run(benchName(l.name, g), func(b *testing.B) {
+				limiter := l.limiter()
+				for _, key := range keys {
+					limiter.AllowKey(key)
+				}
+				var next atomic.Int64
+				runParallel(b, g, func(pb *testing.PB) {
+					i := int(next.Add(1))
+					for pb.Next() {
+						limiter.AllowKey(keys[i%benchKeys])
+						i++
+					}
+				})
+			})
+		}
+	}
+}
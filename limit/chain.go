@@ -0,0 +1,92 @@
+package limit
+
+import "context"
+
+// Chain 按顺序组合多个限流器（或熔断器），全部放行时请求才通过
+// 1. 按顺序检查，遇到第一个拒绝的成员就返回，后面的成员不会被调用
+// 2. 前面的成员放行后已经扣减的配额不会退回，消耗少或不消耗配额的成员应该放在前面
+// 3. MarkSuccess / MarkFailure 转发给实现了这两个方法的成员（如 breaker 包的熔断器），所以限流器和熔断器可以放进同一个中间件
+// 熔断器应该放在最后，避免它放行的探测请求被后面的限流器拒绝
+type Chain struct {
+	limiters []RateLimiter
+}
+
+// NewChain 创建限流器链
+func NewChain(limiters ...RateLimiter) *Chain {
+	return &Chain{limiters: limiters}
+}
+
+// Allow 检查是否允许请求通过
+func (c *Chain) Allow() bool {
+	for _, l := range c.limiters {
+		if !l.Allow() {
+			return false
+		}
+	}
+	return true
+}
+
+// AllowContext 检查是否允许请求通过，成员实现了 AllowContext 时传入 ctx
+func (c *Chain) AllowContext(ctx context.Context) bool {
+	for _, l := range c.limiters {
+		if !AllowContext(ctx, l) {
+			return false
+		}
+	}
+	return true
+}
+
+// MarkSuccess 通知成员请求成功
+func (c *Chain) MarkSuccess() {
+	for _, l := range c.limiters {
+		if m, ok := l.(interface{ MarkSuccess() }); ok {
+			m.MarkSuccess()
+		}
+	}
+}
+
+// MarkFailure 通知成员请求失败
+func (c *Chain) MarkFailure() {
+	for _, l := range c.limiters {
+		if m, ok := l.(interface{ MarkFailure() }); ok {
+			m.MarkFailure()
+		}
+	}
+}
+
+// GetStatus 获取剩余配额比例最小的成员的状态，都无法估算剩余配额时返回第一个成员的状态
+func (c *Chain) GetStatus() (int64, int64) {
+	if len(c.limiters) == 0 {
+		return 0, 0
+	}
+	current, capacity := c.limiters[0].GetStatus()
+	ratio := 2.0
+	for _, l := range c.limiters {
+		cur, capa := l.GetStatus()
+		left, ok := remaining(Algorithm(l), cur, capa)
+		if !ok || capa <= 0 {
+			continue
+		}
+		if r := float64(left) / float64(capa); r < ratio {
+			current, capacity, ratio = cur, capa, r
+		}
+	}
+	return current, capacity
+}
+
+// Limiters 获取链中的成员
+func (c *Chain) Limiters() []RateLimiter {
+	return c.limiters
+}
+
+// Algorithm 获取算法名称
+func (c *Chain) Algorithm() string {
+	return "chain"
+}
+
+// Stop 停止所有成员
+func (c *Chain) Stop() {
+	for _, l := range c.limiters {
+		stopLimiter(l)
+	}
+}
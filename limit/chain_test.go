@@ -0,0 +1,69 @@
+package limit
+
+import (
+	"testing"
+	"time"
+)
+
+// markLimiter 记录 MarkSuccess / MarkFailure 调用次数的限流器
+type markLimiter struct {
+	allow            bool
+	calls            int
+	success, failure int
+}
+
+func (m *markLimiter) Allow() bool               { m.calls++; return m.allow }
+func (m *markLimiter) GetStatus() (int64, int64) { return 0, 0 }
+func (m *markLimiter) MarkSuccess()              { m.success++ }
+func (m *markLimiter) MarkFailure()              { m.failure++ }
+
+// TestChain_Allow 测试全部放行时才通过，遇到拒绝后不再调用后面的成员
+func TestChain_Allow(t *testing.T) {
+	first := NewFixedWindowCounter(2, time.Minute)
+	last := &markLimiter{allow: true}
+	chain := NewChain(first, last)
+
+	if !chain.Allow() || !chain.Allow() {
+		t.Fatal("前2个请求应该通过")
+	}
+	if chain.Allow() {
+		t.Error("第一个成员拒绝后应该拒绝")
+	}
+	if last.calls != 2 {
+		t.Errorf("被拒绝的请求不应该调用后面的成员: %d", last.calls)
+	}
+
+	last.allow = false
+	if NewChain(NewFixedWindowCounter(10, time.Minute), last).Allow() {
+		t.Error("最后一个成员拒绝后应该拒绝")
+	}
+}
+
+// TestChain_Mark 测试 MarkSuccess / MarkFailure 的转发
+func TestChain_Mark(t *testing.T) {
+	m := &markLimiter{allow: true}
+	chain := NewChain(NewTokenBucket(10, 10), m)
+	defer chain.Stop()
+
+	chain.MarkSuccess()
+	chain.MarkFailure()
+	chain.MarkFailure()
+	if m.success != 1 || m.failure != 2 {
+		t.Errorf("转发次数错误: success=%d, failure=%d", m.success, m.failure)
+	}
+	if got := Algorithm(chain); got != "chain" {
+		t.Errorf("算法名称错误: %s", got)
+	}
+}
+
+// TestChain_GetStatus 测试返回剩余配额比例最小的成员的状态
+func TestChain_GetStatus(t *testing.T) {
+	window := NewFixedWindowCounter(10, time.Minute)
+	sliding := NewSlidingWindowCounter(4, time.Minute, time.Second)
+	chain := NewChain(window, sliding)
+	chain.Allow()
+	chain.Allow()
+	if current, capacity := chain.GetStatus(); current != 2 || capacity != 4 {
+		t.Errorf("状态错误: current=%d, capacity=%d", current, capacity)
+	}
+}
@@ -0,0 +1,112 @@
+package limit
+
+import (
+	"context"
+	"time"
+)
+
+// Clock 时钟，限流器通过它获取当前时间和阻塞等待
+// 测试时可以替换为假时钟（见 limittest.FakeClock），不用真实等待就能验证时间相关的行为
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+// realClock 使用系统时间的时钟
+type realClock struct{}
+
+// Now 返回当前时间
+func (realClock) Now() time.Time { return time.Now() }
+
+// Sleep 阻塞 d
+func (realClock) Sleep(d time.Duration) { time.Sleep(d) }
+
+// SystemClock 返回使用系统时间的时钟，供其他包（如 breaker）作为默认时钟
+func SystemClock() Clock { return realClock{} }
+
+// sleepContext 阻塞 d 或直到 ctx 结束
+// 非系统时钟（如假时钟）的 Sleep 不能被中断，在单独的协程中调用
+func sleepContext(ctx context.Context, clock Clock, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	if _, ok := clock.(realClock); ok {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			return nil
+		}
+	}
+	done := make(chan struct{})
+	go func() {
+		clock.Sleep(d)
+		close(done)
+	}()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-done:
+		return nil
+	}
+}
+
+// afterFunc 在 d 之后调用 fn，返回的 stop 取消还没有开始的调用
+// stop 和触发同时发生时 fn 仍然可能被调用，fn 需要自己判断是否过期
+func afterFunc(clock Clock, d time.Duration, fn func()) (stop func()) {
+	if _, ok := clock.(realClock); ok {
+		timer := time.AfterFunc(d, fn)
+		return func() { timer.Stop() }
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		if sleepContext(ctx, clock, d) == nil {
+			fn()
+		}
+	}()
+	return cancel
+}
+
+// Option 限流器的可选配置
+type Option func(*options)
+
+// options 限流器的可选配置项
+type options struct {
+	clock   Clock // 时钟
+	debt    int64 // 令牌桶允许透支的令牌数
+	maxKeys int   // KeyedRegistry 最多保存的 key 数
+}
+
+// WithClock 设置限流器使用的时钟，默认使用系统时间
+func WithClock(clock Clock) Option {
+	return func(o *options) {
+		o.clock = clock
+	}
+}
+
+// WithDebt 开启令牌桶的透支模式，令牌数最多可以透支到 -limit，只对令牌桶生效
+// 透支后的请求会被拒绝，直到欠下的令牌补回来；这样 AllowN(n) 的 n 可以超过桶容量（如大文件上传）
+func WithDebt(limit int64) Option {
+	return func(o *options) {
+		o.debt = max(limit, 0)
+	}
+}
+
+// WithMaxKeys 限制 KeyedRegistry 最多保存的 key 数，达到上限后新 key 的请求全部被拒绝，只对 KeyedRegistry 生效
+// key 来自客户端时用来防止不断变化的 key 耗尽内存，通常和 EvictIdle 一起使用
+func WithMaxKeys(n int) Option {
+	return func(o *options) {
+		o.maxKeys = max(n, 0)
+	}
+}
+
+// newOptions 应用可选配置
+func newOptions(opts []Option) options {
+	o := options{clock: realClock{}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
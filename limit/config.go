@@ -0,0 +1,208 @@
+package limit
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Duration 可以用 "100ms"、"1m" 这样的字符串在 JSON/YAML 中表示的时长
+type Duration time.Duration
+
+// MarshalText 实现 encoding.TextMarshaler
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalText 实现 encoding.TextUnmarshaler
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Config 限流器配置
+// 各算法使用的字段：
+//   - fixed_window: Limit、Window
+//   - sliding_window: Limit、Window、Precision（默认为 Window/10）
+//   - token_bucket: Limit（桶容量）、Rate、Debt（可选的透支上限）
+//   - warmup_token_bucket: Rate、WarmUp
+//   - leaky_bucket: Limit（桶容量）、Interval
+type Config struct {
+	Algorithm string   `json:"algorithm" yaml:"algorithm"`                     // 限流算法
+	Limit     int64    `json:"limit,omitempty" yaml:"limit,omitempty"`         // 窗口内的请求数 / 桶容量
+	Window    Duration `json:"window,omitempty" yaml:"window,omitempty"`       // 时间窗口
+	Precision Duration `json:"precision,omitempty" yaml:"precision,omitempty"` // 滑动窗口的子窗口大小
+	Rate      int64    `json:"rate,omitempty" yaml:"rate,omitempty"`           // 每秒补充的令牌数
+	Interval  Duration `json:"interval,omitempty" yaml:"interval,omitempty"`   // 漏桶每个请求的漏出间隔
+	WarmUp    Duration `json:"warmup,omitempty" yaml:"warmup,omitempty"`       // 预热时长
+	Debt      int64    `json:"debt,omitempty" yaml:"debt,omitempty"`           // 令牌桶允许透支的令牌数
+}
+
+// Validate 校验配置
+func (c Config) Validate() error {
+	switch c.Algorithm {
+	case "fixed_window", "sliding_window":
+		if c.Limit < 0 {
+			return errors.New("limit: limit must not be negative")
+		}
+		if c.Window <= 0 {
+			return fmt.Errorf("limit: %s requires a positive window", c.Algorithm)
+		}
+		if c.Precision < 0 {
+			return errors.New("limit: precision must not be negative")
+		}
+	case "token_bucket":
+		if c.Limit < 0 {
+			return errors.New("limit: limit must not be negative")
+		}
+		if c.Rate <= 0 {
+			return errors.New("limit: token_bucket requires a positive rate")
+		}
+		if c.Debt < 0 {
+			return errors.New("limit: debt must not be negative")
+		}
+	case "warmup_token_bucket":
+		if c.Rate <= 0 {
+			return errors.New("limit: warmup_token_bucket requires a positive rate")
+		}
+		if c.WarmUp <= 0 {
+			return errors.New("limit: warmup_token_bucket requires a positive warmup")
+		}
+	case "leaky_bucket":
+		if c.Limit < 0 {
+			return errors.New("limit: limit must not be negative")
+		}
+		if c.Interval <= 0 {
+			return errors.New("limit: leaky_bucket requires a positive interval")
+		}
+	case "":
+		return errors.New("limit: algorithm is required")
+	default:
+		return fmt.Errorf("limit: unknown algorithm %q", c.Algorithm)
+	}
+	return nil
+}
+
+// precision 滑动窗口的子窗口大小
+func (c Config) precision() time.Duration {
+	if c.Precision > 0 {
+		return time.Duration(c.Precision)
+	}
+	return time.Duration(c.Window) / 10
+}
+
+// NewFromConfig 根据配置创建限流器，opts 传给对应算法的构造函数（如 WithClock）
+func NewFromConfig(c Config, opts ...Option) (RateLimiter, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	switch c.Algorithm {
+	case "fixed_window":
+		return NewFixedWindowCounter(c.Limit, time.Duration(c.Window), opts...), nil
+	case "sliding_window":
+		return NewSlidingWindowCounter(c.Limit, time.Duration(c.Window), c.precision(), opts...), nil
+	case "token_bucket":
+		return NewTokenBucket(c.Limit, c.Rate, append([]Option{WithDebt(c.Debt)}, opts...)...), nil
+	case "warmup_token_bucket":
+		return NewWarmUpTokenBucket(c.Rate, time.Duration(c.WarmUp), opts...), nil
+	default:
+		return NewLeakyBucket(c.Limit, time.Duration(c.Interval), opts...), nil
+	}
+}
+
+// ConfigOf 获取限流器当前的配置，会穿透 Unwrap() 包装
+func ConfigOf(l RateLimiter) (Config, bool) {
+	switch l := unwrapLimiter(l).(type) {
+	case *FixedWindowCounter:
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		return Config{Algorithm: "fixed_window", Limit: l.limit, Window: Duration(l.window)}, true
+	case *SlidingWindowCounter:
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		return Config{Algorithm: "sliding_window", Limit: l.limit, Window: Duration(l.window), Precision: Duration(l.precision)}, true
+	case *TokenBucket:
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		return Config{Algorithm: "token_bucket", Limit: l.capacity, Rate: l.refillRate, Debt: l.debtLimit}, true
+	case *WarmUpTokenBucket:
+		return Config{Algorithm: "warmup_token_bucket", Rate: l.rate, WarmUp: Duration(l.warmupPeriod)}, true
+	case *LeakyBucket:
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		return Config{Algorithm: "leaky_bucket", Limit: l.capacity, Interval: Duration(l.rate)}, true
+	default:
+		return Config{}, false
+	}
+}
+
+// Reconfigure 在运行时调整限流器的参数，不重置已有状态，会穿透 Unwrap() 包装
+// 算法不能改变；预热令牌桶不支持调整
+func Reconfigure(l RateLimiter, c Config) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	inner := unwrapLimiter(l)
+	if algorithm := Algorithm(inner); algorithm != c.Algorithm {
+		return fmt.Errorf("limit: cannot change algorithm from %s to %s", algorithm, c.Algorithm)
+	}
+	switch inner := inner.(type) {
+	case *FixedWindowCounter:
+		inner.SetLimit(c.Limit, time.Duration(c.Window))
+	case *SlidingWindowCounter:
+		inner.SetLimit(c.Limit, time.Duration(c.Window))
+	case *TokenBucket:
+		inner.SetRate(c.Limit, c.Rate)
+		inner.SetDebtLimit(c.Debt)
+	case *LeakyBucket:
+		inner.SetRate(c.Limit, time.Duration(c.Interval))
+	default:
+		return fmt.Errorf("limit: %s cannot be reconfigured", c.Algorithm)
+	}
+	return nil
+}
+
+// unwrapLimiter 穿透包装，获取最内层的限流器
+func unwrapLimiter(l RateLimiter) RateLimiter {
+	for {
+		u, ok := l.(interface{ Unwrap() RateLimiter })
+		if !ok {
+			return l
+		}
+		l = u.Unwrap()
+	}
+}
+
+// findLimiter 沿 Unwrap() 链查找实现了 T 的限流器
+func findLimiter[T any](l RateLimiter) (T, bool) {
+	for {
+		if t, ok := l.(T); ok {
+			return t, true
+		}
+		u, ok := l.(interface{ Unwrap() RateLimiter })
+		if !ok {
+			var zero T
+			return zero, false
+		}
+		l = u.Unwrap()
+	}
+}
+
+// findKeyed 沿 Unwrap() 链查找实现了 T 的 key 限流器
+func findKeyed[T any](l KeyedLimiter) (T, bool) {
+	for {
+		if t, ok := l.(T); ok {
+			return t, true
+		}
+		u, ok := l.(interface{ Unwrap() KeyedLimiter })
+		if !ok {
+			var zero T
+			return zero, false
+		}
+		l = u.Unwrap()
+	}
+}
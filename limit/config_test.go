@@ -0,0 +1,142 @@
+package limit
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TestConfig_Decode 测试从 JSON/YAML 解析配置
+func TestConfig_Decode(t *testing.T) {
+	var fromJSON Config
+	if err := json.Unmarshal([]byte(`{"algorithm":"sliding_window","limit":100,"window":"1m","precision":"1s"}`), &fromJSON); err != nil {
+		t.Fatal(err)
+	}
+	var fromYAML Config
+	if err := yaml.Unmarshal([]byte("algorithm: sliding_window\nlimit: 100\nwindow: 1m\nprecision: 1s\n"), &fromYAML); err != nil {
+		t.Fatal(err)
+	}
+	want := Config{Algorithm: "sliding_window", Limit: 100, Window: Duration(time.Minute), Precision: Duration(time.Second)}
+	if fromJSON != want || fromYAML != want {
+		t.Errorf("解析结果错误: json=%+v, yaml=%+v", fromJSON, fromYAML)
+	}
+
+	out, _ := json.Marshal(Config{Algorithm: "leaky_bucket", Limit: 5, Interval: Duration(100 * time.Millisecond)})
+	if string(out) != `{"algorithm":"leaky_bucket","limit":5,"interval":"100ms"}` {
+		t.Errorf("序列化结果错误: %s", out)
+	}
+}
+
+// TestConfig_Validate 测试配置校验
+func TestConfig_Validate(t *testing.T) {
+	invalid := []Config{
+		{},
+		{Algorithm: "gcra"},
+		{Algorithm: "fixed_window", Limit: 10},
+		{Algorithm: "token_bucket", Limit: 10},
+		{Algorithm: "leaky_bucket", Limit: 10},
+		{Algorithm: "warmup_token_bucket", Rate: 10},
+		{Algorithm: "sliding_window", Limit: -1, Window: Duration(time.Second)},
+	}
+	for _, c := range invalid {
+		if err := c.Validate(); err == nil {
+			t.Errorf("%+v 应该校验失败", c)
+		}
+	}
+}
+
+// TestNewFromConfig 测试根据配置创建限流器并读回配置
+func TestNewFromConfig(t *testing.T) {
+	configs := []Config{
+		{Algorithm: "fixed_window", Limit: 10, Window: Duration(time.Second)},
+		{Algorithm: "sliding_window", Limit: 10, Window: Duration(time.Second), Precision: Duration(100 * time.Millisecond)},
+		{Algorithm: "token_bucket", Limit: 10, Rate: 5},
+		{Algorithm: "warmup_token_bucket", Rate: 5, WarmUp: Duration(time.Second)},
+		{Algorithm: "leaky_bucket", Limit: 10, Interval: Duration(100 * time.Millisecond)},
+	}
+	for _, c := range configs {
+		limiter, err := NewFromConfig(c)
+		if err != nil {
+			t.Fatalf("%s: %v", c.Algorithm, err)
+		}
+		if Algorithm(limiter) != c.Algorithm {
+			t.Errorf("算法错误: %s, 期望 %s", Algorithm(limiter), c.Algorithm)
+		}
+		if got, ok := ConfigOf(limiter); !ok || got != c {
+			t.Errorf("读回的配置错误: %+v, 期望 %+v", got, c)
+		}
+		stopLimiter(limiter)
+	}
+}
+
+// TestReconfigure 测试运行时调整参数
+func TestReconfigure(t *testing.T) {
+	observed := NewObservedLimiter("reply", NewFixedWindowCounter(1, time.Second))
+	observed.Allow()
+
+	// 穿透包装调整内部的固定窗口
+	if err := Reconfigure(observed, Config{Algorithm: "fixed_window", Limit: 2, Window: Duration(time.Second)}); err != nil {
+		t.Fatal(err)
+	}
+	if !observed.Allow() {
+		t.Error("提高限制后请求应该通过")
+	}
+	if current, limit := observed.GetStatus(); current != 2 || limit != 2 {
+		t.Errorf("调整后状态错误: current=%d, limit=%d", current, limit)
+	}
+
+	if err := Reconfigure(observed, Config{Algorithm: "token_bucket", Limit: 2, Rate: 1}); err == nil {
+		t.Error("不能修改算法")
+	}
+	if err := Reconfigure(NewWarmUpTokenBucket(1, time.Second), Config{Algorithm: "warmup_token_bucket", Rate: 2, WarmUp: Duration(time.Second)}); err == nil {
+		t.Error("预热令牌桶不支持调整")
+	}
+}
+
+// TestKeyedRegistry_SetConfig 测试按配置创建的 key 限流器调整参数
+func TestKeyedRegistry_SetConfig(t *testing.T) {
+	registry, err := NewKeyedRegistryFromConfig(Config{Algorithm: "fixed_window", Limit: 1, Window: Duration(time.Second)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer registry.Stop()
+
+	registry.AllowKey("a")
+	if registry.AllowKey("a") {
+		t.Error("第2个请求应该被拒绝")
+	}
+	if err := registry.SetConfig(Config{Algorithm: "fixed_window", Limit: 3, Window: Duration(time.Second)}); err != nil {
+		t.Fatal(err)
+	}
+	// 已有 key 原地调整，新 key 使用新配置
+	if !registry.AllowKey("a") {
+		t.Error("已有 key 提高限制后请求应该通过")
+	}
+	if _, limit := registry.GetKeyStatus("b"); limit != 3 {
+		t.Errorf("新 key 应该使用新配置: %d", limit)
+	}
+	if err := registry.SetConfig(Config{Algorithm: "token_bucket", Limit: 3, Rate: 1}); err == nil {
+		t.Error("不能修改算法")
+	}
+	if registry.Algorithm() != "fixed_window" {
+		t.Errorf("算法名称错误: %s", registry.Algorithm())
+	}
+}
+
+// TestNewFromConfig_Options 测试选项传给限流器的构造函数
+func TestNewFromConfig_Options(t *testing.T) {
+	clock := newManualClock()
+	limiter, err := NewFromConfig(Config{Algorithm: "fixed_window", Limit: 1, Window: Duration(time.Minute)}, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !limiter.Allow() || limiter.Allow() {
+		t.Fatal("窗口内只允许1个请求")
+	}
+	clock.Sleep(time.Minute)
+	if !limiter.Allow() {
+		t.Error("应该使用传入的时钟")
+	}
+}
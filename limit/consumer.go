@@ -0,0 +1,449 @@
+package limit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// TopicPartition 消息所在的分区
+type TopicPartition struct {
+	Topic     string // 主题
+	Partition int32  // 分区号
+}
+
+// String 格式为 topic/partition
+func (tp TopicPartition) String() string {
+	return fmt.Sprintf("%s/%d", tp.Topic, tp.Partition)
+}
+
+// Message 消费者拉取到的一条消息
+type Message struct {
+	TopicPartition
+	Offset int64  // 分区内的偏移量
+	Key    string // 消息 key
+	Value  []byte // 消息内容
+}
+
+// Broker 消费者依赖的消息队列客户端，对应 Kafka 等客户端拉取循环的最小子集
+type Broker interface {
+	// Poll 拉取一批消息，没有消息时阻塞直到有消息或 ctx 结束；不会返回已暂停分区的消息
+	Poll(ctx context.Context) ([]Message, error)
+	// Pause 暂停分区的拉取，已经拉取到的消息不受影响
+	Pause(partitions ...TopicPartition)
+	// Resume 恢复分区的拉取
+	Resume(partitions ...TopicPartition)
+}
+
+// 分区暂停的原因
+const (
+	PauseBacklog = "backlog" // 分区积压的消息超过高水位
+	PauseStarved = "starved" // 限流器等待时间过长，处理速度跟不上
+)
+
+// FlowEvent 分区暂停或恢复的事件
+type FlowEvent struct {
+	Partition TopicPartition // 分区
+	Paused    bool           // true 为暂停，false 为恢复
+	Reason    string         // 暂停或恢复的原因，PauseBacklog 或 PauseStarved
+	Backlog   int            // 事件发生时分区积压的消息数
+}
+
+// ConsumerStats 消费者的统计
+type ConsumerStats struct {
+	Processed int64 `json:"processed"` // 处理完的消息数
+	Backlog   int   `json:"backlog"`   // 已经拉取、等待处理的消息数
+	Paused    int   `json:"paused"`    // 当前暂停的分区数
+	Pauses    int64 `json:"pauses"`    // 暂停分区的次数
+	Resumes   int64 `json:"resumes"`   // 恢复分区的次数
+	Starved   bool  `json:"starved"`   // 限流器是否处于饥饿状态
+}
+
+// ConsumerOption Consumer 的可选配置
+type ConsumerOption func(*Consumer)
+
+// WithFairnessKey 设置公平调度的维度，默认按分区轮转，例如按消息 key 轮转：
+//
+//	WithFairnessKey(func(m Message) string { return m.Key })
+func WithFairnessKey(fn func(m Message) string) ConsumerOption {
+	return func(c *Consumer) {
+		c.keyFunc = fn
+	}
+}
+
+// WithBacklog 设置分区积压的水位，积压达到 high 时暂停分区，降到 low 及以下时恢复，默认 100、10
+func WithBacklog(high, low int) ConsumerOption {
+	return func(c *Consumer) {
+		c.highWater = max(high, 1)
+		c.lowWater = min(max(low, 0), c.highWater-1)
+	}
+}
+
+// WithStarvation 设置一次 Wait 超过多久算作限流器饥饿，饥饿时暂停所有积压的分区，默认 1s
+// Wait 阻塞到该时长时立即进入饥饿状态，不用等 Wait 返回
+func WithStarvation(d time.Duration) ConsumerOption {
+	return func(c *Consumer) {
+		c.starveAfter = d
+	}
+}
+
+// WithFlowHook 设置分区暂停或恢复时的回调
+// 回调和 Broker.Pause / Resume 一样在释放锁之后按事件发生的顺序串行调用，可以调用 Stats、Paused
+func WithFlowHook(fn func(FlowEvent)) ConsumerOption {
+	return func(c *Consumer) {
+		c.hook = fn
+	}
+}
+
+// WithConsumerClock 设置 Consumer 计算等待时长和饥饿计时使用的时钟，默认使用系统时间
+func WithConsumerClock(clock Clock) ConsumerOption {
+	return func(c *Consumer) {
+		c.clock = clock
+	}
+}
+
+// Consumer 消息消费者的限流适配器
+// 1. 处理每条消息前调用 Wait 等待限流器放行，限流时消息排队而不是被拒绝
+// 2. 已拉取的消息按分区（或 WithFairnessKey 指定的维度）轮转处理，积压多的分区不会饿死其他分区，同一分区内保持顺序
+// 3. 分区积压超过高水位，或者限流器饥饿（一次 Wait 超过 WithStarvation）时通过 Broker.Pause 暂停拉取，恢复后 Resume
+//
+// 暂停和恢复先在锁内记录为事件，释放锁后再调用 Broker 和回调，Broker 阻塞时不会卡住拉取和处理循环
+type Consumer struct {
+	broker      Broker                                     // 消息队列客户端
+	limiter     RateLimiter                                // 限流器
+	handler     func(ctx context.Context, m Message) error // 消息处理函数
+	keyFunc     func(m Message) string                     // 公平调度的维度
+	highWater   int                                        // 暂停分区的积压数
+	lowWater    int                                        // 恢复分区的积压数
+	starveAfter time.Duration                              // Wait 超过该时长算作饥饿
+	hook        func(FlowEvent)                            // 暂停或恢复时的回调
+	clock       Clock                                      // 时钟
+
+	queues    map[string][]Message               // 公平调度维度到排队消息的映射
+	order     []string                           // 有排队消息的维度，按轮转顺序
+	next      int                                // 下一个轮转到的维度下标
+	backlog   map[TopicPartition]int             // 分区积压的消息数
+	paused    map[TopicPartition]map[string]bool // 分区暂停的原因
+	pending   int                                // 排队消息总数
+	starved   bool                               // 限流器是否处于饥饿状态
+	waits     uint64                             // Wait 的次数，用于识别过期的饥饿计时
+	waiting   bool                               // 是否正在 Wait
+	events    []FlowEvent                        // 还没有通知 Broker 和回调的暂停、恢复事件
+	processed int64                              // 处理完的消息数
+	pauses    int64                              // 暂停分区的次数
+	resumes   int64                              // 恢复分区的次数
+	notify    chan struct{}                      // 有新消息入队的通知
+	mutex     sync.Mutex                         // 互斥锁
+	flowMutex sync.Mutex                         // 保证事件按顺序通知
+}
+
+// NewConsumer 创建消费者
+// limiter: 处理消息的限流器，通过 Wait 等待放行
+// handler: 消息处理函数，返回错误时 Run 停止并返回该错误，可以重试的错误应该在 handler 内部处理（如使用 Retrier）
+func NewConsumer(broker Broker, limiter RateLimiter, handler func(ctx context.Context, m Message) error, opts ...ConsumerOption) *Consumer {
+	c := &Consumer{
+		broker:      broker,
+		limiter:     limiter,
+		handler:     handler,
+		keyFunc:     func(m Message) string { return m.TopicPartition.String() },
+		highWater:   100,
+		lowWater:    10,
+		starveAfter: time.Second,
+		clock:       realClock{},
+		queues:      make(map[string][]Message),
+		backlog:     make(map[TopicPartition]int),
+		paused:      make(map[TopicPartition]map[string]bool),
+		notify:      make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Run 运行拉取和处理循环，直到 ctx 结束、Poll 返回错误或 handler 返回错误
+// ctx 结束时返回 ctx.Err()，已经拉取但没有处理的消息会被丢弃，由消息队列重新投递
+func (c *Consumer) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.poll(ctx)
+		cancel()
+	}()
+	err := c.process(ctx)
+	cancel()
+	// Poll 出错时处理循环也会因为 ctx 取消而返回，此时返回 Poll 的错误
+	if pollErr := <-errCh; pollErr != nil {
+		return pollErr
+	}
+	return err
+}
+
+// poll 拉取循环，ctx 结束时返回 nil
+func (c *Consumer) poll(ctx context.Context) error {
+	for {
+		msgs, err := c.broker.Poll(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(msgs) == 0 {
+			continue
+		}
+		c.enqueue(msgs)
+		c.flush()
+		select {
+		case c.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// enqueue 消息入队，积压超过高水位的分区暂停拉取
+func (c *Consumer) enqueue(msgs []Message) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, m := range msgs {
+		key := c.keyFunc(m)
+		if len(c.queues[key]) == 0 {
+			c.order = append(c.order, key)
+		}
+		c.queues[key] = append(c.queues[key], m)
+		c.pending++
+		c.backlog[m.TopicPartition]++
+	}
+	for _, m := range msgs {
+		if c.backlog[m.TopicPartition] >= c.highWater {
+			c.pause(m.TopicPartition, PauseBacklog)
+		}
+	}
+	if c.starved {
+		// 饥饿期间新出现积压的分区同样暂停
+		for _, m := range msgs {
+			c.pause(m.TopicPartition, PauseStarved)
+		}
+	}
+}
+
+// dequeue 按轮转顺序取出下一条消息
+func (c *Consumer) dequeue() (Message, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if len(c.order) == 0 {
+		return Message{}, false
+	}
+	if c.next >= len(c.order) {
+		c.next = 0
+	}
+	key := c.order[c.next]
+	queue := c.queues[key]
+	m := queue[0]
+	queue[0] = Message{}
+	if len(queue) == 1 {
+		delete(c.queues, key)
+		c.order = append(c.order[:c.next], c.order[c.next+1:]...)
+	} else {
+		c.queues[key] = queue[1:]
+		c.next++
+	}
+	c.pending--
+	return m, true
+}
+
+// process 处理循环
+func (c *Consumer) process(ctx context.Context) error {
+	for {
+		m, ok := c.dequeue()
+		if !ok {
+			select {
+			case <-c.notify:
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		if err := c.wait(ctx); err != nil {
+			return err
+		}
+		if err := c.handler(ctx, m); err != nil {
+			return fmt.Errorf("limit: handle %s@%d: %w", m.TopicPartition, m.Offset, err)
+		}
+		c.done(m)
+		c.flush()
+	}
+}
+
+// wait 等待限流器放行，同时计时，Wait 阻塞超过 starveAfter 时立即进入饥饿状态
+func (c *Consumer) wait(ctx context.Context) error {
+	c.mutex.Lock()
+	c.waits++
+	c.waiting = true
+	seq := c.waits
+	c.mutex.Unlock()
+
+	start := c.clock.Now()
+	stop := afterFunc(c.clock, c.starveAfter, func() {
+		c.mutex.Lock()
+		// 计时器可能在 Wait 返回之后才触发
+		if c.waiting && c.waits == seq {
+			c.starve()
+		}
+		c.mutex.Unlock()
+		c.flush()
+	})
+	err := Wait(ctx, c.limiter)
+	stop()
+	if err != nil {
+		return err
+	}
+	c.observeWait(c.clock.Now().Sub(start))
+	c.flush()
+	return nil
+}
+
+// observeWait Wait 返回后根据等待时长进入或退出饥饿状态
+func (c *Consumer) observeWait(waited time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.waiting = false
+	if waited >= c.starveAfter {
+		c.starve()
+		return
+	}
+	if c.starved {
+		c.endStarvation()
+	}
+}
+
+// starve 进入饥饿状态，暂停所有积压的分区，调用方需持有锁
+func (c *Consumer) starve() {
+	if c.starved {
+		return
+	}
+	c.starved = true
+	for tp, n := range c.backlog {
+		if n > 0 {
+			c.pause(tp, PauseStarved)
+		}
+	}
+}
+
+// endStarvation 退出饥饿状态，恢复因为饥饿暂停的分区，调用方需持有锁
+func (c *Consumer) endStarvation() {
+	c.starved = false
+	for tp := range c.paused {
+		c.resume(tp, PauseStarved)
+	}
+}
+
+// done 消息处理完成，积压降到低水位的分区恢复拉取
+func (c *Consumer) done(m Message) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.processed++
+	tp := m.TopicPartition
+	c.backlog[tp]--
+	if c.backlog[tp] <= c.lowWater {
+		c.resume(tp, PauseBacklog)
+	}
+	if c.backlog[tp] == 0 {
+		delete(c.backlog, tp)
+	}
+	// 积压处理完时不再等待限流器，退出饥饿状态，否则暂停的分区永远不会恢复
+	if c.pending == 0 && c.starved {
+		c.endStarvation()
+	}
+}
+
+// pause 以 reason 暂停分区，分区从运行变为暂停时记录暂停事件，调用方需持有锁
+func (c *Consumer) pause(tp TopicPartition, reason string) {
+	reasons := c.paused[tp]
+	if reasons[reason] {
+		return
+	}
+	if reasons == nil {
+		reasons = make(map[string]bool)
+		c.paused[tp] = reasons
+	}
+	reasons[reason] = true
+	if len(reasons) > 1 {
+		return
+	}
+	c.pauses++
+	c.events = append(c.events, FlowEvent{Partition: tp, Paused: true, Reason: reason, Backlog: c.backlog[tp]})
+}
+
+// resume 撤销分区因为 reason 的暂停，没有其他暂停原因时记录恢复事件，调用方需持有锁
+func (c *Consumer) resume(tp TopicPartition, reason string) {
+	reasons := c.paused[tp]
+	if !reasons[reason] {
+		return
+	}
+	delete(reasons, reason)
+	if len(reasons) > 0 {
+		return
+	}
+	delete(c.paused, tp)
+	c.resumes++
+	c.events = append(c.events, FlowEvent{Partition: tp, Paused: false, Reason: reason, Backlog: c.backlog[tp]})
+}
+
+// flush 在锁外按顺序调用 Broker.Pause / Resume 和回调
+// 事件在锁内按发生顺序追加，flowMutex 保证多个协程同时 flush 时 Broker 收到的调用顺序不变
+func (c *Consumer) flush() {
+	c.flowMutex.Lock()
+	defer c.flowMutex.Unlock()
+
+	c.mutex.Lock()
+	events := c.events
+	c.events = nil
+	c.mutex.Unlock()
+	for _, e := range events {
+		if e.Paused {
+			c.broker.Pause(e.Partition)
+		} else {
+			c.broker.Resume(e.Partition)
+		}
+		if c.hook != nil {
+			c.hook(e)
+		}
+	}
+}
+
+// Paused 获取当前暂停的分区及原因
+func (c *Consumer) Paused() map[TopicPartition][]string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	paused := make(map[TopicPartition][]string, len(c.paused))
+	for tp, reasons := range c.paused {
+		for reason := range reasons {
+			paused[tp] = append(paused[tp], reason)
+		}
+	}
+	return paused
+}
+
+// Stats 获取消费者的统计
+func (c *Consumer) Stats() ConsumerStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return ConsumerStats{
+		Processed: c.processed,
+		Backlog:   c.pending,
+		Paused:    len(c.paused),
+		Pauses:    c.pauses,
+		Resumes:   c.resumes,
+		Starved:   c.starved,
+	}
+}
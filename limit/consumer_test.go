@@ -0,0 +1,318 @@
+package limit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeBroker 内存中的消息队列，实现 Broker
+type fakeBroker struct {
+	batch      int                          // 每次 Poll 最多返回的消息数
+	partitions []TopicPartition             // 分区，按拉取顺序
+	messages   map[TopicPartition][]Message // 分区中还没有拉取的消息
+	paused     map[TopicPartition]bool      // 暂停的分区
+	calls      []string                     // Pause / Resume 的调用记录
+	err        error                        // Poll 返回的错误
+	mutex      sync.Mutex
+}
+
+// newFakeBroker 创建内存消息队列，counts 为每个分区的消息数
+func newFakeBroker(batch int, counts ...int) *fakeBroker {
+	b := &fakeBroker{
+		batch:    batch,
+		messages: make(map[TopicPartition][]Message),
+		paused:   make(map[TopicPartition]bool),
+	}
+	for p, n := range counts {
+		tp := TopicPartition{Topic: "orders", Partition: int32(p)}
+		b.partitions = append(b.partitions, tp)
+		for offset := 0; offset < n; offset++ {
+			b.messages[tp] = append(b.messages[tp], Message{TopicPartition: tp, Offset: int64(offset)})
+		}
+	}
+	return b
+}
+
+func (b *fakeBroker) Poll(ctx context.Context) ([]Message, error) {
+	for {
+		b.mutex.Lock()
+		if b.err != nil {
+			b.mutex.Unlock()
+			return nil, b.err
+		}
+		var msgs []Message
+		for _, tp := range b.partitions {
+			if b.paused[tp] {
+				continue
+			}
+			n := min(b.batch-len(msgs), len(b.messages[tp]))
+			msgs = append(msgs, b.messages[tp][:n]...)
+			b.messages[tp] = b.messages[tp][n:]
+		}
+		b.mutex.Unlock()
+		if len(msgs) > 0 {
+			return msgs, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func (b *fakeBroker) Pause(partitions ...TopicPartition) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for _, tp := range partitions {
+		b.paused[tp] = true
+		b.calls = append(b.calls, "pause "+tp.String())
+	}
+}
+
+func (b *fakeBroker) Resume(partitions ...TopicPartition) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for _, tp := range partitions {
+		delete(b.paused, tp)
+		b.calls = append(b.calls, "resume "+tp.String())
+	}
+}
+
+// runConsumer 运行消费者直到处理完 total 条消息，返回处理顺序
+func runConsumer(t *testing.T, broker Broker, limiter RateLimiter, total int, opts ...ConsumerOption) (*Consumer, []Message) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var handled []Message
+	c := NewConsumer(broker, limiter, func(ctx context.Context, m Message) error {
+		handled = append(handled, m)
+		if len(handled) == total {
+			cancel()
+		}
+		return nil
+	}, opts...)
+	if err := c.Run(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("处理完所有消息前退出: %v, 已处理%d条", err, len(handled))
+	}
+	return c, handled
+}
+
+// TestConsumer_Fairness 测试按分区轮转处理，同一分区内保持顺序
+func TestConsumer_Fairness(t *testing.T) {
+	broker := newFakeBroker(100, 20, 3)
+	_, handled := runConsumer(t, broker, NewTokenBucket(1, 1000), 23)
+
+	var small int
+	for _, m := range handled[:6] {
+		if m.Partition == 1 {
+			small++
+		}
+	}
+	if small != 3 {
+		t.Errorf("消息少的分区不应该排在积压的分区后面: %v", handled[:6])
+	}
+	last := map[int32]int64{0: -1, 1: -1}
+	for _, m := range handled {
+		if m.Offset <= last[m.Partition] {
+			t.Fatalf("分区内的顺序错误: %v", handled)
+		}
+		last[m.Partition] = m.Offset
+	}
+}
+
+// TestConsumer_FairnessKey 测试按消息 key 轮转
+func TestConsumer_FairnessKey(t *testing.T) {
+	broker := newFakeBroker(100, 6)
+	tp := broker.partitions[0]
+	for i := range broker.messages[tp] {
+		broker.messages[tp][i].Key = "tenant:a"
+	}
+	broker.messages[tp][5].Key = "tenant:b"
+
+	_, handled := runConsumer(t, broker, NewTokenBucket(1, 1000), 6,
+		WithFairnessKey(func(m Message) string { return m.Key }))
+	if handled[1].Key != "tenant:b" {
+		t.Errorf("第二条消息应该轮转到 tenant:b: %v", handled)
+	}
+}
+
+// TestConsumer_Backlog 测试积压超过高水位时暂停分区，降到低水位后恢复
+func TestConsumer_Backlog(t *testing.T) {
+	broker := newFakeBroker(10, 40)
+	var events []FlowEvent
+	c, handled := runConsumer(t, broker, NewTokenBucket(1, 500), 40,
+		WithBacklog(15, 5), WithFlowHook(func(e FlowEvent) { events = append(events, e) }))
+
+	for i, m := range handled {
+		if m.Offset != int64(i) {
+			t.Fatalf("消息的顺序错误: %v", handled)
+		}
+	}
+	if len(events) < 2 || !events[0].Paused || events[0].Reason != PauseBacklog || events[0].Backlog < 15 ||
+		events[1].Paused || events[1].Backlog > 5 {
+		t.Errorf("暂停和恢复的事件错误: %+v", events)
+	}
+	if len(broker.calls) < 2 || broker.calls[0] != "pause orders/0" || broker.calls[1] != "resume orders/0" {
+		t.Errorf("Broker 的调用错误: %v", broker.calls)
+	}
+	if s := c.Stats(); s.Processed != 40 || s.Pauses != s.Resumes || s.Paused != 0 {
+		t.Errorf("统计错误: %+v", s)
+	}
+}
+
+// stepClock 测试用的时钟，Sleep 阻塞到 Advance 把时间拨过截止时间
+type stepClock struct {
+	now      time.Time
+	waiters  map[chan struct{}]time.Time // 阻塞中的 Sleep 到截止时间的映射
+	sleeping chan struct{}               // 每次 Sleep 开始阻塞时发送一个信号
+	mutex    sync.Mutex
+}
+
+func newStepClock() *stepClock {
+	return &stepClock{
+		now:      time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		waiters:  make(map[chan struct{}]time.Time),
+		sleeping: make(chan struct{}, 64),
+	}
+}
+
+func (c *stepClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *stepClock) Sleep(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	c.mutex.Lock()
+	ch := make(chan struct{})
+	c.waiters[ch] = c.now.Add(d)
+	c.mutex.Unlock()
+	c.sleeping <- struct{}{}
+	<-ch
+}
+
+// Advance 把时间拨快 d，唤醒到期的 Sleep
+func (c *stepClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+	for ch, deadline := range c.waiters {
+		if !deadline.After(c.now) {
+			close(ch)
+			delete(c.waiters, ch)
+		}
+	}
+}
+
+// gateLimiter 每次 Wait 阻塞到测试放入一个令牌
+type gateLimiter struct {
+	gate chan struct{}
+}
+
+func (g *gateLimiter) Allow() bool {
+	select {
+	case <-g.gate:
+		return true
+	default:
+		return false
+	}
+}
+
+func (g *gateLimiter) Wait(ctx context.Context) error {
+	select {
+	case <-g.gate:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (g *gateLimiter) GetStatus() (int64, int64) {
+	return int64(len(g.gate)), int64(cap(g.gate))
+}
+
+// TestConsumer_Starvation 测试 Wait 阻塞超过饥饿时长时立即暂停分区，积压处理完后恢复
+func TestConsumer_Starvation(t *testing.T) {
+	broker := newFakeBroker(100, 5, 1)
+	clock := newStepClock()
+	t.Cleanup(func() { clock.Advance(time.Hour) })
+	limiter := &gateLimiter{gate: make(chan struct{}, 6)}
+	events := make(chan FlowEvent, 16)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var handled int
+	c := NewConsumer(broker, limiter, func(ctx context.Context, m Message) error {
+		if handled++; handled == 6 {
+			cancel()
+		}
+		return nil
+	}, WithStarvation(time.Second), WithConsumerClock(clock), WithFlowHook(func(e FlowEvent) { events <- e }))
+	errCh := make(chan error, 1)
+	go func() { errCh <- c.Run(ctx) }()
+
+	// 第1条消息的 Wait 开始计时，时间到了 Wait 还没有返回
+	<-clock.sleeping
+	clock.Advance(time.Second)
+	for i := 0; i < 2; i++ {
+		if e := <-events; !e.Paused || e.Reason != PauseStarved {
+			t.Fatalf("饥饿时应该暂停分区: %+v", e)
+		}
+	}
+	if s := c.Stats(); !s.Starved || s.Processed != 0 || s.Paused != 2 {
+		t.Errorf("Wait 返回前就应该进入饥饿状态: %+v", s)
+	}
+	broker.mutex.Lock()
+	calls := len(broker.calls)
+	broker.mutex.Unlock()
+	if calls != 2 {
+		t.Errorf("Broker.Pause 应该被调用2次: %d", calls)
+	}
+
+	// 放行后的 Wait 不再阻塞，退出饥饿状态
+	for i := 0; i < 6; i++ {
+		limiter.gate <- struct{}{}
+	}
+	if err := <-errCh; !errors.Is(err, context.Canceled) {
+		t.Fatalf("处理完所有消息前退出: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if e := <-events; e.Paused || e.Reason != PauseStarved {
+			t.Errorf("退出饥饿状态后应该恢复分区: %+v", e)
+		}
+	}
+	if s := c.Stats(); s.Starved || s.Processed != 6 || len(c.Paused()) != 0 {
+		t.Errorf("积压处理完后应该退出饥饿状态: %+v", s)
+	}
+}
+
+// TestConsumer_Errors 测试 handler 和 Poll 的错误
+func TestConsumer_Errors(t *testing.T) {
+	boom := errors.New("boom")
+	c := NewConsumer(newFakeBroker(10, 5), NewTokenBucket(100, 100), func(ctx context.Context, m Message) error {
+		if m.Offset == 2 {
+			return boom
+		}
+		return nil
+	})
+	err := c.Run(context.Background())
+	if !errors.Is(err, boom) || err.Error() != fmt.Sprintf("limit: handle orders/0@2: %v", boom) {
+		t.Errorf("应该返回 handler 的错误: %v", err)
+	}
+
+	broker := newFakeBroker(10)
+	broker.err = boom
+	c = NewConsumer(broker, NewTokenBucket(100, 100), func(ctx context.Context, m Message) error { return nil })
+	if err := c.Run(context.Background()); !errors.Is(err, boom) {
+		t.Errorf("应该返回 Poll 的错误: %v", err)
+	}
+}
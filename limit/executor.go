@@ -0,0 +1,285 @@
+package limit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Task 执行器运行的任务
+type Task func(ctx context.Context) error
+
+// Progress 执行进度
+type Progress struct {
+	Total      int64         // 任务总数，从 channel 读取任务时为 0
+	Started    int64         // 已经开始的任务数
+	Completed  int64         // 已经结束的任务数（包括失败的）
+	Failed     int64         // 失败的任务数
+	Skipped    int64         // 已经读取、但因为 ctx 结束没有运行的任务数
+	Running    int64         // 正在运行的任务数
+	Paused     bool          // 是否处于暂停中
+	Elapsed    time.Duration // 已运行时长
+	Throughput float64       // 平均每秒完成的任务数
+}
+
+// ExecutorOption Executor 的可选配置
+type ExecutorOption func(*Executor)
+
+// WithCollectErrors 收集所有任务的错误（用 errors.Join 合并），而不是在第一个错误时停止
+func WithCollectErrors() ExecutorOption {
+	return func(e *Executor) {
+		e.collectErrors = true
+	}
+}
+
+// WithProgress 运行期间每隔 interval 报告一次进度，结束时再报告一次
+func WithProgress(interval time.Duration, fn func(Progress)) ExecutorOption {
+	return func(e *Executor) {
+		e.progressInterval = interval
+		e.onProgress = fn
+	}
+}
+
+// Executor 限速的任务执行器，适合“以 200/s 的速度、32 个并发跑完 100 万个任务”这类回刷任务
+// 1. 每个任务开始前等待限流器放行（等待而不是丢弃）
+// 2. 同时运行的任务数不超过 concurrency
+// 3. 默认第一个错误出现后停止分发新任务并返回该错误；WithCollectErrors 时跑完所有任务并返回全部错误
+// 同一个 Executor 同一时间只能执行一次 Run
+type Executor struct {
+	limiter          RateLimiter    // 限流器
+	concurrency      int            // 最大并发数
+	collectErrors    bool           // 是否收集所有错误
+	progressInterval time.Duration  // 进度报告间隔
+	onProgress       func(Progress) // 进度回调
+	total            atomic.Int64   // 任务总数
+	started          atomic.Int64   // 已经开始的任务数
+	completed        atomic.Int64   // 已经结束的任务数
+	failed           atomic.Int64   // 失败的任务数
+	skipped          atomic.Int64   // 已经读取但没有运行的任务数
+	startTime        time.Time      // 本次 Run 的开始时间
+	endTime          time.Time      // 本次 Run 的结束时间，运行中为零值
+	resumeCh         chan struct{}  // 暂停时为未关闭的 channel，恢复时关闭
+	mutex            sync.Mutex     // 保护 startTime、endTime、resumeCh
+}
+
+// NewExecutor 创建限速的任务执行器
+// concurrency 小于 1 时按 1 处理
+func NewExecutor(limiter RateLimiter, concurrency int, opts ...ExecutorOption) *Executor {
+	e := &Executor{
+		limiter:     limiter,
+		concurrency: max(concurrency, 1),
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// RunSlice 执行切片中的所有任务
+func (e *Executor) RunSlice(ctx context.Context, tasks []Task) error {
+	ch := make(chan Task, len(tasks))
+	for _, task := range tasks {
+		ch <- task
+	}
+	close(ch)
+	e.total.Store(int64(len(tasks)))
+	return e.run(ctx, ch)
+}
+
+// Run 执行 channel 中的任务，直到 channel 关闭、ctx 结束或（默认模式下）出现第一个错误
+// 提前结束时 channel 中剩余的任务不会被读取，已经读取但没有运行的任务计入 Progress.Skipped
+func (e *Executor) Run(ctx context.Context, tasks <-chan Task) error {
+	e.total.Store(0)
+	return e.run(ctx, tasks)
+}
+
+// run 启动工作协程执行任务
+func (e *Executor) run(ctx context.Context, tasks <-chan Task) error {
+	e.started.Store(0)
+	e.completed.Store(0)
+	e.failed.Store(0)
+	e.skipped.Store(0)
+	e.mutex.Lock()
+	e.startTime = time.Now()
+	e.endTime = time.Time{}
+	e.mutex.Unlock()
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	var errs []error
+	var errMutex sync.Mutex
+	record := func(err error) {
+		e.failed.Add(1)
+		errMutex.Lock()
+		errs = append(errs, err)
+		errMutex.Unlock()
+		if !e.collectErrors {
+			cancel(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < e.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				task, ok := e.next(ctx, tasks)
+				if !ok {
+					return
+				}
+				e.started.Add(1)
+				err := task(ctx)
+				e.completed.Add(1)
+				if err != nil {
+					record(err)
+				}
+			}
+		}()
+	}
+
+	stopProgress := e.reportProgress()
+	wg.Wait()
+	// 结束后 Elapsed 不再增长，Throughput 保持本次运行的平均值
+	e.mutex.Lock()
+	e.endTime = time.Now()
+	e.mutex.Unlock()
+	stopProgress()
+
+	if e.collectErrors {
+		// 收集模式下不会主动取消，ctx 结束说明调用方取消了
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+		}
+		return errors.Join(errs...)
+	}
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	return ctx.Err()
+}
+
+// next 取出下一个任务，并等待暂停结束和限流器放行
+// 取出任务后 ctx 结束时，该任务不会运行，计入 skipped
+func (e *Executor) next(ctx context.Context, tasks <-chan Task) (Task, bool) {
+	if err := e.waitResume(ctx); err != nil {
+		return nil, false
+	}
+	var task Task
+	select {
+	case <-ctx.Done():
+		return nil, false
+	case t, ok := <-tasks:
+		if !ok {
+			return nil, false
+		}
+		task = t
+	}
+	if err := e.waitResume(ctx); err != nil {
+		e.skipped.Add(1)
+		return nil, false
+	}
+	if err := Wait(ctx, e.limiter); err != nil {
+		e.skipped.Add(1)
+		return nil, false
+	}
+	return task, true
+}
+
+// waitResume 暂停时阻塞直到恢复或 ctx 结束
+func (e *Executor) waitResume(ctx context.Context) error {
+	e.mutex.Lock()
+	resumeCh := e.resumeCh
+	e.mutex.Unlock()
+	if resumeCh == nil {
+		return nil
+	}
+	select {
+	case <-resumeCh:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Pause 暂停分发新任务，正在运行的任务不受影响
+func (e *Executor) Pause() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.resumeCh == nil {
+		e.resumeCh = make(chan struct{})
+	}
+}
+
+// Resume 恢复分发任务
+func (e *Executor) Resume() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.resumeCh != nil {
+		close(e.resumeCh)
+		e.resumeCh = nil
+	}
+}
+
+// Progress 获取当前进度
+func (e *Executor) Progress() Progress {
+	e.mutex.Lock()
+	startTime, endTime := e.startTime, e.endTime
+	paused := e.resumeCh != nil
+	e.mutex.Unlock()
+
+	completed := e.completed.Load()
+	p := Progress{
+		Total:     e.total.Load(),
+		Started:   e.started.Load(),
+		Completed: completed,
+		Failed:    e.failed.Load(),
+		Skipped:   e.skipped.Load(),
+		Paused:    paused,
+	}
+	p.Running = p.Started - p.Completed
+	switch {
+	case !endTime.IsZero():
+		p.Elapsed = endTime.Sub(startTime)
+	case !startTime.IsZero():
+		p.Elapsed = time.Since(startTime)
+	}
+	if p.Elapsed > 0 {
+		p.Throughput = float64(completed) / p.Elapsed.Seconds()
+	}
+	return p
+}
+
+// reportProgress 定期报告进度，返回的函数停止报告并做最后一次报告
+func (e *Executor) reportProgress() func() {
+	if e.onProgress == nil {
+		return func() {}
+	}
+	if e.progressInterval <= 0 {
+		return func() { e.onProgress(e.Progress()) }
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(e.progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				e.onProgress(e.Progress())
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+		e.onProgress(e.Progress())
+	}
+}
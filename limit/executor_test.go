@@ -0,0 +1,212 @@
+package limit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingTasks 创建 n 个任务，记录执行次数和最大并发数
+func countingTasks(n int, d time.Duration, done, running, peak *atomic.Int64) []Task {
+	tasks := make([]Task, n)
+	for i := range tasks {
+		tasks[i] = func(ctx context.Context) error {
+			cur := running.Add(1)
+			for {
+				p := peak.Load()
+				if cur <= p || peak.CompareAndSwap(p, cur) {
+					break
+				}
+			}
+			time.Sleep(d)
+			running.Add(-1)
+			done.Add(1)
+			return nil
+		}
+	}
+	return tasks
+}
+
+// TestExecutor_RateAndConcurrency 测试限速和并发上限
+func TestExecutor_RateAndConcurrency(t *testing.T) {
+	var done, running, peak atomic.Int64
+	bucket := NewTokenBucket(5, 50) // 突发5个，之后每秒50个
+	defer bucket.Stop()
+	executor := NewExecutor(bucket, 3)
+
+	start := time.Now()
+	if err := executor.RunSlice(context.Background(), countingTasks(20, 10*time.Millisecond, &done, &running, &peak)); err != nil {
+		t.Fatal(err)
+	}
+	elapsed := time.Since(start)
+
+	if done.Load() != 20 {
+		t.Errorf("所有任务都应该执行: %d", done.Load())
+	}
+	if peak.Load() > 3 {
+		t.Errorf("并发数不应该超过3: %d", peak.Load())
+	}
+	// 剩余15个任务按每秒50个的速度执行，至少需要 280ms
+	if elapsed < 250*time.Millisecond {
+		t.Errorf("任务应该被限速: %v", elapsed)
+	}
+	p := executor.Progress()
+	if p.Total != 20 || p.Completed != 20 || p.Running != 0 || p.Throughput <= 0 {
+		t.Errorf("进度错误: %+v", p)
+	}
+}
+
+// TestExecutor_FirstError 测试默认在第一个错误时停止
+func TestExecutor_FirstError(t *testing.T) {
+	errBoom := errors.New("boom")
+	var executed atomic.Int64
+	tasks := make([]Task, 50)
+	for i := range tasks {
+		tasks[i] = func(ctx context.Context) error {
+			if executed.Add(1) == 3 {
+				return errBoom
+			}
+			return nil
+		}
+	}
+
+	bucket := NewTokenBucket(1, 100)
+	defer bucket.Stop()
+	err := NewExecutor(bucket, 1).RunSlice(context.Background(), tasks)
+	if !errors.Is(err, errBoom) {
+		t.Errorf("应该返回第一个错误: %v", err)
+	}
+	if executed.Load() != 3 {
+		t.Errorf("出错后不应该再分发新任务: %d", executed.Load())
+	}
+}
+
+// TestExecutor_CollectErrors 测试收集所有错误
+func TestExecutor_CollectErrors(t *testing.T) {
+	tasks := make([]Task, 10)
+	for i := range tasks {
+		tasks[i] = func(ctx context.Context) error {
+			if i%3 == 0 {
+				return fmt.Errorf("task %d: %w", i, context.DeadlineExceeded)
+			}
+			return nil
+		}
+	}
+
+	executor := NewExecutor(NewFixedWindowCounter(100, time.Second), 4, WithCollectErrors())
+	err := executor.RunSlice(context.Background(), tasks)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("应该返回合并后的错误: %v", err)
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); !ok || len(joined.Unwrap()) != 4 {
+		t.Errorf("应该收集到4个错误: %v", err)
+	}
+	if p := executor.Progress(); p.Completed != 10 || p.Failed != 4 {
+		t.Errorf("出错后仍然应该跑完所有任务: %+v", p)
+	}
+}
+
+// TestExecutor_Channel 测试从 channel 读取任务
+func TestExecutor_Channel(t *testing.T) {
+	var done, running, peak atomic.Int64
+	ch := make(chan Task)
+	go func() {
+		defer close(ch)
+		for _, task := range countingTasks(10, 0, &done, &running, &peak) {
+			ch <- task
+		}
+	}()
+
+	executor := NewExecutor(NewFixedWindowCounter(100, time.Second), 2)
+	if err := executor.Run(context.Background(), ch); err != nil {
+		t.Fatal(err)
+	}
+	if done.Load() != 10 {
+		t.Errorf("所有任务都应该执行: %d", done.Load())
+	}
+	if p := executor.Progress(); p.Total != 0 || p.Completed != 10 {
+		t.Errorf("进度错误: %+v", p)
+	}
+}
+
+// TestExecutor_PauseResume 测试暂停和恢复
+func TestExecutor_PauseResume(t *testing.T) {
+	var done, running, peak atomic.Int64
+	executor := NewExecutor(NewFixedWindowCounter(100, time.Second), 2)
+	executor.Pause()
+
+	result := make(chan error, 1)
+	go func() {
+		result <- executor.RunSlice(context.Background(), countingTasks(5, 0, &done, &running, &peak))
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	if p := executor.Progress(); done.Load() != 0 || !p.Paused {
+		t.Errorf("暂停期间不应该执行任务: %d, %+v", done.Load(), p)
+	}
+
+	executor.Resume()
+	if err := <-result; err != nil {
+		t.Fatal(err)
+	}
+	if done.Load() != 5 {
+		t.Errorf("恢复后应该执行所有任务: %d", done.Load())
+	}
+}
+
+// TestExecutor_Cancel 测试 ctx 取消
+func TestExecutor_Cancel(t *testing.T) {
+	var done, running, peak atomic.Int64
+	// 每小时只放行1个，ctx 先结束
+	executor := NewExecutor(NewFixedWindowCounter(1, time.Hour), 2)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := executor.RunSlice(ctx, countingTasks(5, 0, &done, &running, &peak))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("应该返回 ctx 错误: %v", err)
+	}
+	if done.Load() != 1 {
+		t.Errorf("只有1个任务能通过限流: %d", done.Load())
+	}
+	// 两个工作协程各自取出了一个任务，在等待限流器时 ctx 结束
+	if p := executor.Progress(); p.Started != 1 || p.Skipped != 2 {
+		t.Errorf("已经取出但没有运行的任务应该计入 Skipped: %+v", p)
+	}
+}
+
+// TestExecutor_Progress 测试进度回调
+func TestExecutor_Progress(t *testing.T) {
+	var mutex sync.Mutex
+	var reports []Progress
+	executor := NewExecutor(NewTokenBucket(1, 100), 1, WithProgress(20*time.Millisecond, func(p Progress) {
+		mutex.Lock()
+		reports = append(reports, p)
+		mutex.Unlock()
+	}))
+
+	var done, running, peak atomic.Int64
+	if err := executor.RunSlice(context.Background(), countingTasks(10, 0, &done, &running, &peak)); err != nil {
+		t.Fatal(err)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(reports) < 2 {
+		t.Fatalf("运行期间应该定期报告进度: %d", len(reports))
+	}
+	last := reports[len(reports)-1]
+	if last.Completed != 10 || last.Total != 10 {
+		t.Errorf("最后一次报告应该是最终进度: %+v", last)
+	}
+
+	// 结束后耗时和吞吐量不再变化
+	time.Sleep(20 * time.Millisecond)
+	if p := executor.Progress(); p.Elapsed != last.Elapsed || p.Throughput != last.Throughput {
+		t.Errorf("结束后进度不应该变化: %+v, 最后一次报告 %+v", p, last)
+	}
+}
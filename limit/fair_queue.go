@@ -0,0 +1,365 @@
+package limit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrQueueFull 排队已满
+	ErrQueueFull = errors.New("limit: queue is full")
+	// ErrLimiterStopped 限流器已停止
+	ErrLimiterStopped = errors.New("limit: limiter stopped")
+)
+
+// FairLimiter 多租户加权公平排队限流器
+// 1. 所有租户共享同一个漏桶的漏出速率
+// 2. 每个租户有独立的有界队列，按权重以赤字轮转（DRR）的顺序出队
+// 3. 一个租户的突发流量只会占满自己的队列，不会饿死其他租户
+type FairLimiter struct {
+	rate          time.Duration          // 漏出速率（每个请求的处理间隔）
+	queueLen      int                    // 每个租户的最大排队数
+	defaultWeight int                    // 未设置权重的租户的默认权重
+	weights       map[string]int         // 租户权重
+	tenants       map[string]*fairTenant // 有排队请求的租户到排队状态的映射
+	active        []*fairTenant          // 正在轮转的租户
+	current       int                    // 当前轮转到的租户下标
+	queued        int                    // 所有租户的排队总数
+	freeWaiters   []*fairWaiter          // 可以复用的 fairWaiter
+	freeTenants   []*fairTenant          // 可以复用的租户，保留环形队列的底层数组
+	mutex         sync.Mutex             // 互斥锁
+	notify        chan struct{}          // 有新请求入队的通知
+	stopCh        chan struct{}          // 停止信号
+	stopOnce      sync.Once
+}
+
+// fairTenant 租户的排队状态
+type fairTenant struct {
+	name    string      // 租户名称
+	weight  int         // 每轮可以出队的请求数
+	deficit int         // 本轮剩余可出队的请求数
+	queue   waiterQueue // 排队中的请求
+	active  bool        // 是否在轮转列表中
+}
+
+// waiterQueue 排队请求的环形队列，出队 O(1)，底层数组扩容后一直复用
+type waiterQueue struct {
+	buf  []*fairWaiter // 环形缓冲区
+	head int           // 队头下标
+	size int           // 排队数
+}
+
+// len 获取排队数
+func (q *waiterQueue) len() int {
+	return q.size
+}
+
+// push 入队，缓冲区满时按2倍扩容
+func (q *waiterQueue) push(w *fairWaiter) {
+	if q.size == len(q.buf) {
+		buf := make([]*fairWaiter, max(2*len(q.buf), 4))
+		for i := 0; i < q.size; i++ {
+			buf[i] = q.buf[(q.head+i)%len(q.buf)]
+		}
+		q.buf, q.head = buf, 0
+	}
+	q.buf[(q.head+q.size)%len(q.buf)] = w
+	q.size++
+}
+
+// pop 出队，调用方需保证队列不为空
+func (q *waiterQueue) pop() *fairWaiter {
+	w := q.buf[q.head]
+	q.buf[q.head] = nil
+	q.head = (q.head + 1) % len(q.buf)
+	q.size--
+	return w
+}
+
+// remove 删除队列中的 w，后面的请求依次前移，返回是否找到
+func (q *waiterQueue) remove(w *fairWaiter) bool {
+	for i := 0; i < q.size; i++ {
+		if q.buf[(q.head+i)%len(q.buf)] != w {
+			continue
+		}
+		for j := i; j < q.size-1; j++ {
+			q.buf[(q.head+j)%len(q.buf)] = q.buf[(q.head+j+1)%len(q.buf)]
+		}
+		q.buf[(q.head+q.size-1)%len(q.buf)] = nil
+		q.size--
+		return true
+	}
+	return false
+}
+
+// fairWaiter 排队中的请求
+type fairWaiter struct {
+	ready chan struct{} // 轮到该请求时发送一个信号
+	done  bool          // 是否已经出队
+}
+
+// maxFree 每个限流器最多保留的空闲 fairWaiter 和租户数
+// 复用对象放在限流器自己的空闲列表而不是全局的 sync.Pool 中：sync.Pool 随 GC 清空，
+// 开启 -race 时还会随机丢弃 Put，放行请求时不能保证不分配内存
+const maxFree = 1024
+
+// NewFairLimiter 创建多租户公平排队限流器
+// rate: 漏出速率，例如 100ms 表示每100毫秒放行一个请求，不大于 0 时请求之间不间隔
+// queueLen: 每个租户的最大排队数，小于 1 时按 1 处理
+func NewFairLimiter(rate time.Duration, queueLen int) *FairLimiter {
+	fl := &FairLimiter{
+		rate:          max(rate, 0),
+		queueLen:      max(queueLen, 1),
+		defaultWeight: 1,
+		weights:       make(map[string]int),
+		tenants:       make(map[string]*fairTenant),
+		notify:        make(chan struct{}, 1),
+		stopCh:        make(chan struct{}),
+	}
+	go fl.run()
+	return fl
+}
+
+// SetWeight 设置租户权重，权重越大每轮可以出队的请求越多
+func (fl *FairLimiter) SetWeight(tenant string, weight int) {
+	if weight < 1 {
+		weight = 1
+	}
+	fl.mutex.Lock()
+	defer fl.mutex.Unlock()
+
+	fl.weights[tenant] = weight
+	if t, ok := fl.tenants[tenant]; ok {
+		t.weight = weight
+	}
+}
+
+// AllowKey 租户的请求排队，阻塞直到轮到该请求
+// 租户队列已满时立即返回 false
+func (fl *FairLimiter) AllowKey(tenant string) bool {
+	return fl.WaitKey(context.Background(), tenant) == nil
+}
+
+// WaitKey 租户的请求排队，阻塞直到轮到该请求或 ctx 结束
+// 租户队列已满时立即返回 ErrQueueFull
+func (fl *FairLimiter) WaitKey(ctx context.Context, tenant string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	w, err := fl.enqueue(tenant)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-w.ready:
+		fl.release(w)
+		return nil
+	case <-ctx.Done():
+		if fl.cancel(tenant, w) {
+			fl.release(w)
+			return ctx.Err()
+		}
+		// 取消的同时已经轮到了该请求
+		<-w.ready
+		fl.release(w)
+		return nil
+	case <-fl.stopCh:
+		// 请求可能还在队列中，不能复用
+		return ErrLimiterStopped
+	}
+}
+
+// enqueue 请求入队
+func (fl *FairLimiter) enqueue(tenant string) (*fairWaiter, error) {
+	fl.mutex.Lock()
+	defer fl.mutex.Unlock()
+
+	select {
+	case <-fl.stopCh:
+		return nil, ErrLimiterStopped
+	default:
+	}
+
+	t, ok := fl.tenants[tenant]
+	if !ok {
+		weight, ok := fl.weights[tenant]
+		if !ok {
+			weight = fl.defaultWeight
+		}
+		if n := len(fl.freeTenants); n > 0 {
+			t = fl.freeTenants[n-1]
+			fl.freeTenants = fl.freeTenants[:n-1]
+		} else {
+			t = &fairTenant{}
+		}
+		t.name, t.weight = tenant, weight
+		fl.tenants[tenant] = t
+	}
+	if t.queue.len() >= fl.queueLen {
+		return nil, ErrQueueFull
+	}
+
+	var w *fairWaiter
+	if n := len(fl.freeWaiters); n > 0 {
+		w = fl.freeWaiters[n-1]
+		fl.freeWaiters = fl.freeWaiters[:n-1]
+	} else {
+		// ready 使用带缓冲的 channel 发送信号而不是关闭，所以可以复用
+		w = &fairWaiter{ready: make(chan struct{}, 1)}
+	}
+	w.done = false
+	t.queue.push(w)
+	fl.queued++
+	if !t.active {
+		t.active = true
+		fl.active = append(fl.active, t)
+	}
+
+	select {
+	case fl.notify <- struct{}{}:
+	default:
+	}
+	return w, nil
+}
+
+// release 回收已经出队或取消的请求，ready 中没有未读取的信号
+func (fl *FairLimiter) release(w *fairWaiter) {
+	fl.mutex.Lock()
+	defer fl.mutex.Unlock()
+	if len(fl.freeWaiters) < maxFree {
+		fl.freeWaiters = append(fl.freeWaiters, w)
+	}
+}
+
+// cancel 取消排队中的请求，请求已经出队时返回 false
+func (fl *FairLimiter) cancel(tenant string, w *fairWaiter) bool {
+	fl.mutex.Lock()
+	defer fl.mutex.Unlock()
+
+	if w.done {
+		return false
+	}
+	// 请求还没有出队，租户一定还在 tenants 中（只有队列为空的租户会被删除）
+	if fl.tenants[tenant].queue.remove(w) {
+		fl.queued--
+	}
+	return true
+}
+
+// run 按漏出速率依次放行请求
+func (fl *FairLimiter) run() {
+	var last time.Time
+	for {
+		fl.mutex.Lock()
+		empty := fl.queued == 0
+		fl.mutex.Unlock()
+
+		if empty {
+			select {
+			case <-fl.notify:
+				continue
+			case <-fl.stopCh:
+				return
+			}
+		}
+
+		if wait := time.Until(last.Add(fl.rate)); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-fl.stopCh:
+				timer.Stop()
+				return
+			}
+		}
+		if fl.dispatch() {
+			last = time.Now()
+		}
+	}
+}
+
+// dispatch 按赤字轮转选出下一个请求并放行
+func (fl *FairLimiter) dispatch() bool {
+	fl.mutex.Lock()
+	defer fl.mutex.Unlock()
+
+	for len(fl.active) > 0 {
+		if fl.current >= len(fl.active) {
+			fl.current = 0
+		}
+		t := fl.active[fl.current]
+		if t.queue.len() == 0 {
+			fl.deactivate(t)
+			continue
+		}
+		// 新一轮开始，补充本轮额度
+		if t.deficit <= 0 {
+			t.deficit += t.weight
+		}
+
+		w := t.queue.pop()
+		t.deficit--
+		fl.queued--
+		w.done = true
+		w.ready <- struct{}{}
+
+		if t.queue.len() == 0 {
+			fl.deactivate(t)
+		} else if t.deficit <= 0 {
+			fl.current++
+		}
+		return true
+	}
+	return false
+}
+
+// deactivate 将队列为空的当前租户移出轮转列表并删除，调用方需持有锁
+// 权重保存在 weights 中，租户下次入队时按原来的权重重新创建，所以 tenants 只保存有排队请求的租户
+func (fl *FairLimiter) deactivate(t *fairTenant) {
+	fl.active = append(fl.active[:fl.current], fl.active[fl.current+1:]...)
+	t.active = false
+	t.deficit = 0
+	delete(fl.tenants, t.name)
+	if len(fl.freeTenants) < maxFree {
+		fl.freeTenants = append(fl.freeTenants, t)
+	}
+}
+
+// GetKeyStatus 获取租户的排队状态
+// current: 租户当前排队数
+// capacity: 租户最大排队数
+func (fl *FairLimiter) GetKeyStatus(tenant string) (current int64, capacity int64) {
+	fl.mutex.Lock()
+	defer fl.mutex.Unlock()
+
+	if t, ok := fl.tenants[tenant]; ok {
+		current = int64(t.queue.len())
+	}
+	return current, int64(fl.queueLen)
+}
+
+// GetStatus 获取所有租户的排队总数
+// current: 排队总数
+// capacity: 每个租户的最大排队数
+func (fl *FairLimiter) GetStatus() (current int64, capacity int64) {
+	fl.mutex.Lock()
+	defer fl.mutex.Unlock()
+	return int64(fl.queued), int64(fl.queueLen)
+}
+
+// Algorithm 获取限流算法名称
+func (fl *FairLimiter) Algorithm() string {
+	return "fair_queue"
+}
+
+// Stop 停止限流器，所有排队中的请求返回 ErrLimiterStopped
+func (fl *FairLimiter) Stop() {
+	fl.stopOnce.Do(func() {
+		fl.mutex.Lock()
+		close(fl.stopCh)
+		fl.mutex.Unlock()
+	})
+}
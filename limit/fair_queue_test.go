@@ -0,0 +1,232 @@
+package limit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitQueued 等待租户排队数达到 n
+func waitQueued(t *testing.T, fl *FairLimiter, tenant string, n int64) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if current, _ := fl.GetKeyStatus(tenant); current >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("租户 %s 排队数没有达到 %d", tenant, n)
+}
+
+// TestFairLimiter_Weighted 测试按权重轮转出队
+func TestFairLimiter_Weighted(t *testing.T) {
+	fl := NewFairLimiter(20*time.Millisecond, 20)
+	defer fl.Stop()
+	fl.SetWeight("uploader", 3)
+	fl.SetWeight("viewer", 1)
+
+	// 先占住漏桶，让后续请求都进入排队
+	fl.AllowKey("warmup")
+
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	for _, tenant := range []string{"uploader", "viewer"} {
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(tenant string) {
+				defer wg.Done()
+				if fl.AllowKey(tenant) {
+					mu.Lock()
+					order = append(order, tenant)
+					mu.Unlock()
+				}
+			}(tenant)
+		}
+	}
+	waitQueued(t, fl, "uploader", 8)
+	waitQueued(t, fl, "viewer", 8)
+	wg.Wait()
+
+	// 前8个出队的请求中，uploader 和 viewer 的比例应该是 3:1
+	uploader := 0
+	for _, tenant := range order[:8] {
+		if tenant == "uploader" {
+			uploader++
+		}
+	}
+	if uploader < 5 || uploader > 7 {
+		t.Errorf("加权轮转比例错误，前8个中 uploader 有 %d 个: %v", uploader, order)
+	}
+}
+
+// TestFairLimiter_NoStarvation 测试重度租户不会饿死其他租户
+func TestFairLimiter_NoStarvation(t *testing.T) {
+	fl := NewFairLimiter(10*time.Millisecond, 100)
+	defer fl.Stop()
+
+	// 重度租户排满大量请求
+	for i := 0; i < 50; i++ {
+		go fl.AllowKey("heavy")
+	}
+	waitQueued(t, fl, "heavy", 40)
+
+	// 轻度租户的请求应该在一两个间隔内被放行，而不是排在50个请求之后
+	start := time.Now()
+	if !fl.AllowKey("light") {
+		t.Fatal("轻度租户的请求应该通过")
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("轻度租户等待时间过长: %v", elapsed)
+	}
+}
+
+// TestFairLimiter_QueueFull 测试租户队列已满时立即拒绝
+func TestFairLimiter_QueueFull(t *testing.T) {
+	fl := NewFairLimiter(100*time.Millisecond, 2)
+	defer fl.Stop()
+
+	fl.AllowKey("a")
+	for i := 0; i < 2; i++ {
+		go fl.AllowKey("a")
+	}
+	waitQueued(t, fl, "a", 2)
+
+	start := time.Now()
+	if err := fl.WaitKey(context.Background(), "a"); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("队列已满时应该返回 ErrQueueFull，实际: %v", err)
+	}
+	if time.Since(start) > 10*time.Millisecond {
+		t.Error("队列已满时应该立即返回")
+	}
+
+	// 其他租户不受影响
+	if current, capacity := fl.GetKeyStatus("b"); current != 0 || capacity != 2 {
+		t.Errorf("租户 b 状态错误: current=%d, capacity=%d", current, capacity)
+	}
+}
+
+// TestFairLimiter_Invalid 测试非法参数按最小值处理
+func TestFairLimiter_Invalid(t *testing.T) {
+	fl := NewFairLimiter(-time.Second, 0)
+	defer fl.Stop()
+
+	for i := 0; i < 3; i++ {
+		if !fl.AllowKey("a") {
+			t.Fatalf("排队数按1处理时第%d个请求应该通过", i+1)
+		}
+	}
+	if _, capacity := fl.GetKeyStatus("a"); capacity != 1 {
+		t.Errorf("排队数应该按1处理: %d", capacity)
+	}
+}
+
+// TestFairLimiter_Cancel 测试 ctx 取消后请求离开队列
+func TestFairLimiter_Cancel(t *testing.T) {
+	fl := NewFairLimiter(100*time.Millisecond, 5)
+	defer fl.Stop()
+	fl.AllowKey("a")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := fl.WaitKey(ctx, "a"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ctx 超时后应该返回 DeadlineExceeded，实际: %v", err)
+	}
+	if current, _ := fl.GetStatus(); current != 0 {
+		t.Errorf("取消后排队数应该为0，实际 %d", current)
+	}
+}
+
+// TestFairLimiter_Stop 测试停止后排队请求返回错误
+func TestFairLimiter_Stop(t *testing.T) {
+	fl := NewFairLimiter(time.Second, 5)
+	fl.AllowKey("a")
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- fl.WaitKey(context.Background(), "a")
+	}()
+	waitQueued(t, fl, "a", 1)
+
+	fl.Stop()
+	fl.Stop()
+	if err := <-errCh; !errors.Is(err, ErrLimiterStopped) {
+		t.Errorf("停止后应该返回 ErrLimiterStopped，实际: %v", err)
+	}
+	if fl.AllowKey("b") {
+		t.Error("停止后请求应该被拒绝")
+	}
+}
+
+// TestWaiterQueue 测试环形队列绕回、扩容和删除时保持先进先出
+func TestWaiterQueue(t *testing.T) {
+	var q waiterQueue
+	waiters := make([]*fairWaiter, 10)
+	for i := range waiters {
+		waiters[i] = &fairWaiter{}
+	}
+	// 先入队再出队，让队头移动到缓冲区中间
+	for _, w := range waiters[:3] {
+		q.push(w)
+	}
+	for i := 0; i < 3; i++ {
+		if q.pop() != waiters[i] {
+			t.Fatalf("第%d个出队的请求错误", i+1)
+		}
+	}
+	// 绕回并扩容
+	for _, w := range waiters {
+		q.push(w)
+	}
+	if !q.remove(waiters[4]) || q.remove(waiters[4]) {
+		t.Error("删除排队中的请求应该成功且只成功一次")
+	}
+	for i, w := range waiters {
+		if i == 4 {
+			continue
+		}
+		if got := q.pop(); got != w {
+			t.Fatalf("出队顺序错误，期望第%d个请求", i+1)
+		}
+	}
+	if q.len() != 0 {
+		t.Errorf("队列应该为空: %d", q.len())
+	}
+}
+
+// TestFairLimiter_PruneTenants 测试队列为空的租户被删除，权重保留
+func TestFairLimiter_PruneTenants(t *testing.T) {
+	fl := NewFairLimiter(time.Millisecond, 5)
+	defer fl.Stop()
+	fl.SetWeight("vip", 3)
+
+	for i := 0; i < 100; i++ {
+		fl.AllowKey(fmt.Sprintf("tenant:%d", i))
+	}
+	fl.AllowKey("vip")
+
+	fl.mutex.Lock()
+	tenants := len(fl.tenants)
+	fl.mutex.Unlock()
+	if tenants != 0 {
+		t.Errorf("没有排队请求的租户应该被删除，剩余 %d 个", tenants)
+	}
+
+	// 租户重新入队时使用设置过的权重
+	slow := NewFairLimiter(time.Second, 5)
+	defer slow.Stop()
+	slow.SetWeight("vip", 3)
+	slow.AllowKey("vip")
+	go slow.AllowKey("vip")
+	waitQueued(t, slow, "vip", 1)
+	slow.mutex.Lock()
+	weight := slow.tenants["vip"].weight
+	slow.mutex.Unlock()
+	if weight != 3 {
+		t.Errorf("重新创建的租户权重错误: %d", weight)
+	}
+}
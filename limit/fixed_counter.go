@@ -11,38 +11,54 @@ type FixedWindowCounter struct {
 	window   time.Duration // 时间窗口
 	counter  int64         // 当前计数
 	lastTime time.Time     // 上次重置时间
+	clock    Clock         // 时钟
 	mutex    sync.Mutex    // 互斥锁
 }
 
 // NewFixedWindowCounter 创建固定窗口计数器
-func NewFixedWindowCounter(limit int64, window time.Duration) *FixedWindowCounter {
+func NewFixedWindowCounter(limit int64, window time.Duration, opts ...Option) *FixedWindowCounter {
+	o := newOptions(opts)
 	return &FixedWindowCounter{
 		limit:    limit,
 		window:   window,
 		counter:  0,
-		lastTime: time.Now(),
+		lastTime: o.clock.Now(),
+		clock:    o.clock,
 	}
 }
 
 // Allow 检查是否允许请求通过
 func (f *FixedWindowCounter) Allow() bool {
+	return f.AllowN(1)
+}
+
+// AllowN 检查是否允许 n 个请求同时通过，不足时一个也不计数
+func (f *FixedWindowCounter) AllowN(n int64) bool {
 	f.mutex.Lock()
 	defer f.mutex.Unlock()
 
-	now := time.Now()
+	now := f.clock.Now()
 	// 如果超过了时间窗口，重置计数器
 	if now.Sub(f.lastTime) >= f.window {
 		f.counter = 0
 		f.lastTime = now
 	}
 	// 检查是否超过限制
-	if f.counter >= f.limit {
+	if f.counter+n > f.limit {
 		return false
 	}
-	f.counter++
+	f.counter += n
 	return true
 }
 
+// SetLimit 调整限制数量和时间窗口，不重置当前窗口的计数
+func (f *FixedWindowCounter) SetLimit(limit int64, window time.Duration) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.limit = limit
+	f.window = window
+}
+
 // GetStatus 获取当前状态
 func (f *FixedWindowCounter) GetStatus() (int64, int64) {
 	f.mutex.Lock()
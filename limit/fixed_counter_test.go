@@ -154,4 +154,41 @@ func BenchmarkFixedWindowCounter_GetStatus(b *testing.B) {
 			limiter.GetStatus()
 		}
 	})
-}
\ No newline at end of file
+}
+// TestFixedWindowCounter_SetLimit 测试调整限制不重置计数
+func TestFixedWindowCounter_SetLimit(t *testing.T) {
+	limiter := NewFixedWindowCounter(2, time.Second)
+	limiter.Allow()
+	limiter.Allow()
+
+	limiter.SetLimit(3, time.Second)
+	current, limit := limiter.GetStatus()
+	if current != 2 || limit != 3 {
+		t.Errorf("调整后状态错误: current=%d, limit=%d", current, limit)
+	}
+	if !limiter.Allow() {
+		t.Error("提高限制后请求应该通过")
+	}
+	if limiter.Allow() {
+		t.Error("新的限制用完后请求应该被拒绝")
+	}
+}
+
+// TestFixedWindowCounter_AllowN 测试一次通过多个请求
+func TestFixedWindowCounter_AllowN(t *testing.T) {
+	limiter := NewFixedWindowCounter(5, time.Second)
+
+	if !limiter.AllowN(3) {
+		t.Error("3个请求应该通过")
+	}
+	// 剩余2个名额，不足时一个也不计数
+	if limiter.AllowN(3) {
+		t.Error("名额不足时应该被拒绝")
+	}
+	if current, _ := limiter.GetStatus(); current != 3 {
+		t.Errorf("被拒绝的请求不应该计数: current=%d", current)
+	}
+	if !limiter.AllowN(2) {
+		t.Error("2个请求应该通过")
+	}
+}
@@ -0,0 +1,332 @@
+package limit
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// htbStackDepth 路径深度不超过该值时 Allow 不分配内存
+const htbStackDepth = 8
+
+// HTBClass 层级限流树中一个节点的参数
+type HTBClass struct {
+	Rate   int64 `json:"rate" yaml:"rate"`                         // 保证速率（每秒请求数）
+	Ceil   int64 `json:"ceil,omitempty" yaml:"ceil,omitempty"`     // 借用后的最高速率，为 0 时等于 Rate（不借用）
+	Burst  int64 `json:"burst,omitempty" yaml:"burst,omitempty"`   // 保证速率的突发容量，为 0 时等于 Rate
+	CBurst int64 `json:"cburst,omitempty" yaml:"cburst,omitempty"` // 最高速率的突发容量，为 0 时等于 Ceil 和 Burst 中较大的一个
+}
+
+// ceil 借用后的最高速率
+func (c HTBClass) ceil() int64 {
+	return max(c.Ceil, c.Rate)
+}
+
+// burst 保证速率的突发容量
+func (c HTBClass) burst() int64 {
+	if c.Burst > 0 {
+		return c.Burst
+	}
+	return max(c.Rate, 1)
+}
+
+// cburst 最高速率的突发容量
+func (c HTBClass) cburst() int64 {
+	if c.CBurst > 0 {
+		return c.CBurst
+	}
+	return max(c.Ceil, c.burst())
+}
+
+// HTBStatus 层级限流树中一个节点的状态
+type HTBStatus struct {
+	Name       string      `json:"name"`               // 节点名称，根节点为空
+	Rate       int64       `json:"rate"`               // 保证速率
+	Ceil       int64       `json:"ceil"`               // 最高速率
+	Tokens     int64       `json:"tokens"`             // 保证速率的令牌，为负数表示子节点借用了超出本节点保证速率的配额
+	CeilTokens int64       `json:"ceil_tokens"`        // 最高速率的令牌
+	Allowed    uint64      `json:"allowed"`            // 经过本节点放行的请求数
+	Borrowed   uint64      `json:"borrowed"`           // 其中向上级借用配额的请求数
+	Rejected   uint64      `json:"rejected"`           // 经过本节点被拒绝的请求数
+	Children   []HTBStatus `json:"children,omitempty"` // 子节点，按名称排序
+}
+
+// htbNode 层级限流树的节点
+type htbNode struct {
+	name       string
+	class      HTBClass
+	tokens     int64               // 保证速率的令牌（以 1/tokenScale 为单位），可以为负数
+	ceilTokens int64               // 最高速率的令牌（以 1/tokenScale 为单位）
+	lastRefill time.Time           // 上次补充时间
+	lastUsed   time.Time           // 上次有请求经过的时间
+	children   map[string]*htbNode // 子节点
+	allowed    uint64              // 放行的请求数
+	borrowed   uint64              // 借用配额的请求数
+	rejected   uint64              // 被拒绝的请求数
+}
+
+// newHTBNode 创建令牌满的节点
+func newHTBNode(name string, class HTBClass, now time.Time) *htbNode {
+	return &htbNode{
+		name:       name,
+		class:      class,
+		tokens:     scaleTokens(class.burst()),
+		ceilTokens: scaleTokens(class.cburst()),
+		lastRefill: now,
+		lastUsed:   now,
+	}
+}
+
+// refill 按流逝的时间补充令牌
+func (n *htbNode) refill(now time.Time) {
+	elapsed := now.Sub(n.lastRefill)
+	if elapsed <= 0 {
+		return
+	}
+	n.lastRefill = now
+	fill(&n.tokens, n.class.burst(), accrued(elapsed, n.class.Rate))
+	fill(&n.ceilTokens, n.class.cburst(), accrued(elapsed, n.class.ceil()))
+}
+
+// full 节点令牌是否已经补满（空闲）
+func (n *htbNode) full() bool {
+	return n.tokens >= scaleTokens(n.class.burst()) && n.ceilTokens >= scaleTokens(n.class.cburst())
+}
+
+// HTB 层级限流树，类似 Linux tc 的 HTB（Hierarchy Token Bucket）
+// 例如全站 -> 租户 -> 用户：全站 100k/s，每个租户保证 5k/s、最多借用到 20k/s，每个用户 20/s
+//
+// 每个节点有两个令牌桶：保证速率 Rate 和最高速率 Ceil。Allow(path...) 在一把锁内对路径上的所有节点判定并扣减：
+//  1. 路径上每个节点的 Ceil 桶都必须有令牌，这是各级的硬上限（根节点的 Ceil 就是全站上限）
+//  2. 从叶子往上找第一个 Rate 桶有令牌的节点作为出借方，它下面的节点都在借用上级的空闲配额
+//  3. 出借方及其所有上级的 Rate 桶都要扣减，上级的 Rate 桶可以为负数，表示子节点用掉了它的保证配额，
+//     这样子节点在保证速率内的请求会挤占上级的空闲配额，借用只能使用真正空闲的部分
+//
+// 子节点按层级模板懒创建，SetClass 可以为某个节点单独设置参数（如大客户）
+type HTB struct {
+	root      *htbNode
+	levels    []HTBClass          // 各层级子节点的默认参数，levels[0] 是根节点的子节点
+	overrides map[string]HTBClass // 单独设置参数的节点，key 为用 | 连接的路径
+	clock     Clock               // 时钟
+	mutex     sync.Mutex          // 互斥锁
+}
+
+// NewHTB 创建层级限流树
+// root: 根节点参数，根节点不能借用，Ceil 和 CBurst 不生效
+// levels: 各层级子节点的默认参数，路径深度超过 levels 且没有单独设置参数的请求会被拒绝
+func NewHTB(root HTBClass, levels []HTBClass, opts ...Option) *HTB {
+	o := newOptions(opts)
+	root.Ceil, root.CBurst = root.Rate, root.burst()
+	return &HTB{
+		root:      newHTBNode("", root, o.clock.Now()),
+		levels:    levels,
+		overrides: make(map[string]HTBClass),
+		clock:     o.clock,
+	}
+}
+
+// SetClass 为路径上的节点单独设置参数，已经存在的节点保留当前令牌
+func (h *HTB) SetClass(class HTBClass, path ...string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if len(path) == 0 {
+		class.Ceil, class.CBurst = class.Rate, class.burst()
+		h.root.refill(h.clock.Now())
+		h.root.class = class
+		return
+	}
+	h.overrides[strings.Join(path, "|")] = class
+	if n := h.lookup(path); n != nil {
+		n.refill(h.clock.Now())
+		n.class = class
+	}
+}
+
+// classOf 获取路径上节点的参数
+func (h *HTB) classOf(path []string) (HTBClass, bool) {
+	if c, ok := h.overrides[strings.Join(path, "|")]; ok {
+		return c, true
+	}
+	if len(path) > len(h.levels) {
+		return HTBClass{}, false
+	}
+	return h.levels[len(path)-1], true
+}
+
+// lookup 查找路径对应的节点，不存在时返回 nil
+func (h *HTB) lookup(path []string) *htbNode {
+	n := h.root
+	for _, name := range path {
+		n = n.children[name]
+		if n == nil {
+			return nil
+		}
+	}
+	return n
+}
+
+// chain 获取从根节点到路径末端的所有节点并追加到 nodes，不存在的节点按参数创建
+func (h *HTB) chain(nodes []*htbNode, path []string, now time.Time) ([]*htbNode, bool) {
+	n := h.root
+	nodes = append(nodes, n)
+	for i, name := range path {
+		child := n.children[name]
+		if child == nil {
+			class, ok := h.classOf(path[:i+1])
+			if !ok {
+				return nil, false
+			}
+			child = newHTBNode(name, class, now)
+			if n.children == nil {
+				n.children = make(map[string]*htbNode)
+			}
+			n.children[name] = child
+		}
+		n = child
+		nodes = append(nodes, n)
+	}
+	return nodes, true
+}
+
+// Allow 检查路径上的请求是否允许通过，例如 Allow("tenant:42", "uid:1001")
+func (h *HTB) Allow(path ...string) bool {
+	return h.AllowN(1, path...)
+}
+
+// AllowN 检查路径上大小为 n 的请求是否允许通过，路径上所有节点一起扣减或一起不扣减
+func (h *HTB) AllowN(n int64, path ...string) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	now := h.clock.Now()
+	// 常见的层级深度下节点列表分配在栈上
+	var buf [htbStackDepth]*htbNode
+	nodes, ok := h.chain(buf[:0], path, now)
+	if !ok {
+		return false
+	}
+	need := scaleTokens(max(n, 0))
+	lender := -1
+	for i := len(nodes) - 1; i >= 0; i-- {
+		node := nodes[i]
+		node.refill(now)
+		node.lastUsed = now
+		if node.ceilTokens < need {
+			for _, node := range nodes {
+				node.rejected++
+			}
+			return false
+		}
+		if lender < 0 && node.tokens >= need {
+			lender = i
+		}
+	}
+	if lender < 0 {
+		for _, node := range nodes {
+			node.rejected++
+		}
+		return false
+	}
+
+	for i, node := range nodes {
+		node.ceilTokens -= need
+		node.allowed++
+		if i <= lender {
+			// 上级的保证配额允许透支，最多透支一个突发容量
+			node.tokens = max(node.tokens-need, -scaleTokens(node.class.burst()))
+		} else {
+			node.borrowed++
+		}
+	}
+	return true
+}
+
+// AllowKey 以用 | 分隔的 key 作为路径，可以配合 CompositeKey 在 HTTP 中间件中使用
+// CompositeKey 转义了各部分中的 |，层级和组合的各部分一一对应，各层级的名称是转义后的值
+func (h *HTB) AllowKey(key string) bool {
+	var buf [htbStackDepth]string
+	return h.Allow(splitHTBPath(buf[:0], key)...)
+}
+
+// splitHTBPath 把用 | 分隔的 key 拆分后追加到 path，子串共享 key 的内存
+func splitHTBPath(path []string, key string) []string {
+	for {
+		name, rest, ok := strings.Cut(key, "|")
+		path = append(path, name)
+		if !ok {
+			return path
+		}
+		key = rest
+	}
+}
+
+// GetKeyStatus 获取路径末端节点最高速率的令牌数和突发容量，节点不存在时按参数返回满的状态
+func (h *HTB) GetKeyStatus(key string) (int64, int64) {
+	var buf [htbStackDepth]string
+	path := splitHTBPath(buf[:0], key)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if n := h.lookup(path); n != nil {
+		n.refill(h.clock.Now())
+		return n.ceilTokens / tokenScale, n.class.cburst()
+	}
+	class, _ := h.classOf(path)
+	return class.cburst(), class.cburst()
+}
+
+// Algorithm 获取算法名称
+func (h *HTB) Algorithm() string {
+	return "htb"
+}
+
+// Prune 删除空闲超过 idle 且令牌已经补满的叶子节点，返回删除的节点数
+// 按用户等高基数维度建树时应该定期调用，避免节点无限增长
+func (h *HTB) Prune(idle time.Duration) int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.prune(h.root, h.clock.Now(), idle)
+}
+
+// prune 递归删除空闲的叶子节点
+func (h *HTB) prune(n *htbNode, now time.Time, idle time.Duration) int {
+	removed := 0
+	for name, child := range n.children {
+		removed += h.prune(child, now, idle)
+		child.refill(now)
+		if len(child.children) == 0 && child.full() && now.Sub(child.lastUsed) >= idle {
+			delete(n.children, name)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Status 获取整棵树的状态
+func (h *HTB) Status() HTBStatus {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.status(h.root, h.clock.Now())
+}
+
+// status 递归生成节点状态
+func (h *HTB) status(n *htbNode, now time.Time) HTBStatus {
+	n.refill(now)
+	s := HTBStatus{
+		Name:       n.name,
+		Rate:       n.class.Rate,
+		Ceil:       n.class.ceil(),
+		Tokens:     n.tokens / tokenScale,
+		CeilTokens: n.ceilTokens / tokenScale,
+		Allowed:    n.allowed,
+		Borrowed:   n.borrowed,
+		Rejected:   n.rejected,
+	}
+	for _, child := range n.children {
+		s.Children = append(s.Children, h.status(child, now))
+	}
+	sort.Slice(s.Children, func(i, j int) bool { return s.Children[i].Name < s.Children[j].Name })
+	return s
+}
@@ -0,0 +1,126 @@
+package limit
+
+import (
+	"testing"
+	"time"
+)
+
+// TestHTB_Levels 测试每一级都会扣减
+func TestHTB_Levels(t *testing.T) {
+	// 全站10个，每个租户5个，每个用户3个
+	htb := NewHTB(HTBClass{Rate: 10}, []HTBClass{{Rate: 5}, {Rate: 3}})
+
+	for i := 0; i < 3; i++ {
+		if !htb.Allow("tenant:a", "uid:1") {
+			t.Errorf("用户的第%d个请求应该通过", i+1)
+		}
+	}
+	if htb.Allow("tenant:a", "uid:1") {
+		t.Error("超过用户限制的请求应该被拒绝")
+	}
+	for i := 0; i < 2; i++ {
+		if !htb.Allow("tenant:a", "uid:2") {
+			t.Errorf("其他用户的第%d个请求应该通过", i+1)
+		}
+	}
+	if htb.Allow("tenant:a", "uid:2") {
+		t.Error("超过租户限制的请求应该被拒绝")
+	}
+	if !htb.Allow("tenant:b", "uid:3") {
+		t.Error("其他租户不应该受影响")
+	}
+	if htb.Allow("tenant:b", "uid:3", "extra") {
+		t.Error("超过层级深度的路径应该被拒绝")
+	}
+
+	s := htb.Status()
+	if s.Allowed != 6 || len(s.Children) != 2 || s.Children[0].Name != "tenant:a" || s.Children[0].Allowed != 5 ||
+		s.Children[0].Rejected != 2 || len(s.Children[0].Children) != 2 {
+		t.Errorf("状态树错误: %+v", s)
+	}
+}
+
+// TestHTB_Borrow 测试借用上级的空闲配额
+func TestHTB_Borrow(t *testing.T) {
+	// 全站10个，每个租户保证4个，借用后最多8个
+	htb := NewHTB(HTBClass{Rate: 10}, []HTBClass{{Rate: 4, Ceil: 8}})
+	htb.SetClass(HTBClass{Rate: 4}, "tenant:b")
+
+	// 租户 b 先用完自己的保证配额
+	for i := 0; i < 4; i++ {
+		if !htb.Allow("tenant:b") {
+			t.Fatalf("租户 b 的第%d个请求应该通过", i+1)
+		}
+	}
+	if htb.Allow("tenant:b") {
+		t.Error("租户 b 不能借用")
+	}
+
+	// 租户 a 用完保证的4个后只能借到全站剩下的2个
+	allowed := 0
+	for i := 0; i < 8; i++ {
+		if htb.Allow("tenant:a") {
+			allowed++
+		}
+	}
+	if allowed != 6 {
+		t.Errorf("租户 a 只能借用全站空闲的配额: %d", allowed)
+	}
+
+	s := htb.Status()
+	a := s.Children[0]
+	if a.Name != "tenant:a" || a.Allowed != 6 || a.Borrowed != 2 || a.Rejected != 2 || a.Ceil != 8 {
+		t.Errorf("租户 a 的状态错误: %+v", a)
+	}
+	if s.CeilTokens != 0 {
+		t.Errorf("全站配额应该用完: %+v", s)
+	}
+}
+
+// TestHTB_Refill 测试令牌按速率补充
+func TestHTB_Refill(t *testing.T) {
+	htb := NewHTB(HTBClass{Rate: 100, Burst: 1}, []HTBClass{{Rate: 100, Burst: 1}})
+	if !htb.Allow("a") || htb.Allow("a") {
+		t.Fatal("突发容量为1")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if !htb.Allow("a") {
+		t.Error("等待后应该补充令牌")
+	}
+}
+
+// TestHTB_AllowKey 测试以 | 分隔的 key 作为路径
+func TestHTB_AllowKey(t *testing.T) {
+	htb := NewHTB(HTBClass{Rate: 100}, []HTBClass{{Rate: 10}, {Rate: 1}})
+	var limiter KeyedLimiter = htb
+	if !limiter.AllowKey("tenant:a|uid:1") || limiter.AllowKey("tenant:a|uid:1") {
+		t.Error("每个用户只能通过1个请求")
+	}
+	if current, capacity := limiter.GetKeyStatus("tenant:a|uid:1"); current != 0 || capacity != 1 {
+		t.Errorf("状态错误: current=%d, capacity=%d", current, capacity)
+	}
+	if current, capacity := limiter.GetKeyStatus("tenant:a"); current != 9 || capacity != 10 {
+		t.Errorf("租户状态错误: current=%d, capacity=%d", current, capacity)
+	}
+	if got := KeyedAlgorithm(limiter); got != "htb" {
+		t.Errorf("算法名称错误: %s", got)
+	}
+}
+
+// TestHTB_Prune 测试删除空闲的节点
+func TestHTB_Prune(t *testing.T) {
+	htb := NewHTB(HTBClass{Rate: 1000}, []HTBClass{{Rate: 1000, Burst: 1}, {Rate: 1000, Burst: 1}})
+	htb.Allow("tenant:a", "uid:1")
+	htb.Allow("tenant:a", "uid:2")
+
+	if n := htb.Prune(time.Hour); n != 0 {
+		t.Errorf("没有空闲的节点: %d", n)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := htb.Prune(10 * time.Millisecond); n != 3 {
+		t.Errorf("应该删除2个用户和没有子节点的租户: %d", n)
+	}
+	if s := htb.Status(); len(s.Children) != 0 {
+		t.Errorf("空闲节点应该被删除: %+v", s)
+	}
+}
@@ -0,0 +1,51 @@
+package limit
+
+import (
+	"net"
+	"net/http"
+)
+
+// KeyFunc 从请求中提取限流 key，返回 false 表示无法提取（该请求不参与限流）
+type KeyFunc func(r *http.Request) (string, bool)
+
+// RemoteAddrKey 以 r.RemoteAddr 的 IP 作为 key
+// 服务部署在负载均衡之后时应该使用 IPResolver
+func RemoteAddrKey(r *http.Request) (string, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return host, host != ""
+}
+
+// Middleware HTTP 限流中间件，被拒绝的请求返回 429
+// 限流器实现了 AllowKeyContext 时（如 limitotel.TracedKeyedLimiter）传入请求的 ctx
+// keyFunc 为 nil 时按 RemoteAddrKey 限流
+func Middleware(limiter KeyedLimiter, keyFunc KeyFunc) func(http.Handler) http.Handler {
+	if keyFunc == nil {
+		keyFunc = RemoteAddrKey
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, ok := keyFunc(r)
+			if ok && !AllowKeyContext(r.Context(), limiter, key) {
+				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// GlobalMiddleware 全局 HTTP 限流中间件，所有请求共享同一个限流器
+func GlobalMiddleware(limiter RateLimiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !AllowContext(r.Context(), limiter) {
+				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
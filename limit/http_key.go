@@ -0,0 +1,338 @@
+package limit
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// defaultIPv6PrefixLen IPv6 客户端默认按 /64 聚合，一个用户通常拥有整个 /64 网段
+const defaultIPv6PrefixLen = 64
+
+// IPResolver 解析客户端真实 IP
+// 只有直连地址属于可信代理时，才会信任 X-Forwarded-For / X-Real-IP
+type IPResolver struct {
+	trusted       []netip.Prefix // 可信代理网段（如 SLB、网关）
+	ipv6PrefixLen int            // IPv6 客户端聚合的前缀长度
+}
+
+// NewIPResolver 创建客户端 IP 解析器
+// trustedProxies: 可信代理的 CIDR 或 IP，例如 "10.0.0.0/8"、"100.64.0.1"
+func NewIPResolver(trustedProxies ...string) (*IPResolver, error) {
+	r := &IPResolver{ipv6PrefixLen: defaultIPv6PrefixLen}
+	for _, s := range trustedProxies {
+		prefix, err := parsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("limit: invalid trusted proxy %q: %w", s, err)
+		}
+		r.trusted = append(r.trusted, prefix)
+	}
+	return r, nil
+}
+
+// parsePrefix 解析 CIDR 或单个 IP
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// SetIPv6PrefixLen 设置 IPv6 客户端聚合的前缀长度，128 表示不聚合
+func (ir *IPResolver) SetIPv6PrefixLen(bits int) {
+	if bits <= 0 || bits > 128 {
+		bits = 128
+	}
+	ir.ipv6PrefixLen = bits
+}
+
+// isTrusted 判断地址是否属于可信代理
+func (ir *IPResolver) isTrusted(addr netip.Addr) bool {
+	for _, prefix := range ir.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP 解析客户端 IP
+// 从 X-Forwarded-For 右侧开始跳过可信代理，第一个不可信的地址即为客户端；
+// 没有 X-Forwarded-For 时使用 X-Real-IP
+func (ir *IPResolver) ClientIP(r *http.Request) (netip.Addr, bool) {
+	remote, ok := parseHostAddr(r.RemoteAddr)
+	if !ok {
+		return netip.Addr{}, false
+	}
+	if !ir.isTrusted(remote) {
+		return remote, true
+	}
+
+	if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		var leftmost netip.Addr
+		for i := len(hops) - 1; i >= 0; i-- {
+			addr, ok := parseHostAddr(strings.TrimSpace(hops[i]))
+			if !ok {
+				// 无法解析的地址可能是伪造的，停止继续向左信任
+				break
+			}
+			if !ir.isTrusted(addr) {
+				return addr, true
+			}
+			leftmost = addr
+		}
+		if leftmost.IsValid() {
+			return leftmost, true
+		}
+	}
+	if realIP, ok := parseHostAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ok {
+		return realIP, true
+	}
+	return remote, true
+}
+
+// Key 以客户端 IP 作为 key，IPv6 地址按前缀聚合
+func (ir *IPResolver) Key(r *http.Request) (string, bool) {
+	addr, ok := ir.ClientIP(r)
+	if !ok {
+		return "", false
+	}
+	if addr.Is6() && ir.ipv6PrefixLen < 128 {
+		prefix, err := addr.Prefix(ir.ipv6PrefixLen)
+		if err == nil {
+			return prefix.String(), true
+		}
+	}
+	return addr.String(), true
+}
+
+// parseHostAddr 解析 "ip" 或 "ip:port" 形式的地址
+func parseHostAddr(s string) (netip.Addr, bool) {
+	if s == "" {
+		return netip.Addr{}, false
+	}
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	addr, err := netip.ParseAddr(strings.Trim(s, "[]"))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap().WithZone(""), true
+}
+
+// HeaderKey 以请求头的值作为 key，请求头为空时不限流
+func HeaderKey(name string) KeyFunc {
+	return func(r *http.Request) (string, bool) {
+		v := r.Header.Get(name)
+		return v, v != ""
+	}
+}
+
+// CookieKey 以 cookie 的值作为 key，cookie 不存在时不限流
+func CookieKey(name string) KeyFunc {
+	return func(r *http.Request) (string, bool) {
+		c, err := r.Cookie(name)
+		if err != nil || c.Value == "" {
+			return "", false
+		}
+		return c.Value, true
+	}
+}
+
+// RouteKey 以路由模板作为 key，例如 "/x/v2/reply/{oid}"
+// {name} 匹配一段路径，{name...} 匹配剩余所有路径；
+// 没有模板匹配时使用 http.ServeMux 匹配到的 r.Pattern
+func RouteKey(templates ...string) KeyFunc {
+	routes := make([][]string, len(templates))
+	for i, tpl := range templates {
+		routes[i] = splitPath(tpl)
+	}
+	return func(r *http.Request) (string, bool) {
+		segments := splitPath(r.URL.Path)
+		for i, route := range routes {
+			if matchRoute(route, segments) {
+				return templates[i], true
+			}
+		}
+		return r.Pattern, r.Pattern != ""
+	}
+}
+
+// splitPath 按 "/" 切分路径
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// matchRoute 判断路径是否匹配路由模板
+func matchRoute(route, segments []string) bool {
+	for i, part := range route {
+		isWildcard := strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}")
+		if isWildcard && strings.HasSuffix(part, "...}") {
+			return true
+		}
+		if i >= len(segments) {
+			return false
+		}
+		if !isWildcard && part != segments[i] {
+			return false
+		}
+	}
+	return len(route) == len(segments)
+}
+
+// keyEscaper 转义组合 key 各部分中的 % 和分隔符 |
+var keyEscaper = strings.NewReplacer("%", "%25", "|", "%7C")
+
+// CompositeKey 组合多个 key，例如 uid+route，任意一部分无法提取时不限流
+// 各部分用 | 连接，部分中的 % 和 | 会被转义：请求头、cookie 的值来自客户端，
+// 不转义时 "a|b"+"c" 和 "a"+"b|c" 会得到同一个 key，一个客户端可以消耗另一个客户端的配额；
+// 转义后 HTB.AllowKey 按 | 拆分出的层级也和组合的各部分一一对应
+func CompositeKey(funcs ...KeyFunc) KeyFunc {
+	return func(r *http.Request) (string, bool) {
+		parts := make([]string, len(funcs))
+		for i, fn := range funcs {
+			v, ok := fn(r)
+			if !ok {
+				return "", false
+			}
+			parts[i] = keyEscaper.Replace(v)
+		}
+		return strings.Join(parts, "|"), true
+	}
+}
+
+// KeyParser 根据文本描述创建 KeyFunc，便于在配置文件中书写规则
+// 支持 "ip"、"route"、"header:<name>"、"cookie:<name>"、自定义别名，
+// 以及用 "+" 连接的组合 key，例如 "uid+route"
+type KeyParser struct {
+	Resolver *IPResolver        // "ip" 使用的解析器，为 nil 时使用 RemoteAddrKey
+	Routes   []string           // "route" 使用的路由模板
+	Aliases  map[string]KeyFunc // 自定义别名，例如 "uid" -> CookieKey("DedeUserID")
+}
+
+// Parse 解析 key 描述
+func (p *KeyParser) Parse(spec string) (KeyFunc, error) {
+	parts := strings.Split(spec, "+")
+	funcs := make([]KeyFunc, 0, len(parts))
+	for _, part := range parts {
+		fn, err := p.parseOne(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		funcs = append(funcs, fn)
+	}
+	if len(funcs) == 1 {
+		return funcs[0], nil
+	}
+	return CompositeKey(funcs...), nil
+}
+
+// parseOne 解析单个 key 描述
+func (p *KeyParser) parseOne(spec string) (KeyFunc, error) {
+	if fn, ok := p.Aliases[spec]; ok {
+		return fn, nil
+	}
+	kind, arg, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "ip":
+		if p.Resolver == nil {
+			return RemoteAddrKey, nil
+		}
+		return p.Resolver.Key, nil
+	case "route":
+		return RouteKey(p.Routes...), nil
+	case "header":
+		if arg == "" {
+			return nil, fmt.Errorf("limit: key %q: missing header name", spec)
+		}
+		return HeaderKey(arg), nil
+	case "cookie":
+		if arg == "" {
+			return nil, fmt.Errorf("limit: key %q: missing cookie name", spec)
+		}
+		return CookieKey(arg), nil
+	default:
+		return nil, fmt.Errorf("limit: unknown key %q", spec)
+	}
+}
+
+// KeyRules 按路径前缀选择 key 提取规则，最长前缀优先
+// 前缀按路径段匹配："/api" 匹配 "/api" 和 "/api/users"，不匹配 "/apix"
+type KeyRules struct {
+	rules    []keyRule
+	fallback KeyFunc
+}
+
+// keyRule 单条路径前缀规则
+type keyRule struct {
+	prefix string
+	key    KeyFunc
+}
+
+// NewKeyRules 创建 key 规则集合
+// fallback: 没有前缀匹配时使用的规则，为 nil 时不限流
+func NewKeyRules(fallback KeyFunc) *KeyRules {
+	return &KeyRules{fallback: fallback}
+}
+
+// ParseKeyRules 根据“路径前缀 -> key 描述”创建规则集合，空前缀作为兜底规则
+func ParseKeyRules(parser *KeyParser, specs map[string]string) (*KeyRules, error) {
+	kr := NewKeyRules(nil)
+	for prefix, spec := range specs {
+		fn, err := parser.Parse(spec)
+		if err != nil {
+			return nil, fmt.Errorf("rule for prefix %q: %w", prefix, err)
+		}
+		if prefix == "" {
+			kr.fallback = fn
+			continue
+		}
+		kr.Add(prefix, fn)
+	}
+	return kr, nil
+}
+
+// Add 添加路径前缀规则
+func (kr *KeyRules) Add(prefix string, key KeyFunc) *KeyRules {
+	kr.rules = append(kr.rules, keyRule{prefix: prefix, key: key})
+	sort.SliceStable(kr.rules, func(i, j int) bool {
+		return len(kr.rules[i].prefix) > len(kr.rules[j].prefix)
+	})
+	return kr
+}
+
+// Key 按最长前缀匹配的规则提取 key，可以直接作为 KeyFunc 使用
+func (kr *KeyRules) Key(r *http.Request) (string, bool) {
+	for _, rule := range kr.rules {
+		if hasPathPrefix(r.URL.Path, rule.prefix) {
+			return rule.key(r)
+		}
+	}
+	if kr.fallback == nil {
+		return "", false
+	}
+	return kr.fallback(r)
+}
+
+// hasPathPrefix 判断 path 是否以 prefix 开头，且 prefix 在路径段的边界结束
+func hasPathPrefix(path, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return len(path) == len(prefix) || strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/'
+}
@@ -0,0 +1,184 @@
+package limit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newKeyRequest 构造测试请求
+func newKeyRequest(path, remoteAddr string, headers map[string]string) *http.Request {
+	req := httptest.NewRequest("GET", path, nil)
+	req.RemoteAddr = remoteAddr
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	return req
+}
+
+// TestIPResolver_TrustedProxy 测试可信代理下解析客户端 IP
+func TestIPResolver_TrustedProxy(t *testing.T) {
+	resolver, err := NewIPResolver("10.0.0.0/8", "100.64.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name    string
+		remote  string
+		headers map[string]string
+		want    string
+	}{
+		{"直连客户端", "8.8.8.8:1234", nil, "8.8.8.8"},
+		{"不可信来源伪造XFF", "8.8.8.8:1234", map[string]string{"X-Forwarded-For": "1.2.3.4"}, "8.8.8.8"},
+		{"经过SLB", "10.1.2.3:80", map[string]string{"X-Forwarded-For": "1.2.3.4"}, "1.2.3.4"},
+		{"多级代理", "10.1.2.3:80", map[string]string{"X-Forwarded-For": "6.6.6.6, 1.2.3.4, 100.64.0.1"}, "1.2.3.4"},
+		{"X-Real-IP", "10.1.2.3:80", map[string]string{"X-Real-IP": "5.6.7.8"}, "5.6.7.8"},
+		{"XFF全部可信", "10.1.2.3:80", map[string]string{"X-Forwarded-For": "10.9.9.9"}, "10.9.9.9"},
+		{"没有转发头", "10.1.2.3:80", nil, "10.1.2.3"},
+		{"IPv4映射地址", "[::ffff:8.8.4.4]:1234", nil, "8.8.4.4"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			key, ok := resolver.Key(newKeyRequest("/", tc.remote, tc.headers))
+			if !ok || key != tc.want {
+				t.Errorf("客户端 IP 错误: %q, 期望 %q", key, tc.want)
+			}
+		})
+	}
+}
+
+// TestIPResolver_IPv6Prefix 测试 IPv6 客户端按 /64 聚合
+func TestIPResolver_IPv6Prefix(t *testing.T) {
+	resolver, _ := NewIPResolver()
+
+	a, _ := resolver.Key(newKeyRequest("/", "[2001:db8:1:2::1]:443", nil))
+	b, _ := resolver.Key(newKeyRequest("/", "[2001:db8:1:2:ffff::9]:443", nil))
+	c, _ := resolver.Key(newKeyRequest("/", "[2001:db8:1:3::1]:443", nil))
+	if a != "2001:db8:1:2::/64" || a != b {
+		t.Errorf("同一个 /64 应该得到相同的 key: %q, %q", a, b)
+	}
+	if a == c {
+		t.Errorf("不同的 /64 应该得到不同的 key: %q", c)
+	}
+
+	resolver.SetIPv6PrefixLen(128)
+	if key, _ := resolver.Key(newKeyRequest("/", "[2001:db8:1:2::1]:443", nil)); key != "2001:db8:1:2::1" {
+		t.Errorf("不聚合时应该返回完整地址: %q", key)
+	}
+}
+
+// TestNewIPResolver_Invalid 测试非法的可信代理配置
+func TestNewIPResolver_Invalid(t *testing.T) {
+	if _, err := NewIPResolver("10.0.0.0/33"); err == nil {
+		t.Error("非法 CIDR 应该返回错误")
+	}
+	if _, err := NewIPResolver("slb"); err == nil {
+		t.Error("非法 IP 应该返回错误")
+	}
+}
+
+// TestRouteKey 测试路由模板匹配
+func TestRouteKey(t *testing.T) {
+	key := RouteKey("/x/v2/reply/{oid}", "/video/{bvid}/like", "/static/{path...}")
+
+	testCases := map[string]string{
+		"/x/v2/reply/123":     "/x/v2/reply/{oid}",
+		"/video/BV1xx/like":   "/video/{bvid}/like",
+		"/static/js/app.js":   "/static/{path...}",
+		"/x/v2/reply/123/sub": "",
+		"/video/BV1xx":        "",
+	}
+	for path, want := range testCases {
+		got, ok := key(newKeyRequest(path, "1.1.1.1:1", nil))
+		if got != want || ok != (want != "") {
+			t.Errorf("%s 匹配错误: %q, 期望 %q", path, got, want)
+		}
+	}
+}
+
+// TestRouteKey_ServeMuxPattern 测试回退到 ServeMux 的路由模式
+func TestRouteKey_ServeMuxPattern(t *testing.T) {
+	var got string
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /space/{mid}", func(w http.ResponseWriter, r *http.Request) {
+		got, _ = RouteKey()(r)
+	})
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/space/42", nil))
+	if got != "GET /space/{mid}" {
+		t.Errorf("应该使用 ServeMux 的路由模式: %q", got)
+	}
+}
+
+// TestKeyParser_Composite 测试组合 key
+func TestKeyParser_Composite(t *testing.T) {
+	parser := &KeyParser{
+		Routes:  []string{"/x/v2/reply/{oid}"},
+		Aliases: map[string]KeyFunc{"uid": CookieKey("DedeUserID")},
+	}
+	key, err := parser.Parse("uid+route")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := newKeyRequest("/x/v2/reply/1", "1.1.1.1:1", nil)
+	if _, ok := key(req); ok {
+		t.Error("未登录用户没有 uid，不应该提取到 key")
+	}
+	req.AddCookie(&http.Cookie{Name: "DedeUserID", Value: "42"})
+	if got, ok := key(req); !ok || got != "42|/x/v2/reply/{oid}" {
+		t.Errorf("组合 key 错误: %q", got)
+	}
+
+	// 来自客户端的值中的分隔符被转义，不同的组合不会得到同一个 key
+	header := CompositeKey(HeaderKey("X-A"), HeaderKey("X-B"))
+	first := newKeyRequest("/", "1.1.1.1:1", map[string]string{"X-A": "a|b", "X-B": "c"})
+	second := newKeyRequest("/", "1.1.1.1:1", map[string]string{"X-A": "a", "X-B": "b|c"})
+	k1, _ := header(first)
+	k2, _ := header(second)
+	if k1 == k2 || k1 != "a%7Cb|c" || k2 != "a|b%7Cc" {
+		t.Errorf("组合 key 应该转义分隔符: %q %q", k1, k2)
+	}
+
+	for _, spec := range []string{"header:", "cookie", "uid+bogus"} {
+		if _, err := parser.Parse(spec); err == nil {
+			t.Errorf("%q 应该解析失败", spec)
+		}
+	}
+}
+
+// TestKeyRules 测试按路径前缀选择规则
+func TestKeyRules(t *testing.T) {
+	parser := &KeyParser{}
+	rules, err := ParseKeyRules(parser, map[string]string{
+		"":              "ip",
+		"/x/v2/":        "header:X-Uid",
+		"/x/v2/upload/": "header:X-Uid+ip",
+		"/api":          "header:X-Uid",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headers := map[string]string{"X-Uid": "7"}
+	testCases := []struct {
+		path string
+		want string
+	}{
+		{"/index", "9.9.9.9"},
+		{"/x/v2/reply", "7"},
+		{"/x/v2/upload/video", "7|9.9.9.9"},
+		{"/api", "7"},
+		{"/api/users", "7"},
+		{"/apix", "9.9.9.9"}, // 前缀按路径段匹配
+	}
+	for _, tc := range testCases {
+		if got, _ := rules.Key(newKeyRequest(tc.path, "9.9.9.9:1", headers)); got != tc.want {
+			t.Errorf("%s 的 key 错误: %q, 期望 %q", tc.path, got, tc.want)
+		}
+	}
+
+	if _, err := ParseKeyRules(parser, map[string]string{"/a": "nope"}); err == nil {
+		t.Error("非法规则应该返回错误")
+	}
+}
@@ -0,0 +1,70 @@
+package limit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// okHandler 总是返回 200 的 handler
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+// TestMiddleware_RemoteAddr 测试默认按 RemoteAddr 限流
+func TestMiddleware_RemoteAddr(t *testing.T) {
+	registry := NewKeyedRegistry(func(key string) RateLimiter {
+		return NewFixedWindowCounter(1, time.Second)
+	})
+	defer registry.Stop()
+	handler := Middleware(registry, nil)(okHandler)
+
+	codes := make([]int, 0, 3)
+	for _, addr := range []string{"1.1.1.1:1000", "1.1.1.1:2000", "2.2.2.2:1000"} {
+		req := httptest.NewRequest("GET", "/x/v2/reply", nil)
+		req.RemoteAddr = addr
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		codes = append(codes, rec.Code)
+	}
+
+	// 同一个 IP 不同端口共享限额
+	want := []int{http.StatusOK, http.StatusTooManyRequests, http.StatusOK}
+	for i := range want {
+		if codes[i] != want[i] {
+			t.Errorf("第%d个请求状态码错误: %d, 期望 %d", i+1, codes[i], want[i])
+		}
+	}
+}
+
+// TestMiddleware_NoKey 测试无法提取 key 的请求不限流
+func TestMiddleware_NoKey(t *testing.T) {
+	registry := NewKeyedRegistry(func(key string) RateLimiter {
+		return NewFixedWindowCounter(0, time.Second)
+	})
+	defer registry.Stop()
+	handler := Middleware(registry, HeaderKey("X-Uid"))(okHandler)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("没有 key 的请求不应该被限流: %d", rec.Code)
+	}
+	if registry.Len() != 0 {
+		t.Errorf("没有 key 的请求不应该创建限流器: %d", registry.Len())
+	}
+}
+
+// TestGlobalMiddleware 测试全局限流中间件
+func TestGlobalMiddleware(t *testing.T) {
+	handler := GlobalMiddleware(NewFixedWindowCounter(1, time.Second))(okHandler)
+
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		if rec.Code != want {
+			t.Errorf("第%d个请求状态码错误: %d, 期望 %d", i+1, rec.Code, want)
+		}
+	}
+}
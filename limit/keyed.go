@@ -0,0 +1,264 @@
+package limit
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// KeyedLimiter 按 key 区分的限流器接口（例如按用户、按 IP 限流）
+type KeyedLimiter interface {
+	AllowKey(key string) bool
+	GetKeyStatus(key string) (int64, int64)
+}
+
+// KeyedRegistry 按 key 懒创建限流器，每个 key 拥有独立的限流器实例
+// key 来自请求（如 IP、用户 ID）时数量没有上限，需要定期调用 EvictIdle 清理长时间没有访问的 key，
+// 或者通过 WithMaxKeys 限制 key 的数量
+type KeyedRegistry struct {
+	factory func(key string) RateLimiter // 创建 key 对应限流器的工厂函数
+	entries map[string]*keyedEntry       // key 到限流器的映射
+	config  *Config                      // 按配置创建时的配置，可在运行时调整
+	clock   Clock                        // 记录 key 最后访问时间的时钟
+	maxKeys int                          // 最多保存的 key 数，0 表示不限制
+	mutex   sync.RWMutex                 // 读写锁
+}
+
+// keyedEntry key 对应的限流器和最后访问时间
+type keyedEntry struct {
+	limiter  RateLimiter  // 限流器
+	lastUsed atomic.Int64 // 最后访问的时间（UnixNano）
+}
+
+// touch 更新最后访问时间，变化不到1ms时不写入，减少并发访问同一个 key 时的缓存行争用
+func (e *keyedEntry) touch(now int64) {
+	if now-e.lastUsed.Load() >= int64(time.Millisecond) {
+		e.lastUsed.Store(now)
+	}
+}
+
+// NewKeyedRegistry 创建按 key 区分的限流器集合
+// factory: 第一次见到某个 key 时调用，创建该 key 的限流器
+// opts: 支持 WithClock（记录 key 最后访问时间）和 WithMaxKeys
+func NewKeyedRegistry(factory func(key string) RateLimiter, opts ...Option) *KeyedRegistry {
+	o := newOptions(opts)
+	return &KeyedRegistry{
+		factory: factory,
+		entries: make(map[string]*keyedEntry),
+		clock:   o.clock,
+		maxKeys: o.maxKeys,
+	}
+}
+
+// NewKeyedRegistryFromConfig 按配置为每个 key 创建限流器，opts 同时传给每个 key 的限流器
+func NewKeyedRegistryFromConfig(c Config, opts ...Option) (*KeyedRegistry, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	r := NewKeyedRegistry(nil, opts...)
+	r.config = &c
+	// factory 只会在持有锁时调用，可以直接读取 config
+	r.factory = func(key string) RateLimiter {
+		limiter, _ := NewFromConfig(*r.config, opts...)
+		return limiter
+	}
+	return r, nil
+}
+
+// Config 获取按配置创建时的当前配置
+func (r *KeyedRegistry) Config() (Config, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if r.config == nil {
+		return Config{}, false
+	}
+	return *r.config, true
+}
+
+// SetConfig 调整配置：新 key 使用新配置，已有 key 的限流器原地调整参数
+func (r *KeyedRegistry) SetConfig(c Config) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.config == nil {
+		return errors.New("limit: keyed registry was not created from a config")
+	}
+	if c.Algorithm != r.config.Algorithm {
+		return fmt.Errorf("limit: cannot change algorithm from %s to %s", r.config.Algorithm, c.Algorithm)
+	}
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	for _, e := range r.entries {
+		if err := Reconfigure(e.limiter, c); err != nil {
+			return err
+		}
+	}
+	r.config = &c
+	return nil
+}
+
+// SetMaxKeys 调整最多保存的 key 数，0 表示不限制；超出新上限的已有 key 不会被删除，只是不再创建新 key
+func (r *KeyedRegistry) SetMaxKeys(n int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.maxKeys = max(n, 0)
+}
+
+// Get 获取 key 对应的限流器，不存在时创建
+// key 数达到 WithMaxKeys 的上限时不再创建，返回拒绝所有请求的限流器
+func (r *KeyedRegistry) Get(key string) RateLimiter {
+	now := r.clock.Now().UnixNano()
+	r.mutex.RLock()
+	e, ok := r.entries[key]
+	r.mutex.RUnlock()
+	if ok {
+		e.touch(now)
+		return e.limiter
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	// 双重检查，避免并发创建
+	if e, ok = r.entries[key]; ok {
+		e.touch(now)
+		return e.limiter
+	}
+	if r.maxKeys > 0 && len(r.entries) >= r.maxKeys {
+		return rejectAll{}
+	}
+	e = &keyedEntry{limiter: r.factory(key)}
+	e.lastUsed.Store(now)
+	r.entries[key] = e
+	return e.limiter
+}
+
+// Lookup 获取 key 对应的限流器，不存在时不创建，也不更新最后访问时间
+func (r *KeyedRegistry) Lookup(key string) (RateLimiter, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if e, ok := r.entries[key]; ok {
+		return e.limiter, true
+	}
+	return nil, false
+}
+
+// AllowKey 检查 key 的请求是否允许通过
+func (r *KeyedRegistry) AllowKey(key string) bool {
+	return r.Get(key).Allow()
+}
+
+// GetKeyStatus 获取 key 对应限流器的状态
+// key 不存在时返回新建限流器的初始状态，临时创建的限流器不会保存，查询不会产生新的 key
+func (r *KeyedRegistry) GetKeyStatus(key string) (int64, int64) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if e, ok := r.entries[key]; ok {
+		return e.limiter.GetStatus()
+	}
+	limiter := r.factory(key)
+	defer stopLimiter(limiter)
+	return limiter.GetStatus()
+}
+
+// EvictIdle 删除超过 idle 没有访问的 key 并停止它们的限流器，返回删除的数量
+// 被删除的 key 再次访问时重新创建，限流状态从头开始，所以 idle 应该不小于限流的窗口
+func (r *KeyedRegistry) EvictIdle(idle time.Duration) int {
+	cutoff := r.clock.Now().Add(-idle).UnixNano()
+	var evicted []RateLimiter
+	r.mutex.Lock()
+	for key, e := range r.entries {
+		if e.lastUsed.Load() <= cutoff {
+			delete(r.entries, key)
+			evicted = append(evicted, e.limiter)
+		}
+	}
+	r.mutex.Unlock()
+
+	for _, limiter := range evicted {
+		stopLimiter(limiter)
+	}
+	return len(evicted)
+}
+
+// Keys 获取当前所有的 key（已排序）
+func (r *KeyedRegistry) Keys() []string {
+	r.mutex.RLock()
+	keys := make([]string, 0, len(r.entries))
+	for key := range r.entries {
+		keys = append(keys, key)
+	}
+	r.mutex.RUnlock()
+
+	sort.Strings(keys)
+	return keys
+}
+
+// Len 获取当前 key 的数量
+func (r *KeyedRegistry) Len() int {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return len(r.entries)
+}
+
+// Reset 重置 key 的限流状态，下次访问时重新创建
+func (r *KeyedRegistry) Reset(key string) {
+	r.mutex.Lock()
+	e, ok := r.entries[key]
+	delete(r.entries, key)
+	r.mutex.Unlock()
+
+	if ok {
+		stopLimiter(e.limiter)
+	}
+}
+
+// Algorithm 获取 key 限流器使用的算法，还没有任何 key 时返回空字符串
+func (r *KeyedRegistry) Algorithm() string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if r.config != nil {
+		return r.config.Algorithm
+	}
+	for _, e := range r.entries {
+		return Algorithm(e.limiter)
+	}
+	return ""
+}
+
+// Stop 停止所有 key 的限流器
+func (r *KeyedRegistry) Stop() {
+	r.mutex.Lock()
+	entries := r.entries
+	r.entries = make(map[string]*keyedEntry)
+	r.mutex.Unlock()
+
+	for _, e := range entries {
+		stopLimiter(e.limiter)
+	}
+}
+
+// rejectAll 拒绝所有请求的限流器，KeyedRegistry 的 key 数达到上限时使用
+type rejectAll struct{}
+
+// Allow 拒绝请求
+func (rejectAll) Allow() bool { return false }
+
+// AllowN 拒绝请求
+func (rejectAll) AllowN(int64) bool { return false }
+
+// GetStatus 没有配额
+func (rejectAll) GetStatus() (int64, int64) { return 0, 0 }
+
+// KeyedAlgorithm 获取 key 限流器使用的算法，无法确定时返回 "keyed"
+func KeyedAlgorithm(l KeyedLimiter) string {
+	if a, ok := l.(interface{ Algorithm() string }); ok {
+		if name := a.Algorithm(); name != "" {
+			return name
+		}
+	}
+	return "keyed"
+}
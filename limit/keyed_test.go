@@ -0,0 +1,165 @@
+package limit
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestKeyedRegistry_Basic 测试不同 key 的限流相互独立
+func TestKeyedRegistry_Basic(t *testing.T) {
+	registry := NewKeyedRegistry(func(key string) RateLimiter {
+		return NewFixedWindowCounter(2, time.Second)
+	})
+	defer registry.Stop()
+
+	// 每个 key 各自可以通过2个请求
+	for _, key := range []string{"uid:1", "uid:2"} {
+		for i := 0; i < 2; i++ {
+			if !registry.AllowKey(key) {
+				t.Errorf("%s 的第%d个请求应该通过", key, i+1)
+			}
+		}
+		if registry.AllowKey(key) {
+			t.Errorf("%s 的第3个请求应该被拒绝", key)
+		}
+	}
+
+	current, limit := registry.GetKeyStatus("uid:1")
+	if current != 2 || limit != 2 {
+		t.Errorf("状态错误: current=%d, limit=%d", current, limit)
+	}
+	if keys := registry.Keys(); len(keys) != 2 || keys[0] != "uid:1" || keys[1] != "uid:2" {
+		t.Errorf("key 列表错误: %v", keys)
+	}
+	if registry.Algorithm() != "fixed_window" {
+		t.Errorf("算法名称错误: %s", registry.Algorithm())
+	}
+}
+
+// TestKeyedRegistry_Reset 测试重置 key
+func TestKeyedRegistry_Reset(t *testing.T) {
+	registry := NewKeyedRegistry(func(key string) RateLimiter {
+		return NewTokenBucket(1, 1)
+	})
+	defer registry.Stop()
+
+	registry.AllowKey("ip:1.1.1.1")
+	if registry.AllowKey("ip:1.1.1.1") {
+		t.Error("令牌耗尽后请求应该被拒绝")
+	}
+
+	registry.Reset("ip:1.1.1.1")
+	if _, ok := registry.Lookup("ip:1.1.1.1"); ok {
+		t.Error("重置后 key 应该被删除")
+	}
+	if !registry.AllowKey("ip:1.1.1.1") {
+		t.Error("重置后请求应该通过")
+	}
+}
+
+// TestKeyedRegistry_Concurrent 测试并发创建同一个 key 只生成一个限流器
+func TestKeyedRegistry_Concurrent(t *testing.T) {
+	var created int
+	var mu sync.Mutex
+	registry := NewKeyedRegistry(func(key string) RateLimiter {
+		mu.Lock()
+		created++
+		mu.Unlock()
+		return NewFixedWindowCounter(50, time.Second)
+	})
+	defer registry.Stop()
+
+	var wg sync.WaitGroup
+	var allowed int64
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if registry.AllowKey("same") {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if created != 1 {
+		t.Errorf("同一个 key 应该只创建一次限流器，实际 %d 次", created)
+	}
+	if allowed != 50 {
+		t.Errorf("并发下通过的请求数应该为50，实际 %d", allowed)
+	}
+}
+
+// TestKeyedRegistry_GetKeyStatus 测试查询不存在的 key 不会创建限流器
+func TestKeyedRegistry_GetKeyStatus(t *testing.T) {
+	registry := NewKeyedRegistry(func(key string) RateLimiter {
+		return NewFixedWindowCounter(5, time.Second)
+	})
+	defer registry.Stop()
+
+	if current, limit := registry.GetKeyStatus("uid:1"); current != 0 || limit != 5 {
+		t.Errorf("不存在的 key 应该返回初始状态: current=%d, limit=%d", current, limit)
+	}
+	if registry.Len() != 0 {
+		t.Errorf("查询不应该创建 key: %v", registry.Keys())
+	}
+}
+
+// TestKeyedRegistry_EvictIdle 测试清理长时间没有访问的 key
+func TestKeyedRegistry_EvictIdle(t *testing.T) {
+	clock := newManualClock()
+	registry := NewKeyedRegistry(func(key string) RateLimiter {
+		return NewFixedWindowCounter(1, time.Second)
+	}, WithClock(clock))
+	defer registry.Stop()
+
+	registry.AllowKey("a")
+	registry.AllowKey("b")
+	clock.Sleep(time.Minute)
+	// a 被再次访问，不会被清理
+	registry.AllowKey("a")
+	clock.Sleep(30 * time.Second)
+
+	if n := registry.EvictIdle(time.Minute); n != 1 {
+		t.Errorf("应该清理1个 key，实际 %d", n)
+	}
+	if keys := registry.Keys(); len(keys) != 1 || keys[0] != "a" {
+		t.Errorf("剩余的 key 错误: %v", keys)
+	}
+	// 只读查询不更新访问时间
+	registry.Lookup("a")
+	registry.GetKeyStatus("a")
+	clock.Sleep(time.Minute)
+	if n := registry.EvictIdle(time.Minute); n != 1 || registry.Len() != 0 {
+		t.Errorf("a 应该被清理: n=%d, keys=%v", n, registry.Keys())
+	}
+}
+
+// TestKeyedRegistry_MaxKeys 测试 key 数达到上限后拒绝新 key
+func TestKeyedRegistry_MaxKeys(t *testing.T) {
+	registry := NewKeyedRegistry(func(key string) RateLimiter {
+		return NewFixedWindowCounter(10, time.Second)
+	}, WithMaxKeys(2))
+	defer registry.Stop()
+
+	if !registry.AllowKey("a") || !registry.AllowKey("b") {
+		t.Fatal("上限以内的 key 应该通过")
+	}
+	if registry.AllowKey("c") {
+		t.Error("超过上限的新 key 应该被拒绝")
+	}
+	if !registry.AllowKey("a") {
+		t.Error("已有的 key 不受上限影响")
+	}
+	if registry.Len() != 2 {
+		t.Errorf("超过上限时不应该创建 key: %v", registry.Keys())
+	}
+
+	registry.Reset("b")
+	if !registry.AllowKey("c") {
+		t.Error("有空位后新 key 应该通过")
+	}
+}
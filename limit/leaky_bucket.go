@@ -1,6 +1,7 @@
 package limit
 
 import (
+	"context"
 	"sync"
 	"time"
 )
@@ -13,17 +14,20 @@ type LeakyBucket struct {
 	capacity int64         // 桶容量（最大允许排队请求数）
 	rate     time.Duration // 漏水速率（每个请求的处理间隔）
 	lastTime time.Time     // 上一次请求的理论结束时间（水位线）
+	clock    Clock         // 时钟
 	mutex    sync.Mutex    // 互斥锁
 }
 
 // NewLeakyBucket 创建新的漏桶
 // capacity: 桶容量
 // leakRate: 漏桶速率，例如 100 表示每100毫秒漏一个令牌
-func NewLeakyBucket(capacity int64, leakRate time.Duration) *LeakyBucket {
+func NewLeakyBucket(capacity int64, leakRate time.Duration, opts ...Option) *LeakyBucket {
+	o := newOptions(opts)
 	return &LeakyBucket{
 		capacity: capacity,
 		rate:     leakRate,
-		lastTime: time.Now(),
+		lastTime: o.clock.Now(),
+		clock:    o.clock,
 	}
 }
 
@@ -36,29 +40,92 @@ func (lb *LeakyBucket) Allow() bool {
 
 // AllowN 尝试向桶中添加 n 个请求
 func (lb *LeakyBucket) AllowN(n int64) bool {
+	_, wait, ok := lb.reserve(n)
+	if !ok {
+		return false
+	}
+	// 在锁外阻塞，避免后续请求排队等锁而无法被拒绝
+	if wait > 0 {
+		lb.clock.Sleep(wait)
+	}
+	return true
+}
+
+// reserve 为 n 个请求预留漏出时间，返回预留的结束时间和需要等待的时间，桶满时返回 false
+func (lb *LeakyBucket) reserve(n int64) (end time.Time, wait time.Duration, ok bool) {
 	lb.mutex.Lock()
 	defer lb.mutex.Unlock()
 
-	now := time.Now()
+	now := lb.clock.Now()
 	if now.After(lb.lastTime) {
 		lb.lastTime = now
 	}
-	increment := lb.rate * time.Duration(n)
-	newLastTime := lb.lastTime.Add(increment)
+	newLastTime := lb.lastTime.Add(lb.rate * time.Duration(n))
 	// 检查是否超过容量
 	maxWait := lb.rate * time.Duration(lb.capacity)
 	if newLastTime.Sub(now) > maxWait {
-		return false
+		return time.Time{}, 0, false
 	}
-	// 计算当前请求需要等待的时间（排在前面的请求处理完的时间）
-	waitTime := lb.lastTime.Sub(now)
+	// 需要等待的时间（排在前面的请求处理完的时间）
+	wait = lb.lastTime.Sub(now)
 	lb.lastTime = newLastTime
-	// 如果需要等待，则阻塞
-	if waitTime > 0 {
-		time.Sleep(waitTime)
+	return newLastTime, wait, true
+}
+
+// cancel 取消结束时间为 end 的 n 个请求的预留，之后已经有其他请求排队时无法取消
+func (lb *LeakyBucket) cancel(end time.Time, n int64) {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+	if lb.lastTime.Equal(end) {
+		lb.lastTime = lb.lastTime.Add(-lb.rate * time.Duration(n))
 	}
+}
 
-	return true
+// Permits 返回按漏出速率发放许可的 channel，适合 for range 的流水线写法
+// 每个许可占用一个排队位置，与并发的 Allow 调用共享同一个桶；桶满时等待一个漏出间隔后重试
+// 发放 n 个许可（n <= 0 时不限数量）或 ctx 结束后关闭 channel
+func (lb *LeakyBucket) Permits(ctx context.Context, n int64) <-chan time.Time {
+	ch := make(chan time.Time)
+	go func() {
+		defer close(ch)
+		for i := int64(0); n <= 0 || i < n; i++ {
+			for {
+				end, wait, ok := lb.reserve(1)
+				if !ok {
+					if sleepContext(ctx, lb.clock, lb.interval()) != nil {
+						return
+					}
+					continue
+				}
+				if sleepContext(ctx, lb.clock, wait) != nil {
+					lb.cancel(end, 1)
+					return
+				}
+				break
+			}
+			select {
+			case ch <- lb.clock.Now():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// interval 当前的漏出间隔
+func (lb *LeakyBucket) interval() time.Duration {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+	return lb.rate
+}
+
+// SetRate 调整桶容量和漏水速率，已经排队的请求不受影响
+func (lb *LeakyBucket) SetRate(capacity int64, leakRate time.Duration) {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+	lb.capacity = capacity
+	lb.rate = leakRate
 }
 
 // GetStatus 获取当前桶的状态
@@ -68,7 +135,7 @@ func (lb *LeakyBucket) GetStatus() (current int64, capacity int64) {
 	lb.mutex.Lock()
 	defer lb.mutex.Unlock()
 
-	now := time.Now()
+	now := lb.clock.Now()
 	if now.After(lb.lastTime) {
 		return 0, lb.capacity
 	}
@@ -88,3 +155,55 @@ func (lb *LeakyBucket) GetStatus() (current int64, capacity int64) {
 
 // Stop 停止漏桶
 func (lb *LeakyBucket) Stop() {}
+
+// LeakyBucketPolicer 监管（policing）模式的漏桶
+// 和 LeakyBucket 使用相同的水位计量，但不阻塞调用方：桶满时拒绝，否则立即放行，并返回请求在整形模式下需要排队的时间
+// 适合 API 网关这类不能挂起请求的场景，调用方可以把排队时间作为 Retry-After 或降级的依据
+type LeakyBucketPolicer struct {
+	bucket *LeakyBucket
+}
+
+// NewLeakyBucketPolicer 创建监管模式的漏桶，参数与 NewLeakyBucket 相同
+func NewLeakyBucketPolicer(capacity int64, leakRate time.Duration, opts ...Option) *LeakyBucketPolicer {
+	return &LeakyBucketPolicer{bucket: NewLeakyBucket(capacity, leakRate, opts...)}
+}
+
+// Allow 检查是否允许请求通过，不阻塞
+func (lp *LeakyBucketPolicer) Allow() bool {
+	return lp.AllowN(1)
+}
+
+// AllowN 检查是否允许 n 个请求通过，不阻塞
+func (lp *LeakyBucketPolicer) AllowN(n int64) bool {
+	_, ok := lp.Police(n)
+	return ok
+}
+
+// Police 判定 n 个请求，放行时返回它们在整形模式下需要排队的时间，桶满时返回 false
+func (lp *LeakyBucketPolicer) Police(n int64) (time.Duration, bool) {
+	_, wait, ok := lp.bucket.reserve(n)
+	return wait, ok
+}
+
+// SetRate 调整桶容量和漏水速率
+func (lp *LeakyBucketPolicer) SetRate(capacity int64, leakRate time.Duration) {
+	lp.bucket.SetRate(capacity, leakRate)
+}
+
+// GetStatus 获取当前桶的状态
+func (lp *LeakyBucketPolicer) GetStatus() (current int64, capacity int64) {
+	return lp.bucket.GetStatus()
+}
+
+// Algorithm 获取算法名称，计量方式和漏桶相同
+func (lp *LeakyBucketPolicer) Algorithm() string {
+	return "leaky_bucket"
+}
+
+// Unwrap 获取内部的漏桶，用于 ConfigOf / Reconfigure
+func (lp *LeakyBucketPolicer) Unwrap() RateLimiter {
+	return lp.bucket
+}
+
+// Stop 停止漏桶
+func (lp *LeakyBucketPolicer) Stop() {}
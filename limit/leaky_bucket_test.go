@@ -1,6 +1,7 @@
 package limit
 
 import (
+	"context"
 	"sync"
 	"testing"
 	"time"
@@ -142,3 +143,74 @@ func BenchmarkLeakyBucket_Allow(b *testing.B) {
 		bucket.Allow()
 	}
 }
+
+// TestLeakyBucket_Permits 测试按漏出速率发放许可
+func TestLeakyBucket_Permits(t *testing.T) {
+	bucket := NewLeakyBucket(2, 20*time.Millisecond)
+
+	start := time.Now()
+	count := 0
+	for range bucket.Permits(context.Background(), 5) {
+		count++
+	}
+	if count != 5 {
+		t.Fatalf("应该发放5个许可: %d", count)
+	}
+	// 第1个立即发放，之后每20ms一个
+	if elapsed := time.Since(start); elapsed < 70*time.Millisecond {
+		t.Errorf("许可应该按漏出速率发放: %v", elapsed)
+	}
+}
+
+// TestLeakyBucket_PermitsCancel 测试 ctx 取消后释放预留的排队位置
+func TestLeakyBucket_PermitsCancel(t *testing.T) {
+	bucket := NewLeakyBucket(2, time.Second)
+	bucket.Allow() // 第1个请求不等待，之后的请求排在它后面
+
+	ctx, cancel := context.WithCancel(context.Background())
+	permits := bucket.Permits(ctx, 0)
+	time.Sleep(20 * time.Millisecond)
+	if bucket.Allow() {
+		t.Error("许可应该占用排队位置")
+	}
+	cancel()
+	for range permits {
+	}
+	if current, _ := bucket.GetStatus(); current != 1 {
+		t.Errorf("取消后应该释放预留的排队位置: %d", current)
+	}
+}
+
+// TestLeakyBucketPolicer 测试监管模式不阻塞并返回排队时间
+func TestLeakyBucketPolicer(t *testing.T) {
+	policer := NewLeakyBucketPolicer(3, 100*time.Millisecond)
+
+	start := time.Now()
+	want := []time.Duration{0, 100 * time.Millisecond, 200 * time.Millisecond}
+	for i, w := range want {
+		delay, ok := policer.Police(1)
+		if !ok {
+			t.Fatalf("第%d个请求应该放行", i+1)
+		}
+		if delay < w-10*time.Millisecond || delay > w {
+			t.Errorf("第%d个请求的排队时间错误: %v, 期望 %v", i+1, delay, w)
+		}
+	}
+	if policer.Allow() {
+		t.Error("桶满后应该拒绝")
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("监管模式不应该阻塞: %v", elapsed)
+	}
+	if current, capacity := policer.GetStatus(); current != 3 || capacity != 3 {
+		t.Errorf("状态错误: current=%d, capacity=%d", current, capacity)
+	}
+
+	// 参数可以通过 Reconfigure 调整
+	if err := Reconfigure(policer, Config{Algorithm: "leaky_bucket", Limit: 5, Interval: Duration(100 * time.Millisecond)}); err != nil {
+		t.Fatal(err)
+	}
+	if !policer.Allow() {
+		t.Error("扩容后应该放行")
+	}
+}
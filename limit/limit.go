@@ -1,7 +1,88 @@
 package limit
 
+import (
+	"context"
+	"fmt"
+)
+
 // RateLimiter 限流器接口
 type RateLimiter interface {
 	Allow() bool
 	GetStatus() (int64, int64)
 }
+
+// Algorithm 获取限流器的算法名称，用于日志、监控等场景
+// 包装类限流器可以实现 Algorithm() string 返回被包装限流器的算法
+func Algorithm(l RateLimiter) string {
+	if a, ok := l.(interface{ Algorithm() string }); ok {
+		return a.Algorithm()
+	}
+	switch l := l.(type) {
+	case *FixedWindowCounter:
+		return "fixed_window"
+	case *SlidingWindowCounter:
+		return "sliding_window"
+	case *TokenBucket:
+		return "token_bucket"
+	case *WarmUpTokenBucket:
+		return "warmup_token_bucket"
+	case *LeakyBucket:
+		return "leaky_bucket"
+	case *Marker:
+		return l.algorithm()
+	default:
+		return fmt.Sprintf("%T", l)
+	}
+}
+
+// stopLimiter 停止限流器的后台资源（如果有）
+func stopLimiter(l RateLimiter) {
+	if s, ok := l.(interface{ Stop() }); ok {
+		s.Stop()
+	}
+}
+
+// Remaining 估算限流器剩余的配额，无法估算时（如预热令牌桶）返回 false
+func Remaining(l RateLimiter) (int64, bool) {
+	current, capacity := l.GetStatus()
+	return remaining(Algorithm(l), current, capacity)
+}
+
+// RemainingKey 估算 key 限流器中 key 剩余的配额，无法估算时返回 false
+func RemainingKey(l KeyedLimiter, key string) (int64, bool) {
+	current, capacity := l.GetKeyStatus(key)
+	return remaining(KeyedAlgorithm(l), current, capacity)
+}
+
+// remaining 根据算法把 GetStatus 的返回值换算成剩余配额
+func remaining(algorithm string, current, capacity int64) (int64, bool) {
+	switch algorithm {
+	case "fixed_window", "sliding_window", "leaky_bucket":
+		return max(capacity-current, 0), true
+	case "token_bucket", "srtcm", "trtcm":
+		return max(current, 0), true
+	default:
+		return 0, false
+	}
+}
+
+// AllowContext 限流器实现了 AllowContext 时传入 ctx（用于 trace 等），否则调用 Allow
+// 包装类限流器（如 limitotel.TracedLimiter）用它把 ctx 传给被包装的限流器
+func AllowContext(ctx context.Context, l RateLimiter) bool {
+	if c, ok := l.(interface {
+		AllowContext(ctx context.Context) bool
+	}); ok {
+		return c.AllowContext(ctx)
+	}
+	return l.Allow()
+}
+
+// AllowKeyContext key 限流器实现了 AllowKeyContext 时传入 ctx，否则调用 AllowKey
+func AllowKeyContext(ctx context.Context, l KeyedLimiter, key string) bool {
+	if c, ok := l.(interface {
+		AllowKeyContext(ctx context.Context, key string) bool
+	}); ok {
+		return c.AllowKeyContext(ctx, key)
+	}
+	return l.AllowKey(key)
+}
@@ -41,6 +41,11 @@ func TestRateLimiterInterface(t *testing.T) {
 				}
 			},
 		},
+		{
+			name:    "WarmUpTokenBucket",
+			limiter: NewWarmUpTokenBucket(5, time.Second),
+			cleanup: func() {},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -76,6 +81,7 @@ func TestRateLimiterZeroLimit(t *testing.T) {
 		"SlidingWindowCounter": NewSlidingWindowCounter(0, time.Second, 100*time.Millisecond),
 		"TokenBucket":          NewTokenBucket(0, 1),
 		"LeakyBucket":          NewLeakyBucket(0, 100*time.Millisecond),
+		"WarmUpTokenBucket":    NewWarmUpTokenBucket(0, time.Second),
 	}
 
 	// 清理资源
@@ -154,3 +160,13 @@ func BenchmarkRateLimiters(b *testing.B) {
 		})
 	}
 }
+
+// TestRateLimiters_ZeroAlloc 测试所有限流器放行请求时不分配内存
+func TestRateLimiters_ZeroAlloc(t *testing.T) {
+	for name, allow := range allowFuncs(t) {
+		allow()
+		if allocs := testing.AllocsPerRun(1000, func() { allow() }); allocs != 0 {
+			t.Errorf("%s: Allow 分配了内存: %.1f", name, allocs)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+// Package limitgrpc gRPC 服务端限流拦截器，被拒绝的请求返回 codes.ResourceExhausted
+// 单独成包，使用 limit 包时不必引入 gRPC 依赖
+package limitgrpc
+
+import (
+	"context"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/CocaineCong/BiliBili-Code/limit"
+)
+
+// KeyFunc 从请求中提取限流 key，返回 false 表示无法提取（该请求不参与限流）
+// fullMethod 为 /package.Service/Method 形式的方法名
+type KeyFunc func(ctx context.Context, fullMethod string) (string, bool)
+
+// PeerKey 以对端地址的 IP 作为 key
+func PeerKey(ctx context.Context, fullMethod string) (string, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return "", false
+	}
+	addr := p.Addr.String()
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	return host, host != ""
+}
+
+// MethodKey 以方法名作为 key，每个方法独立限流
+func MethodKey(ctx context.Context, fullMethod string) (string, bool) {
+	return fullMethod, true
+}
+
+// UnaryServerInterceptor 一元调用的限流拦截器
+// 限流器实现了 AllowKeyContext 时（如 limitotel.TracedKeyedLimiter）传入请求的 ctx
+// keyFunc 为 nil 时按 PeerKey 限流
+func UnaryServerInterceptor(limiter limit.KeyedLimiter, keyFunc KeyFunc) grpc.UnaryServerInterceptor {
+	if keyFunc == nil {
+		keyFunc = PeerKey
+	}
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := allow(ctx, limiter, keyFunc, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor 流式调用的限流拦截器，只在建立流时判定一次
+// keyFunc 为 nil 时按 PeerKey 限流
+func StreamServerInterceptor(limiter limit.KeyedLimiter, keyFunc KeyFunc) grpc.StreamServerInterceptor {
+	if keyFunc == nil {
+		keyFunc = PeerKey
+	}
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := allow(ss.Context(), limiter, keyFunc, info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// allow 判定请求是否放行，被拒绝时返回 codes.ResourceExhausted
+func allow(ctx context.Context, limiter limit.KeyedLimiter, keyFunc KeyFunc, fullMethod string) error {
+	key, ok := keyFunc(ctx, fullMethod)
+	if ok && !limit.AllowKeyContext(ctx, limiter, key) {
+		return status.Errorf(codes.ResourceExhausted, "%s is rejected by rate limiter", fullMethod)
+	}
+	return nil
+}
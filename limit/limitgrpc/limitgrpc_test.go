@@ -0,0 +1,90 @@
+package limitgrpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/CocaineCong/BiliBili-Code/limit"
+)
+
+// newRegistry 创建每个 key 只放行一个请求的 key 限流器
+func newRegistry(t *testing.T) *limit.KeyedRegistry {
+	registry := limit.NewKeyedRegistry(func(string) limit.RateLimiter {
+		return limit.NewFixedWindowCounter(1, time.Minute)
+	})
+	t.Cleanup(registry.Stop)
+	return registry
+}
+
+// peerContext 创建带对端地址的 ctx
+func peerContext(ip string) context.Context {
+	return peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 50000}})
+}
+
+// TestUnaryServerInterceptor 测试按对端 IP 限流
+func TestUnaryServerInterceptor(t *testing.T) {
+	interceptor := UnaryServerInterceptor(newRegistry(t), nil)
+	info := &grpc.UnaryServerInfo{FullMethod: "/bilibili.Video/Upload"}
+	calls := 0
+	handler := func(ctx context.Context, req any) (any, error) {
+		calls++
+		return "ok", nil
+	}
+
+	if resp, err := interceptor(peerContext("10.0.0.1"), nil, info, handler); err != nil || resp != "ok" {
+		t.Fatalf("第1个请求应该通过: %v, %v", resp, err)
+	}
+	_, err := interceptor(peerContext("10.0.0.1"), nil, info, handler)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("第2个请求应该返回 ResourceExhausted: %v", err)
+	}
+	if _, err := interceptor(peerContext("10.0.0.2"), nil, info, handler); err != nil {
+		t.Errorf("其他 IP 不应该受影响: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("被拒绝的请求不应该调用 handler: %d", calls)
+	}
+
+	// 没有对端地址时不参与限流
+	for i := 0; i < 2; i++ {
+		if _, err := interceptor(context.Background(), nil, info, handler); err != nil {
+			t.Errorf("无法提取 key 的请求应该放行: %v", err)
+		}
+	}
+}
+
+// fakeStream 只提供 ctx 的 grpc.ServerStream
+type fakeStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context 获取流的 ctx
+func (s *fakeStream) Context() context.Context {
+	return s.ctx
+}
+
+// TestStreamServerInterceptor 测试按方法名限流
+func TestStreamServerInterceptor(t *testing.T) {
+	interceptor := StreamServerInterceptor(newRegistry(t), MethodKey)
+	handler := func(srv any, ss grpc.ServerStream) error { return nil }
+	stream := &fakeStream{ctx: peerContext("10.0.0.1")}
+
+	watch := &grpc.StreamServerInfo{FullMethod: "/bilibili.Live/Watch"}
+	if err := interceptor(nil, stream, watch, handler); err != nil {
+		t.Fatalf("第1个流应该通过: %v", err)
+	}
+	if err := interceptor(nil, stream, watch, handler); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("第2个流应该返回 ResourceExhausted: %v", err)
+	}
+	if err := interceptor(nil, stream, &grpc.StreamServerInfo{FullMethod: "/bilibili.Live/Chat"}, handler); err != nil {
+		t.Errorf("其他方法不应该受影响: %v", err)
+	}
+}
@@ -0,0 +1,249 @@
+// Package limitotel 把限流判定记录到 OpenTelemetry trace，并为 limit.Metrics 提供 exemplar
+// 单独成包，使用 limit 包时不必引入 OpenTelemetry 依赖
+package limitotel
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/CocaineCong/BiliBili-Code/limit"
+)
+
+// tracerName 创建 Tracer 时使用的名称
+const tracerName = "github.com/CocaineCong/BiliBili-Code/limit/limitotel"
+
+// decisionEventName 判定事件的名称
+const decisionEventName = "ratelimit.decision"
+
+// 判定记录在 trace 中的属性
+const (
+	AttrName      = attribute.Key("ratelimit.name")      // 限流器名称
+	AttrAlgorithm = attribute.Key("ratelimit.algorithm") // 限流算法
+	AttrKey       = attribute.Key("ratelimit.key")       // 限流 key
+	AttrDecision  = attribute.Key("ratelimit.decision")  // 判定结果：allowed / rejected
+	AttrShadow    = attribute.Key("ratelimit.shadow")    // 是否为影子模式下的判定
+	AttrRemaining = attribute.Key("ratelimit.remaining") // 剩余配额
+	AttrWaitMs    = attribute.Key("ratelimit.wait_ms")   // 等待时间（毫秒）
+)
+
+// DecisionAttributes 生成一次判定的 trace 属性
+// remaining 小于 0 表示未知，不会写入
+func DecisionAttributes(d limit.Decision, remaining int64, wait time.Duration) []attribute.KeyValue {
+	decision := "allowed"
+	if !d.Allowed {
+		decision = "rejected"
+	}
+	attrs := []attribute.KeyValue{
+		AttrName.String(d.Name),
+		AttrAlgorithm.String(d.Algorithm),
+		AttrDecision.String(decision),
+		AttrWaitMs.Float64(float64(wait) / float64(time.Millisecond)),
+	}
+	if d.Key != "" {
+		attrs = append(attrs, AttrKey.String(d.Key))
+	}
+	if d.Shadow {
+		attrs = append(attrs, AttrShadow.Bool(true))
+	}
+	if remaining >= 0 {
+		attrs = append(attrs, AttrRemaining.Int64(remaining))
+	}
+	return attrs
+}
+
+// RecordDecision 把一次判定记录为 ctx 中 span 的事件，span 没有在记录时什么也不做
+func RecordDecision(ctx context.Context, d limit.Decision, remaining int64, wait time.Duration) {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return
+	}
+	span.AddEvent(decisionEventName, trace.WithAttributes(DecisionAttributes(d, remaining, wait)...))
+}
+
+// Exemplar 从 ctx 中采样的 span 提取 exemplar，作为 limit.WithExemplars 的参数
+// 例如 limit.NewMetrics(limit.WithExemplars(limitotel.Exemplar))
+func Exemplar(ctx context.Context) (traceID, spanID string, ok bool) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() || !sc.IsSampled() {
+		return "", "", false
+	}
+	return sc.TraceID().String(), sc.SpanID().String(), true
+}
+
+// TraceOption 链路追踪的可选配置
+type TraceOption func(*tracing)
+
+// WithTracerProvider 设置 TracerProvider，默认使用 otel.GetTracerProvider()
+func WithTracerProvider(tp trace.TracerProvider) TraceOption {
+	return func(t *tracing) {
+		t.provider = tp
+	}
+}
+
+// WithSpans 为每次判定创建一个子 span（span 的耗时即等待时间），默认只在当前 span 上记录事件
+func WithSpans() TraceOption {
+	return func(t *tracing) {
+		t.spans = true
+	}
+}
+
+// tracing 限流判定的链路追踪逻辑
+type tracing struct {
+	name     string               // 限流器名称
+	provider trace.TracerProvider // TracerProvider
+	tracer   trace.Tracer         // Tracer
+	spans    bool                 // 是否为每次判定创建子 span
+}
+
+// newTracing 创建链路追踪
+func newTracing(name string, opts []TraceOption) *tracing {
+	t := &tracing{name: name}
+	for _, opt := range opts {
+		opt(t)
+	}
+	if t.provider == nil {
+		t.provider = otel.GetTracerProvider()
+	}
+	t.tracer = t.provider.Tracer(tracerName)
+	return t
+}
+
+// record 执行判定并记录到 trace
+// algorithm 和 remaining 在判定之后调用：key 限流器要在 key 的限流器创建之后才能确定算法和剩余配额
+func (t *tracing) record(ctx context.Context, key string, algorithm func() string, remaining func() (int64, bool), decide func(ctx context.Context) bool) bool {
+	if t.spans {
+		var span trace.Span
+		ctx, span = t.tracer.Start(ctx, "ratelimit "+t.name, trace.WithSpanKind(trace.SpanKindInternal))
+		defer span.End()
+	}
+	if !trace.SpanFromContext(ctx).IsRecording() {
+		return decide(ctx)
+	}
+
+	start := time.Now()
+	allowed := decide(ctx)
+	wait := time.Since(start)
+
+	left := int64(-1)
+	if r, ok := remaining(); ok {
+		left = r
+	}
+	d := limit.Decision{Name: t.name, Algorithm: algorithm(), Key: key, Allowed: allowed}
+	if t.spans {
+		trace.SpanFromContext(ctx).SetAttributes(DecisionAttributes(d, left, wait)...)
+	} else {
+		RecordDecision(ctx, d, left, wait)
+	}
+	return allowed
+}
+
+// TracedLimiter 把每次判定记录到 OpenTelemetry trace 的限流器
+// 通过 AllowContext / Wait 传入请求的 ctx；直接调用 Allow 时没有父 span，只有 WithSpans 时才会记录
+type TracedLimiter struct {
+	*tracing
+	limiter limit.RateLimiter
+}
+
+// NewTracedLimiter 包装限流器
+// name: 限流器名称，写入 ratelimit.name 属性
+func NewTracedLimiter(name string, limiter limit.RateLimiter, opts ...TraceOption) *TracedLimiter {
+	return &TracedLimiter{
+		tracing: newTracing(name, opts),
+		limiter: limiter,
+	}
+}
+
+// Allow 检查是否允许请求通过
+func (tl *TracedLimiter) Allow() bool {
+	return tl.AllowContext(context.Background())
+}
+
+// AllowContext 检查是否允许请求通过，并把判定记录到 ctx 的 trace 中
+func (tl *TracedLimiter) AllowContext(ctx context.Context) bool {
+	return tl.record(ctx, "", tl.Algorithm, tl.remaining, func(ctx context.Context) bool {
+		return limit.AllowContext(ctx, tl.limiter)
+	})
+}
+
+// Wait 阻塞直到限流器放行或 ctx 结束，并把等待时间记录到 trace 中
+func (tl *TracedLimiter) Wait(ctx context.Context) error {
+	var err error
+	tl.record(ctx, "", tl.Algorithm, tl.remaining, func(ctx context.Context) bool {
+		err = limit.Wait(ctx, tl.limiter)
+		return err == nil
+	})
+	return err
+}
+
+// remaining 估算被包装限流器剩余的配额
+func (tl *TracedLimiter) remaining() (int64, bool) {
+	return limit.Remaining(tl.limiter)
+}
+
+// GetStatus 获取被包装限流器的状态
+func (tl *TracedLimiter) GetStatus() (int64, int64) {
+	return tl.limiter.GetStatus()
+}
+
+// Algorithm 获取被包装限流器的算法
+func (tl *TracedLimiter) Algorithm() string {
+	return limit.Algorithm(tl.limiter)
+}
+
+// Unwrap 获取被包装的限流器
+func (tl *TracedLimiter) Unwrap() limit.RateLimiter {
+	return tl.limiter
+}
+
+// Stop 停止被包装的限流器
+func (tl *TracedLimiter) Stop() {
+	if s, ok := tl.limiter.(interface{ Stop() }); ok {
+		s.Stop()
+	}
+}
+
+// TracedKeyedLimiter 把每次判定记录到 OpenTelemetry trace 的 key 限流器
+type TracedKeyedLimiter struct {
+	*tracing
+	limiter limit.KeyedLimiter
+}
+
+// NewTracedKeyedLimiter 包装 key 限流器
+func NewTracedKeyedLimiter(name string, limiter limit.KeyedLimiter, opts ...TraceOption) *TracedKeyedLimiter {
+	return &TracedKeyedLimiter{
+		tracing: newTracing(name, opts),
+		limiter: limiter,
+	}
+}
+
+// AllowKey 检查 key 的请求是否允许通过
+func (tk *TracedKeyedLimiter) AllowKey(key string) bool {
+	return tk.AllowKeyContext(context.Background(), key)
+}
+
+// AllowKeyContext 检查 key 的请求是否允许通过，并把判定记录到 ctx 的 trace 中
+func (tk *TracedKeyedLimiter) AllowKeyContext(ctx context.Context, key string) bool {
+	remaining := func() (int64, bool) { return limit.RemainingKey(tk.limiter, key) }
+	return tk.record(ctx, key, tk.Algorithm, remaining, func(ctx context.Context) bool {
+		return limit.AllowKeyContext(ctx, tk.limiter, key)
+	})
+}
+
+// GetKeyStatus 获取 key 的限流状态
+func (tk *TracedKeyedLimiter) GetKeyStatus(key string) (int64, int64) {
+	return tk.limiter.GetKeyStatus(key)
+}
+
+// Algorithm 获取被包装限流器的算法
+func (tk *TracedKeyedLimiter) Algorithm() string {
+	return limit.KeyedAlgorithm(tk.limiter)
+}
+
+// Unwrap 获取被包装的 key 限流器
+func (tk *TracedKeyedLimiter) Unwrap() limit.KeyedLimiter {
+	return tk.limiter
+}
@@ -0,0 +1,241 @@
+package limitotel
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc"
+
+	"github.com/CocaineCong/BiliBili-Code/limit"
+	"github.com/CocaineCong/BiliBili-Code/limit/limitgrpc"
+)
+
+// newTestTracer 创建把 span 同步导出到内存的 TracerProvider
+func newTestTracer(t *testing.T) (*sdktrace.TracerProvider, *tracetest.InMemoryExporter) {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+	return tp, exporter
+}
+
+// attrs 把属性列表转换为 map
+func attrs(kvs []attribute.KeyValue) map[attribute.Key]attribute.Value {
+	m := make(map[attribute.Key]attribute.Value, len(kvs))
+	for _, kv := range kvs {
+		m[kv.Key] = kv.Value
+	}
+	return m
+}
+
+// TestTracedLimiter_Events 测试在父 span 上记录判定事件
+func TestTracedLimiter_Events(t *testing.T) {
+	tp, exporter := newTestTracer(t)
+	limiter := NewTracedLimiter("video_upload", limit.NewFixedWindowCounter(1, time.Minute), WithTracerProvider(tp))
+
+	ctx, span := tp.Tracer("test").Start(context.Background(), "request")
+	limiter.AllowContext(ctx)
+	limiter.AllowContext(ctx)
+	span.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("默认只应该有父 span: %d", len(spans))
+	}
+	events := spans[0].Events
+	if len(events) != 2 {
+		t.Fatalf("每次判定应该记录一个事件: %d", len(events))
+	}
+	first, second := attrs(events[0].Attributes), attrs(events[1].Attributes)
+	if events[0].Name != "ratelimit.decision" ||
+		first[AttrName].AsString() != "video_upload" ||
+		first[AttrAlgorithm].AsString() != "fixed_window" ||
+		first[AttrDecision].AsString() != "allowed" ||
+		first[AttrRemaining].AsInt64() != 0 {
+		t.Errorf("第1次判定的属性错误: %v", events[0].Attributes)
+	}
+	if second[AttrDecision].AsString() != "rejected" {
+		t.Errorf("第2次判定应该被拒绝: %v", events[1].Attributes)
+	}
+	if _, ok := first[AttrKey]; ok {
+		t.Error("非 key 限流器不应该记录 key")
+	}
+}
+
+// TestTracedLimiter_NoSpan 测试 ctx 中没有 span 时不记录
+func TestTracedLimiter_NoSpan(t *testing.T) {
+	tp, exporter := newTestTracer(t)
+	limiter := NewTracedLimiter("video_upload", limit.NewFixedWindowCounter(1, time.Minute), WithTracerProvider(tp))
+
+	if !limiter.Allow() || limiter.Allow() {
+		t.Error("判定结果应该和被包装的限流器一致")
+	}
+	if spans := exporter.GetSpans(); len(spans) != 0 {
+		t.Errorf("没有父 span 时不应该记录: %d", len(spans))
+	}
+}
+
+// TestTracedLimiter_Spans 测试 WithSpans 为每次判定创建子 span
+func TestTracedLimiter_Spans(t *testing.T) {
+	tp, exporter := newTestTracer(t)
+	limiter := NewTracedLimiter("comment", limit.NewTokenBucket(3, 1), WithTracerProvider(tp), WithSpans())
+	defer limiter.Stop()
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "request")
+	limiter.AllowContext(ctx)
+	parent.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("应该有父 span 和一个子 span: %d", len(spans))
+	}
+	child := spans[0]
+	if child.Name != "ratelimit comment" || child.Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("子 span 错误: %s, parent=%s", child.Name, child.Parent.SpanID())
+	}
+	a := attrs(child.Attributes)
+	if a[AttrAlgorithm].AsString() != "token_bucket" || a[AttrRemaining].AsInt64() != 2 {
+		t.Errorf("子 span 属性错误: %v", child.Attributes)
+	}
+}
+
+// TestTracedLimiter_Wait 测试记录等待时间
+func TestTracedLimiter_Wait(t *testing.T) {
+	tp, exporter := newTestTracer(t)
+	limiter := NewTracedLimiter("live_gift", limit.NewLeakyBucket(5, 50*time.Millisecond), WithTracerProvider(tp), WithSpans())
+
+	// 第1个请求不等待，第2个请求排队约50ms
+	for i := 0; i < 2; i++ {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("每次等待应该创建一个 span: %d", len(spans))
+	}
+	wait := attrs(spans[1].Attributes)[AttrWaitMs].AsFloat64()
+	if wait < 30 {
+		t.Errorf("应该记录排队时间: %.1fms", wait)
+	}
+}
+
+// TestTracedKeyedLimiter 测试 key 限流器记录 key
+func TestTracedKeyedLimiter(t *testing.T) {
+	tp, exporter := newTestTracer(t)
+	registry := limit.NewKeyedRegistry(func(string) limit.RateLimiter { return limit.NewFixedWindowCounter(2, time.Minute) })
+	defer registry.Stop()
+	limiter := NewTracedKeyedLimiter("login", registry, WithTracerProvider(tp))
+
+	ctx, span := tp.Tracer("test").Start(context.Background(), "request")
+	limiter.AllowKeyContext(ctx, "10.0.0.1")
+	span.End()
+
+	a := attrs(exporter.GetSpans()[0].Events[0].Attributes)
+	if a[AttrKey].AsString() != "10.0.0.1" || a[AttrAlgorithm].AsString() != "fixed_window" || a[AttrRemaining].AsInt64() != 1 {
+		t.Errorf("key 限流器的属性错误: %v", a)
+	}
+}
+
+// TestTracedKeyedLimiter_Middleware 测试中间件把请求的 ctx 传给限流器
+func TestTracedKeyedLimiter_Middleware(t *testing.T) {
+	tp, exporter := newTestTracer(t)
+	registry := limit.NewKeyedRegistry(func(string) limit.RateLimiter { return limit.NewFixedWindowCounter(1, time.Minute) })
+	defer registry.Stop()
+	limiter := NewTracedKeyedLimiter("api", registry, WithTracerProvider(tp))
+	handler := limit.Middleware(limiter, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for i := 0; i < 2; i++ {
+		ctx, span := tp.Tracer("test").Start(context.Background(), "request")
+		req := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		span.End()
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("应该有2个请求 span: %d", len(spans))
+	}
+	if d := attrs(spans[1].Events[0].Attributes)[AttrDecision].AsString(); d != "rejected" {
+		t.Errorf("第2个请求应该被拒绝: %s", d)
+	}
+}
+
+// TestTracedKeyedLimiter_GRPC 测试 gRPC 拦截器把请求的 ctx 传给限流器
+func TestTracedKeyedLimiter_GRPC(t *testing.T) {
+	tp, exporter := newTestTracer(t)
+	registry := limit.NewKeyedRegistry(func(string) limit.RateLimiter { return limit.NewFixedWindowCounter(1, time.Minute) })
+	defer registry.Stop()
+	limiter := NewTracedKeyedLimiter("rpc", registry, WithTracerProvider(tp))
+	interceptor := limitgrpc.UnaryServerInterceptor(limiter, limitgrpc.MethodKey)
+	info := &grpc.UnaryServerInfo{FullMethod: "/bilibili.Video/Upload"}
+	handler := func(ctx context.Context, req any) (any, error) { return nil, nil }
+
+	for i := 0; i < 2; i++ {
+		ctx, span := tp.Tracer("test").Start(context.Background(), "request")
+		_, _ = interceptor(ctx, nil, info, handler)
+		span.End()
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("应该有2个请求 span: %d", len(spans))
+	}
+	a := attrs(spans[1].Events[0].Attributes)
+	if a[AttrKey].AsString() != "/bilibili.Video/Upload" || a[AttrDecision].AsString() != "rejected" {
+		t.Errorf("第2个请求应该被拒绝: %v", a)
+	}
+}
+
+// TestExemplar 测试 limit.Metrics 通过 Exemplar 在 OpenMetrics 格式中输出 trace
+func TestExemplar(t *testing.T) {
+	tp, _ := newTestTracer(t)
+	m := limit.NewMetrics(limit.WithExemplars(Exemplar))
+	limiter := m.Wrap("video_upload", limit.NewFixedWindowCounter(1, time.Minute))
+
+	ctx, span := tp.Tracer("test").Start(context.Background(), "request")
+	limiter.AllowContext(ctx)
+	limiter.AllowContext(ctx)
+	span.End()
+	traceID := span.SpanContext().TraceID().String()
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	m.Handler().ServeHTTP(rec, req)
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/openmetrics-text") {
+		t.Errorf("Content-Type 错误: %s", ct)
+	}
+	body, _ := io.ReadAll(rec.Body)
+	out := string(body)
+	for _, want := range []string{
+		"# TYPE limit_requests_allowed counter",
+		`limit_requests_allowed_total{limiter="video_upload",algorithm="fixed_window"} 1 # {trace_id="` + traceID + `"`,
+		`limit_requests_rejected_total{limiter="video_upload",algorithm="fixed_window"} 1 # {trace_id="` + traceID + `"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("指标缺少 %q:\n%s", want, out)
+		}
+	}
+	if !strings.HasSuffix(out, "# EOF\n") {
+		t.Errorf("OpenMetrics 应该以 # EOF 结尾:\n%s", out)
+	}
+
+	// Prometheus 文本格式不输出 exemplar
+	var text strings.Builder
+	if _, err := m.WriteTo(&text); err != nil {
+		t.Fatal(err)
+	}
+	if out := text.String(); strings.Contains(out, "trace_id") {
+		t.Errorf("文本格式不应该包含 exemplar:\n%s", out)
+	}
+}
@@ -0,0 +1,202 @@
+package limit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Color 三色标记器给请求标记的颜色
+type Color int
+
+const (
+	Green  Color = iota // 在承诺速率内
+	Yellow              // 超出承诺速率，但在突发/峰值范围内，可以降级处理
+	Red                 // 超出峰值，应该丢弃
+)
+
+// String 颜色名称
+func (c Color) String() string {
+	switch c {
+	case Green:
+		return "green"
+	case Yellow:
+		return "yellow"
+	case Red:
+		return "red"
+	default:
+		return "unknown"
+	}
+}
+
+// tokenScale 标记器内部以 1/tokenScale 个令牌为单位计数，按纳秒精确补充令牌
+const tokenScale = int64(time.Second)
+
+// Marker 三色标记器（网络中的 policer），按 RFC 2697 / RFC 2698 用两个令牌桶给请求标记颜色
+//   - srTCM（单速率三色标记）：承诺桶 C 和超额桶 E 共用承诺速率 CIR，C 满后溢出的令牌进入 E
+//     C 中有令牌为绿色，否则 E 中有令牌为黄色，否则为红色
+//   - trTCM（双速率三色标记）：承诺桶 C 以 CIR 补充，峰值桶 P 以 PIR 补充
+//     超过 P 为红色，否则超过 C 为黄色，否则为绿色
+//
+// 调用方可以降级黄色请求（如返回低码率），丢弃红色请求
+type Marker struct {
+	twoRate       bool       // 是否为 trTCM
+	committedRate int64      // 承诺速率 CIR（每秒令牌数）
+	peakRate      int64      // 峰值速率 PIR（每秒令牌数），srTCM 不使用
+	committedSize int64      // 承诺桶容量 CBS
+	excessSize    int64      // srTCM 为超额桶容量 EBS，trTCM 为峰值桶容量 PBS
+	committed     int64      // 承诺桶中的令牌（以 1/tokenScale 为单位）
+	excess        int64      // 超额桶 / 峰值桶中的令牌（以 1/tokenScale 为单位）
+	lastRefill    time.Time  // 上次补充时间
+	clock         Clock      // 时钟
+	mutex         sync.Mutex // 互斥锁
+}
+
+// NewSingleRateMarker 创建单速率三色标记器（RFC 2697 srTCM）
+// cir: 承诺速率（每秒令牌数）
+// cbs: 承诺突发，即承诺桶容量
+// ebs: 超额突发，即超额桶容量
+func NewSingleRateMarker(cir, cbs, ebs int64, opts ...Option) *Marker {
+	o := newOptions(opts)
+	return &Marker{
+		committedRate: cir,
+		committedSize: cbs,
+		excessSize:    ebs,
+		committed:     scaleTokens(cbs), // 初始时两个桶都是满的
+		excess:        scaleTokens(ebs),
+		lastRefill:    o.clock.Now(),
+		clock:         o.clock,
+	}
+}
+
+// NewTwoRateMarker 创建双速率三色标记器（RFC 2698 trTCM）
+// cir、cbs: 承诺速率和承诺桶容量
+// pir、pbs: 峰值速率和峰值桶容量，pir 应该不小于 cir
+func NewTwoRateMarker(cir, cbs, pir, pbs int64, opts ...Option) *Marker {
+	o := newOptions(opts)
+	return &Marker{
+		twoRate:       true,
+		committedRate: cir,
+		peakRate:      pir,
+		committedSize: cbs,
+		excessSize:    pbs,
+		committed:     scaleTokens(cbs),
+		excess:        scaleTokens(pbs),
+		lastRefill:    o.clock.Now(),
+		clock:         o.clock,
+	}
+}
+
+// scaleTokens 把令牌数换算为内部单位，溢出时取最大值
+func scaleTokens(n int64) int64 {
+	if n > math.MaxInt64/tokenScale {
+		return math.MaxInt64
+	}
+	return n * tokenScale
+}
+
+// accrued 以 rate 的速率经过 elapsed 补充的令牌（内部单位），溢出时取最大值
+func accrued(elapsed time.Duration, rate int64) int64 {
+	if rate <= 0 || elapsed <= 0 {
+		return 0
+	}
+	if int64(elapsed) > math.MaxInt64/rate {
+		return math.MaxInt64
+	}
+	return int64(elapsed) * rate
+}
+
+// fill 向容量为 size 的桶中加入 add 个令牌，返回装不下而溢出的令牌
+func fill(tokens *int64, size, add int64) int64 {
+	room := scaleTokens(size) - *tokens
+	if add <= room {
+		*tokens += add
+		return 0
+	}
+	*tokens += room
+	return add - room
+}
+
+// refill 按距离上次补充流逝的时间补充令牌，调用方需持有锁
+func (m *Marker) refill(now time.Time) {
+	elapsed := now.Sub(m.lastRefill)
+	if elapsed <= 0 {
+		return
+	}
+	m.lastRefill = now
+	overflow := fill(&m.committed, m.committedSize, accrued(elapsed, m.committedRate))
+	if m.twoRate {
+		fill(&m.excess, m.excessSize, accrued(elapsed, m.peakRate))
+	} else {
+		// srTCM 中承诺桶满后溢出的令牌进入超额桶
+		fill(&m.excess, m.excessSize, overflow)
+	}
+}
+
+// Mark 为大小为 n 的请求（如 n 个字节）标记颜色并消耗相应的令牌（色盲模式）
+func (m *Marker) Mark(n int64) Color {
+	return m.MarkAware(n, Green)
+}
+
+// MarkAware 为上游已经标记过颜色的请求重新标记（色敏模式），结果不会比 prior 更好
+func (m *Marker) MarkAware(n int64, prior Color) Color {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.refill(m.clock.Now())
+	need := scaleTokens(max(n, 0))
+	if m.twoRate {
+		switch {
+		case prior == Red || m.excess < need:
+			return Red
+		case prior == Yellow || m.committed < need:
+			m.excess -= need
+			return Yellow
+		default:
+			m.excess -= need
+			m.committed -= need
+			return Green
+		}
+	}
+	switch {
+	case prior == Green && m.committed >= need:
+		m.committed -= need
+		return Green
+	case prior != Red && m.excess >= need:
+		m.excess -= need
+		return Yellow
+	default:
+		return Red
+	}
+}
+
+// Allow 检查是否允许请求通过，绿色和黄色请求都会放行
+func (m *Marker) Allow() bool {
+	return m.Mark(1) != Red
+}
+
+// Tokens 获取承诺桶和超额桶（trTCM 为峰值桶）中的令牌数
+func (m *Marker) Tokens() (committed, excess int64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.refill(m.clock.Now())
+	return m.committed / tokenScale, m.excess / tokenScale
+}
+
+// GetStatus 获取放行（非红色）请求还能使用的令牌数和容量
+// srTCM 为两个桶的总和，trTCM 为峰值桶
+func (m *Marker) GetStatus() (current int64, capacity int64) {
+	committed, excess := m.Tokens()
+	if m.twoRate {
+		return excess, m.excessSize
+	}
+	return committed + excess, m.committedSize + m.excessSize
+}
+
+// algorithm 获取算法名称：srtcm 或 trtcm
+func (m *Marker) algorithm() string {
+	if m.twoRate {
+		return "trtcm"
+	}
+	return "srtcm"
+}
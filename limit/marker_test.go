@@ -0,0 +1,105 @@
+package limit
+
+import (
+	"testing"
+	"time"
+)
+
+// TestMarker_SingleRate 测试单速率三色标记
+func TestMarker_SingleRate(t *testing.T) {
+	marker := NewSingleRateMarker(10, 3, 2) // 每秒10个，承诺突发3个，超额突发2个
+
+	want := []Color{Green, Green, Green, Yellow, Yellow, Red}
+	for i, c := range want {
+		if got := marker.Mark(1); got != c {
+			t.Errorf("第%d个请求应该标记为 %s，实际为 %s", i+1, c, got)
+		}
+	}
+
+	// 令牌先补充承诺桶，承诺桶满后才溢出到超额桶
+	time.Sleep(250 * time.Millisecond)
+	if committed, excess := marker.Tokens(); committed < 2 || excess != 0 {
+		t.Errorf("补充的令牌应该先进入承诺桶: committed=%d, excess=%d", committed, excess)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if committed, excess := marker.Tokens(); committed != 3 || excess < 1 {
+		t.Errorf("承诺桶满后应该溢出到超额桶: committed=%d, excess=%d", committed, excess)
+	}
+}
+
+// TestMarker_TwoRate 测试双速率三色标记
+func TestMarker_TwoRate(t *testing.T) {
+	marker := NewTwoRateMarker(10, 2, 100, 5) // 承诺每秒10个、突发2个，峰值每秒100个、突发5个
+
+	want := []Color{Green, Green, Yellow, Yellow, Yellow, Red}
+	for i, c := range want {
+		if got := marker.Mark(1); got != c {
+			t.Errorf("第%d个请求应该标记为 %s，实际为 %s", i+1, c, got)
+		}
+	}
+
+	// 峰值桶恢复得比承诺桶快
+	time.Sleep(60 * time.Millisecond)
+	if got := marker.Mark(5); got != Yellow {
+		t.Errorf("峰值桶已经恢复、承诺桶还没有恢复，应该标记为黄色: %s", got)
+	}
+}
+
+// TestMarker_Size 测试按请求大小消耗令牌
+func TestMarker_Size(t *testing.T) {
+	marker := NewTwoRateMarker(1000, 1500, 2000, 3000) // 按字节计量
+
+	if got := marker.Mark(1000); got != Green {
+		t.Errorf("1000 字节应该为绿色: %s", got)
+	}
+	if got := marker.Mark(1000); got != Yellow {
+		t.Errorf("超过承诺突发应该为黄色: %s", got)
+	}
+	if got := marker.Mark(1500); got != Red {
+		t.Errorf("超过峰值突发应该为红色: %s", got)
+	}
+	// 红色请求不消耗令牌
+	if got := marker.Mark(500); got != Green {
+		t.Errorf("红色请求不应该消耗令牌: %s", got)
+	}
+}
+
+// TestMarker_ColorAware 测试色敏模式的结果不会比上游标记的颜色更好
+func TestMarker_ColorAware(t *testing.T) {
+	for _, marker := range []*Marker{NewSingleRateMarker(10, 5, 5), NewTwoRateMarker(10, 5, 20, 10)} {
+		if got := marker.MarkAware(1, Yellow); got != Yellow {
+			t.Errorf("%s: 黄色请求不应该被标记为 %s", Algorithm(marker), got)
+		}
+		if got := marker.MarkAware(1, Red); got != Red {
+			t.Errorf("%s: 红色请求不应该被标记为 %s", Algorithm(marker), got)
+		}
+		if got := marker.MarkAware(1, Green); got != Green {
+			t.Errorf("%s: 令牌充足时绿色请求应该保持绿色: %s", Algorithm(marker), got)
+		}
+	}
+}
+
+// TestMarker_RateLimiter 测试作为 RateLimiter 使用时放行绿色和黄色请求
+func TestMarker_RateLimiter(t *testing.T) {
+	var limiter RateLimiter = NewSingleRateMarker(1, 2, 1)
+	for i := 0; i < 3; i++ {
+		if !limiter.Allow() {
+			t.Errorf("第%d个请求应该被放行", i+1)
+		}
+	}
+	if limiter.Allow() {
+		t.Error("红色请求应该被拒绝")
+	}
+	if current, capacity := limiter.GetStatus(); current != 0 || capacity != 3 {
+		t.Errorf("状态错误: current=%d, capacity=%d", current, capacity)
+	}
+	if got := Algorithm(limiter); got != "srtcm" {
+		t.Errorf("算法名称错误: %s", got)
+	}
+	if got := Algorithm(NewTwoRateMarker(1, 1, 2, 2)); got != "trtcm" {
+		t.Errorf("算法名称错误: %s", got)
+	}
+	if got := Color(9).String(); got != "unknown" {
+		t.Errorf("未知颜色的名称错误: %s", got)
+	}
+}
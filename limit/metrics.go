@@ -0,0 +1,448 @@
+package limit
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultWaitBuckets 等待时间直方图的默认分桶（秒）
+var defaultWaitBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// openMetricsType OpenMetrics 文本格式的 Content-Type
+const openMetricsType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// Metrics 限流指标集合
+// 以 Prometheus 文本格式导出，不依赖 Prometheus 客户端库
+// 设置 WithExemplars 后会记录判定时 ctx 中的 trace 作为 exemplar，只在 OpenMetrics 格式中输出
+type Metrics struct {
+	meters   map[string]*meter // 限流器名称到指标的映射
+	exemplar ExemplarFunc      // 从 ctx 中提取 exemplar，为 nil 时不记录
+	mutex    sync.RWMutex      // 读写锁
+}
+
+// ExemplarFunc 从判定时的 ctx 中提取 exemplar 关联的 trace，没有采样的 trace 时返回 false
+// OpenTelemetry 的实现见 limitotel.Exemplar，core 包不依赖具体的链路追踪库
+type ExemplarFunc func(ctx context.Context) (traceID, spanID string, ok bool)
+
+// MetricsOption 指标集合的可选配置
+type MetricsOption func(*Metrics)
+
+// WithExemplars 设置 exemplar 的提取函数，只对之后 Wrap 的限流器生效
+func WithExemplars(fn ExemplarFunc) MetricsOption {
+	return func(m *Metrics) {
+		m.exemplar = fn
+	}
+}
+
+// NewMetrics 创建限流指标集合
+func NewMetrics(opts ...MetricsOption) *Metrics {
+	m := &Metrics{
+		meters: make(map[string]*meter),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Wrap 为限流器增加指标统计，同名限流器会覆盖之前注册的指标
+func (m *Metrics) Wrap(name string, limiter RateLimiter) *MeteredLimiter {
+	ml := &MeteredLimiter{limiter: limiter}
+	ml.meter = newMeter(name, ml.Algorithm, m.exemplar)
+	ml.meter.status = limiter.GetStatus
+	m.register(ml.meter)
+	return ml
+}
+
+// WrapKeyed 为 key 限流器增加指标统计
+func (m *Metrics) WrapKeyed(name string, limiter KeyedLimiter) *MeteredKeyedLimiter {
+	mk := &MeteredKeyedLimiter{limiter: limiter}
+	mk.meter = newMeter(name, mk.Algorithm, m.exemplar)
+	if l, ok := limiter.(interface{ Len() int }); ok {
+		mk.meter.keys = l.Len
+	}
+	m.register(mk.meter)
+	return mk
+}
+
+// register 注册指标
+func (m *Metrics) register(mt *meter) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.meters[mt.name] = mt
+}
+
+// Handler 返回以文本格式导出指标的 http.Handler
+// 请求的 Accept 中包含 application/openmetrics-text 时以 OpenMetrics 格式导出（带 exemplar）
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text") {
+			w.Header().Set("Content-Type", openMetricsType)
+			_, _ = m.WriteOpenMetrics(w)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = m.WriteTo(w)
+	})
+}
+
+// WriteTo 以 Prometheus 文本格式输出所有指标
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	return m.write(w, false)
+}
+
+// WriteOpenMetrics 以 OpenMetrics 文本格式输出所有指标，计数器和直方图分桶带有最近一次判定的 exemplar
+func (m *Metrics) WriteOpenMetrics(w io.Writer) (int64, error) {
+	return m.write(w, true)
+}
+
+// write 输出所有指标
+func (m *Metrics) write(w io.Writer, openMetrics bool) (int64, error) {
+	m.mutex.RLock()
+	meters := make([]*meter, 0, len(m.meters))
+	for _, mt := range m.meters {
+		meters = append(meters, mt)
+	}
+	m.mutex.RUnlock()
+	sort.Slice(meters, func(i, j int) bool { return meters[i].name < meters[j].name })
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	writeFamily(cw, openMetrics, "limit_requests_allowed_total", "counter", "Requests allowed by the limiter.", meters,
+		func(mt *meter, labels string) {
+			fmt.Fprintf(cw, "limit_requests_allowed_total{%s} %d%s\n", labels, mt.allowed.Load(),
+				exemplarSuffix(mt.allowedExemplar.Load(), openMetrics))
+		})
+	writeFamily(cw, openMetrics, "limit_requests_rejected_total", "counter", "Requests rejected by the limiter.", meters,
+		func(mt *meter, labels string) {
+			fmt.Fprintf(cw, "limit_requests_rejected_total{%s} %d%s\n", labels, mt.rejected.Load(),
+				exemplarSuffix(mt.rejectedExemplar.Load(), openMetrics))
+		})
+
+	var statusMeters, keyedMeters []*meter
+	for _, mt := range meters {
+		if mt.status != nil {
+			statusMeters = append(statusMeters, mt)
+		}
+		if mt.keys != nil {
+			keyedMeters = append(keyedMeters, mt)
+		}
+	}
+	// 状态只读取一次，保证 current 和 capacity 来自同一时刻
+	status := make(map[*meter][2]int64, len(statusMeters))
+	for _, mt := range statusMeters {
+		current, capacity := mt.status()
+		status[mt] = [2]int64{current, capacity}
+	}
+	writeFamily(cw, openMetrics, "limit_current", "gauge", "Current usage of the limiter (tokens for token buckets).", statusMeters,
+		func(mt *meter, labels string) {
+			fmt.Fprintf(cw, "limit_current{%s} %d\n", labels, status[mt][0])
+		})
+	writeFamily(cw, openMetrics, "limit_capacity", "gauge", "Capacity of the limiter.", statusMeters,
+		func(mt *meter, labels string) {
+			fmt.Fprintf(cw, "limit_capacity{%s} %d\n", labels, status[mt][1])
+		})
+	writeFamily(cw, openMetrics, "limit_keys", "gauge", "Number of keys tracked by a keyed limiter.", keyedMeters,
+		func(mt *meter, labels string) {
+			fmt.Fprintf(cw, "limit_keys{%s} %d\n", labels, mt.keys())
+		})
+
+	writeFamily(cw, openMetrics, "limit_wait_seconds", "histogram", "Time spent waiting for the limiter.", meters,
+		func(mt *meter, labels string) {
+			mt.wait.write(cw, "limit_wait_seconds", labels, openMetrics)
+		})
+	if openMetrics {
+		fmt.Fprint(cw, "# EOF\n")
+	}
+
+	if err := cw.w.Flush(); err != nil && cw.err == nil {
+		cw.err = err
+	}
+	return cw.n, cw.err
+}
+
+// writeFamily 输出一个指标族，没有任何样本时不输出
+// OpenMetrics 格式中计数器的指标族名称不带 _total 后缀
+func writeFamily(w io.Writer, openMetrics bool, name, typ, help string, meters []*meter, sample func(mt *meter, labels string)) {
+	if len(meters) == 0 {
+		return
+	}
+	family := name
+	if openMetrics && typ == "counter" {
+		family = strings.TrimSuffix(name, "_total")
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", family, help, family, typ)
+	for _, mt := range meters {
+		sample(mt, mt.labels())
+	}
+}
+
+// meter 单个限流器的指标
+type meter struct {
+	name             string
+	algorithm        func() string
+	allowed          atomic.Uint64
+	rejected         atomic.Uint64
+	allowedExemplar  atomic.Pointer[exemplar] // 最近一次带 trace 的放行
+	rejectedExemplar atomic.Pointer[exemplar] // 最近一次带 trace 的拒绝
+	wait             *histogram
+	exemplar         ExemplarFunc          // 从 ctx 中提取 exemplar，为 nil 时不记录
+	status           func() (int64, int64) // 当前状态，key 限流器为 nil
+	keys             func() int            // key 数量，非 key 限流器为 nil
+}
+
+// newMeter 创建指标
+func newMeter(name string, algorithm func() string, exemplar ExemplarFunc) *meter {
+	return &meter{
+		name:      name,
+		algorithm: algorithm,
+		wait:      newHistogram(defaultWaitBuckets),
+		exemplar:  exemplar,
+	}
+}
+
+// observe 记录一次判定
+func (mt *meter) observe(ctx context.Context, allowed bool) {
+	e := mt.newExemplar(ctx, 1)
+	if allowed {
+		mt.allowed.Add(1)
+		if e != nil {
+			mt.allowedExemplar.Store(e)
+		}
+	} else {
+		mt.rejected.Add(1)
+		if e != nil {
+			mt.rejectedExemplar.Store(e)
+		}
+	}
+}
+
+// observeWait 记录一次等待时间
+func (mt *meter) observeWait(ctx context.Context, d time.Duration) {
+	mt.wait.observe(d, mt.newExemplar(ctx, d.Seconds()))
+}
+
+// labels 生成指标标签
+func (mt *meter) labels() string {
+	return fmt.Sprintf(`limiter="%s",algorithm="%s"`, escapeLabel(mt.name), escapeLabel(mt.algorithm()))
+}
+
+// exemplar 指标样本关联的 trace
+type exemplar struct {
+	traceID string
+	spanID  string
+	value   float64
+	time    time.Time
+}
+
+// newExemplar 从 ctx 中的 trace 创建 exemplar，没有设置提取函数或没有采样的 trace 时返回 nil
+func (mt *meter) newExemplar(ctx context.Context, value float64) *exemplar {
+	if mt.exemplar == nil {
+		return nil
+	}
+	traceID, spanID, ok := mt.exemplar(ctx)
+	if !ok {
+		return nil
+	}
+	return &exemplar{
+		traceID: traceID,
+		spanID:  spanID,
+		value:   value,
+		time:    time.Now(),
+	}
+}
+
+// exemplarSuffix 生成 OpenMetrics 样本行末尾的 exemplar，Prometheus 文本格式不支持 exemplar
+func exemplarSuffix(e *exemplar, openMetrics bool) string {
+	if e == nil || !openMetrics {
+		return ""
+	}
+	return fmt.Sprintf(` # {trace_id="%s",span_id="%s"} %s %s`, e.traceID, e.spanID,
+		formatFloat(e.value), strconv.FormatFloat(float64(e.time.UnixMilli())/1000, 'f', 3, 64))
+}
+
+// histogram 累积直方图
+type histogram struct {
+	bounds    []float64                  // 各分桶上界（秒）
+	counts    []atomic.Uint64            // 各分桶计数（非累积）
+	exemplars []atomic.Pointer[exemplar] // 各分桶最近一次带 trace 的样本
+	sum       atomic.Uint64              // 总和（float64 的位表示）
+	count     atomic.Uint64              // 总次数
+}
+
+// newHistogram 创建直方图
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{
+		bounds:    bounds,
+		counts:    make([]atomic.Uint64, len(bounds)+1),
+		exemplars: make([]atomic.Pointer[exemplar], len(bounds)+1),
+	}
+}
+
+// observe 记录一次耗时，e 不为 nil 时作为所在分桶的 exemplar
+func (h *histogram) observe(d time.Duration, e *exemplar) {
+	v := d.Seconds()
+	i := sort.SearchFloat64s(h.bounds, v)
+	h.counts[i].Add(1)
+	if e != nil {
+		h.exemplars[i].Store(e)
+	}
+	h.count.Add(1)
+	for {
+		old := h.sum.Load()
+		if h.sum.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+// write 以文本格式输出直方图
+func (h *histogram) write(w io.Writer, name, labels string, openMetrics bool) {
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i].Load()
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d%s\n", name, labels, formatFloat(bound), cumulative,
+			exemplarSuffix(h.exemplars[i].Load(), openMetrics))
+	}
+	n := len(h.bounds)
+	cumulative += h.counts[n].Load()
+	fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d%s\n", name, labels, cumulative,
+		exemplarSuffix(h.exemplars[n].Load(), openMetrics))
+	fmt.Fprintf(w, "%s_sum{%s} %s\n", name, labels, formatFloat(math.Float64frombits(h.sum.Load())))
+	fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, h.count.Load())
+}
+
+// formatFloat 格式化浮点数
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// labelEscaper 标签值转义
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabel 转义标签值
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+// countingWriter 记录写入字节数和第一个错误
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+// Write 写入数据
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+	return n, err
+}
+
+// MeteredLimiter 带指标统计的限流器
+type MeteredLimiter struct {
+	*meter
+	limiter RateLimiter
+}
+
+// Allow 检查是否允许请求通过
+// 漏桶的 Allow 会阻塞排队，因此同时记录等待时间
+func (ml *MeteredLimiter) Allow() bool {
+	return ml.AllowContext(context.Background())
+}
+
+// AllowContext 检查是否允许请求通过，ctx 中的 trace 会作为 exemplar 记录
+func (ml *MeteredLimiter) AllowContext(ctx context.Context) bool {
+	if ml.Algorithm() != "leaky_bucket" {
+		allowed := AllowContext(ctx, ml.limiter)
+		ml.observe(ctx, allowed)
+		return allowed
+	}
+
+	start := time.Now()
+	allowed := AllowContext(ctx, ml.limiter)
+	if allowed {
+		ml.observeWait(ctx, time.Since(start))
+	}
+	ml.observe(ctx, allowed)
+	return allowed
+}
+
+// Wait 阻塞直到限流器放行或 ctx 结束，并记录等待时间
+func (ml *MeteredLimiter) Wait(ctx context.Context) error {
+	start := time.Now()
+	err := Wait(ctx, ml.limiter)
+	if err != nil {
+		ml.observe(ctx, false)
+		return err
+	}
+	ml.observeWait(ctx, time.Since(start))
+	ml.observe(ctx, true)
+	return nil
+}
+
+// GetStatus 获取被包装限流器的状态
+func (ml *MeteredLimiter) GetStatus() (int64, int64) {
+	return ml.limiter.GetStatus()
+}
+
+// Algorithm 获取被包装限流器的算法
+func (ml *MeteredLimiter) Algorithm() string {
+	return Algorithm(ml.limiter)
+}
+
+// Unwrap 获取被包装的限流器
+func (ml *MeteredLimiter) Unwrap() RateLimiter {
+	return ml.limiter
+}
+
+// Stop 停止被包装的限流器
+func (ml *MeteredLimiter) Stop() {
+	stopLimiter(ml.limiter)
+}
+
+// MeteredKeyedLimiter 带指标统计的 key 限流器
+type MeteredKeyedLimiter struct {
+	*meter
+	limiter KeyedLimiter
+}
+
+// AllowKey 检查 key 的请求是否允许通过
+func (mk *MeteredKeyedLimiter) AllowKey(key string) bool {
+	return mk.AllowKeyContext(context.Background(), key)
+}
+
+// AllowKeyContext 检查 key 的请求是否允许通过，ctx 中的 trace 会作为 exemplar 记录
+func (mk *MeteredKeyedLimiter) AllowKeyContext(ctx context.Context, key string) bool {
+	allowed := AllowKeyContext(ctx, mk.limiter, key)
+	mk.observe(ctx, allowed)
+	return allowed
+}
+
+// GetKeyStatus 获取 key 的限流状态
+func (mk *MeteredKeyedLimiter) GetKeyStatus(key string) (int64, int64) {
+	return mk.limiter.GetKeyStatus(key)
+}
+
+// Algorithm 获取被包装限流器的算法
+func (mk *MeteredKeyedLimiter) Algorithm() string {
+	return KeyedAlgorithm(mk.limiter)
+}
+
+// Unwrap 获取被包装的 key 限流器
+func (mk *MeteredKeyedLimiter) Unwrap() KeyedLimiter {
+	return mk.limiter
+}
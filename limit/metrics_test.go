@@ -0,0 +1,153 @@
+package limit
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scrape 通过 Handler 抓取指标文本
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type 错误: %s", ct)
+	}
+	body, _ := io.ReadAll(rec.Body)
+	return string(body)
+}
+
+// TestMetrics_Counters 测试通过/拒绝计数和状态指标
+func TestMetrics_Counters(t *testing.T) {
+	m := NewMetrics()
+	limiter := m.Wrap("video_upload", NewTokenBucket(2, 1))
+	defer limiter.Stop()
+
+	for i := 0; i < 3; i++ {
+		limiter.Allow()
+	}
+
+	out := scrape(t, m)
+	for _, want := range []string{
+		"# TYPE limit_requests_allowed_total counter",
+		`limit_requests_allowed_total{limiter="video_upload",algorithm="token_bucket"} 2`,
+		`limit_requests_rejected_total{limiter="video_upload",algorithm="token_bucket"} 1`,
+		"# TYPE limit_current gauge",
+		`limit_current{limiter="video_upload",algorithm="token_bucket"} 0`,
+		`limit_capacity{limiter="video_upload",algorithm="token_bucket"} 2`,
+		`limit_wait_seconds_count{limiter="video_upload",algorithm="token_bucket"} 0`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("指标缺少 %q:\n%s", want, out)
+		}
+	}
+}
+
+// TestMetrics_LeakyBucketWait 测试漏桶排队时间直方图
+func TestMetrics_LeakyBucketWait(t *testing.T) {
+	m := NewMetrics()
+	limiter := m.Wrap("live_gift", NewLeakyBucket(5, 20*time.Millisecond))
+
+	// 第1个请求不等待，第2个请求排队约20ms
+	limiter.Allow()
+	limiter.Allow()
+
+	out := scrape(t, m)
+	for _, want := range []string{
+		"# TYPE limit_wait_seconds histogram",
+		`limit_wait_seconds_bucket{limiter="live_gift",algorithm="leaky_bucket",le="0.001"} 1`,
+		`limit_wait_seconds_bucket{limiter="live_gift",algorithm="leaky_bucket",le="+Inf"} 2`,
+		`limit_wait_seconds_count{limiter="live_gift",algorithm="leaky_bucket"} 2`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("指标缺少 %q:\n%s", want, out)
+		}
+	}
+}
+
+// TestMetrics_Wait 测试 Wait 的计数和等待时间
+func TestMetrics_Wait(t *testing.T) {
+	m := NewMetrics()
+	limiter := m.Wrap("feed", NewFixedWindowCounter(1, time.Hour))
+
+	if err := limiter.Wait(context.Background()); err != nil {
+		t.Fatalf("第1次 Wait 应该成功: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := limiter.Wait(ctx); err == nil {
+		t.Error("窗口内第2次 Wait 应该超时")
+	}
+
+	out := scrape(t, m)
+	for _, want := range []string{
+		`limit_requests_allowed_total{limiter="feed",algorithm="fixed_window"} 1`,
+		`limit_requests_rejected_total{limiter="feed",algorithm="fixed_window"} 1`,
+		`limit_wait_seconds_count{limiter="feed",algorithm="fixed_window"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("指标缺少 %q:\n%s", want, out)
+		}
+	}
+}
+
+// TestMetrics_Keyed 测试 key 限流器的指标
+func TestMetrics_Keyed(t *testing.T) {
+	m := NewMetrics()
+	registry := NewKeyedRegistry(func(key string) RateLimiter {
+		return NewSlidingWindowCounter(1, time.Second, 100*time.Millisecond)
+	})
+	defer registry.Stop()
+	limiter := m.WrapKeyed(`api "v2"`, registry)
+
+	limiter.AllowKey("uid:1")
+	limiter.AllowKey("uid:1")
+	limiter.AllowKey("uid:2")
+
+	out := scrape(t, m)
+	for _, want := range []string{
+		`limit_requests_allowed_total{limiter="api \"v2\"",algorithm="sliding_window"} 2`,
+		`limit_requests_rejected_total{limiter="api \"v2\"",algorithm="sliding_window"} 1`,
+		`limit_keys{limiter="api \"v2\"",algorithm="sliding_window"} 2`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("指标缺少 %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "limit_current") {
+		t.Errorf("key 限流器不应该输出 limit_current:\n%s", out)
+	}
+}
+
+// TestMetrics_Exemplars 测试 WithExemplars 提取的 trace 只在 OpenMetrics 格式中输出
+func TestMetrics_Exemplars(t *testing.T) {
+	type traceKey struct{}
+	m := NewMetrics(WithExemplars(func(ctx context.Context) (string, string, bool) {
+		traceID, ok := ctx.Value(traceKey{}).(string)
+		return traceID, "00f067aa0ba902b7", ok
+	}))
+	limiter := m.Wrap("video_upload", NewFixedWindowCounter(1, time.Minute))
+
+	limiter.AllowContext(context.WithValue(context.Background(), traceKey{}, "4bf92f3577b34da6a3ce929d0e0e4736"))
+	limiter.Allow()
+
+	var om strings.Builder
+	if _, err := m.WriteOpenMetrics(&om); err != nil {
+		t.Fatal(err)
+	}
+	out := om.String()
+	want := `limit_requests_allowed_total{limiter="video_upload",algorithm="fixed_window"} 1 # {trace_id="4bf92f3577b34da6a3ce929d0e0e4736",span_id="00f067aa0ba902b7"} 1 `
+	if !strings.Contains(out, want) {
+		t.Errorf("指标缺少 %q:\n%s", want, out)
+	}
+	if strings.Contains(out, `limit_requests_rejected_total{limiter="video_upload",algorithm="fixed_window"} 1 #`) {
+		t.Errorf("ctx 中没有 trace 的判定不应该记录 exemplar:\n%s", out)
+	}
+	if out := scrape(t, m); strings.Contains(out, "trace_id") {
+		t.Errorf("文本格式不应该包含 exemplar:\n%s", out)
+	}
+}
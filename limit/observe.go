@@ -0,0 +1,237 @@
+package limit
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+)
+
+// Decision 一次限流判定的结果
+type Decision struct {
+	Name      string // 限流器名称
+	Algorithm string // 限流算法
+	Key       string // 限流 key，非 key 限流器为空
+	Allowed   bool   // 限流器的真实判定结果
+	Shadow    bool   // 是否处于影子模式（影子模式下调用方总是被放行）
+}
+
+// ObserveStats 限流判定统计
+type ObserveStats struct {
+	Allowed     uint64 `json:"allowed"`      // 允许通过的请求数
+	Rejected    uint64 `json:"rejected"`     // 被拒绝的请求数
+	WouldReject uint64 `json:"would_reject"` // 影子模式下本应被拒绝、实际放行的请求数
+}
+
+// ObserveOption 观测选项
+type ObserveOption func(*observer)
+
+// WithOnAllow 设置请求通过时的回调
+func WithOnAllow(fn func(Decision)) ObserveOption {
+	return func(o *observer) {
+		o.onAllow = fn
+	}
+}
+
+// WithOnReject 设置请求被拒绝（或影子模式下本应被拒绝）时的回调
+func WithOnReject(fn func(Decision)) ObserveOption {
+	return func(o *observer) {
+		o.onReject = fn
+	}
+}
+
+// WithLogger 设置结构化日志，拒绝记录为 Info 级别，通过记录为 Debug 级别
+func WithLogger(logger *slog.Logger) ObserveOption {
+	return func(o *observer) {
+		o.logger = logger
+	}
+}
+
+// WithShadow 设置是否以影子模式启动
+func WithShadow(shadow bool) ObserveOption {
+	return func(o *observer) {
+		o.shadow.Store(shadow)
+	}
+}
+
+// observer 限流判定的观测逻辑：回调、日志、影子模式和统计
+type observer struct {
+	name        string
+	onAllow     func(Decision)
+	onReject    func(Decision)
+	logger      *slog.Logger
+	shadow      atomic.Bool
+	allowed     atomic.Uint64
+	rejected    atomic.Uint64
+	wouldReject atomic.Uint64
+}
+
+// newObserver 创建观测器
+func newObserver(name string, opts []ObserveOption) *observer {
+	o := &observer{name: name}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// record 记录一次判定，返回最终交给调用方的结果
+func (o *observer) record(algorithm, key string, allowed bool) bool {
+	shadow := o.shadow.Load()
+	switch {
+	case allowed:
+		o.allowed.Add(1)
+	case shadow:
+		o.wouldReject.Add(1)
+	default:
+		o.rejected.Add(1)
+	}
+
+	d := Decision{
+		Name:      o.name,
+		Algorithm: algorithm,
+		Key:       key,
+		Allowed:   allowed,
+		Shadow:    shadow,
+	}
+	o.log(d)
+	if allowed {
+		if o.onAllow != nil {
+			o.onAllow(d)
+		}
+		return true
+	}
+	if o.onReject != nil {
+		o.onReject(d)
+	}
+	// 影子模式下只记录判定结果，总是放行
+	return shadow
+}
+
+// log 输出判定日志
+func (o *observer) log(d Decision) {
+	if o.logger == nil {
+		return
+	}
+	level, msg := slog.LevelDebug, "rate limit allowed"
+	if !d.Allowed {
+		level, msg = slog.LevelInfo, "rate limit rejected"
+	}
+	if !o.logger.Enabled(context.Background(), level) {
+		return
+	}
+	o.logger.LogAttrs(context.Background(), level, msg,
+		slog.String("limiter", d.Name),
+		slog.String("algorithm", d.Algorithm),
+		slog.String("key", d.Key),
+		slog.Bool("shadow", d.Shadow),
+	)
+}
+
+// Name 获取限流器名称
+func (o *observer) Name() string {
+	return o.name
+}
+
+// SetShadow 切换影子模式
+func (o *observer) SetShadow(shadow bool) {
+	o.shadow.Store(shadow)
+}
+
+// Shadow 是否处于影子模式
+func (o *observer) Shadow() bool {
+	return o.shadow.Load()
+}
+
+// Stats 获取判定统计
+func (o *observer) Stats() ObserveStats {
+	return ObserveStats{
+		Allowed:     o.allowed.Load(),
+		Rejected:    o.rejected.Load(),
+		WouldReject: o.wouldReject.Load(),
+	}
+}
+
+// ObservedLimiter 可观测的限流器，为任意 RateLimiter 增加回调、日志和影子模式
+type ObservedLimiter struct {
+	*observer
+	limiter RateLimiter
+}
+
+// NewObservedLimiter 包装限流器
+// name: 限流器名称，出现在日志和回调中
+func NewObservedLimiter(name string, limiter RateLimiter, opts ...ObserveOption) *ObservedLimiter {
+	return &ObservedLimiter{
+		observer: newObserver(name, opts),
+		limiter:  limiter,
+	}
+}
+
+// Allow 检查是否允许请求通过，影子模式下总是返回 true
+func (ol *ObservedLimiter) Allow() bool {
+	return ol.AllowContext(context.Background())
+}
+
+// AllowContext 检查是否允许请求通过，ctx 会传给被包装的限流器
+func (ol *ObservedLimiter) AllowContext(ctx context.Context) bool {
+	return ol.record(ol.Algorithm(), "", AllowContext(ctx, ol.limiter))
+}
+
+// GetStatus 获取被包装限流器的状态
+func (ol *ObservedLimiter) GetStatus() (int64, int64) {
+	return ol.limiter.GetStatus()
+}
+
+// Algorithm 获取被包装限流器的算法
+func (ol *ObservedLimiter) Algorithm() string {
+	return Algorithm(ol.limiter)
+}
+
+// Unwrap 获取被包装的限流器
+func (ol *ObservedLimiter) Unwrap() RateLimiter {
+	return ol.limiter
+}
+
+// Stop 停止被包装的限流器
+func (ol *ObservedLimiter) Stop() {
+	stopLimiter(ol.limiter)
+}
+
+// ObservedKeyedLimiter 可观测的 key 限流器
+type ObservedKeyedLimiter struct {
+	*observer
+	limiter KeyedLimiter
+}
+
+// NewObservedKeyedLimiter 包装 key 限流器
+func NewObservedKeyedLimiter(name string, limiter KeyedLimiter, opts ...ObserveOption) *ObservedKeyedLimiter {
+	return &ObservedKeyedLimiter{
+		observer: newObserver(name, opts),
+		limiter:  limiter,
+	}
+}
+
+// AllowKey 检查 key 的请求是否允许通过，影子模式下总是返回 true
+func (kl *ObservedKeyedLimiter) AllowKey(key string) bool {
+	return kl.AllowKeyContext(context.Background(), key)
+}
+
+// AllowKeyContext 检查 key 的请求是否允许通过，ctx 会传给被包装的限流器
+func (kl *ObservedKeyedLimiter) AllowKeyContext(ctx context.Context, key string) bool {
+	allowed := AllowKeyContext(ctx, kl.limiter, key)
+	return kl.record(kl.Algorithm(), key, allowed)
+}
+
+// GetKeyStatus 获取 key 的限流状态
+func (kl *ObservedKeyedLimiter) GetKeyStatus(key string) (int64, int64) {
+	return kl.limiter.GetKeyStatus(key)
+}
+
+// Algorithm 获取被包装限流器的算法
+func (kl *ObservedKeyedLimiter) Algorithm() string {
+	return KeyedAlgorithm(kl.limiter)
+}
+
+// Unwrap 获取被包装的 key 限流器
+func (kl *ObservedKeyedLimiter) Unwrap() KeyedLimiter {
+	return kl.limiter
+}
@@ -0,0 +1,118 @@
+package limit
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestObservedLimiter_Hooks 测试通过和拒绝回调
+func TestObservedLimiter_Hooks(t *testing.T) {
+	var allowed, rejected []Decision
+	limiter := NewObservedLimiter("comment", NewFixedWindowCounter(2, time.Second),
+		WithOnAllow(func(d Decision) { allowed = append(allowed, d) }),
+		WithOnReject(func(d Decision) { rejected = append(rejected, d) }),
+	)
+
+	for i := 0; i < 3; i++ {
+		limiter.Allow()
+	}
+
+	if len(allowed) != 2 || len(rejected) != 1 {
+		t.Fatalf("回调次数错误: allowed=%d, rejected=%d", len(allowed), len(rejected))
+	}
+	d := rejected[0]
+	if d.Name != "comment" || d.Algorithm != "fixed_window" || d.Allowed || d.Shadow {
+		t.Errorf("拒绝判定内容错误: %+v", d)
+	}
+
+	stats := limiter.Stats()
+	if stats.Allowed != 2 || stats.Rejected != 1 || stats.WouldReject != 0 {
+		t.Errorf("统计错误: %+v", stats)
+	}
+}
+
+// TestObservedLimiter_Shadow 测试影子模式只记录不拦截
+func TestObservedLimiter_Shadow(t *testing.T) {
+	var rejected int
+	limiter := NewObservedLimiter("danmaku", NewFixedWindowCounter(1, time.Second),
+		WithShadow(true),
+		WithOnReject(func(d Decision) {
+			if d.Shadow {
+				rejected++
+			}
+		}),
+	)
+
+	// 影子模式下所有请求都放行
+	for i := 0; i < 5; i++ {
+		if !limiter.Allow() {
+			t.Errorf("影子模式下第%d个请求应该放行", i+1)
+		}
+	}
+	stats := limiter.Stats()
+	if stats.Allowed != 1 || stats.WouldReject != 4 || stats.Rejected != 0 {
+		t.Errorf("影子模式统计错误: %+v", stats)
+	}
+	if rejected != 4 {
+		t.Errorf("影子模式下拒绝回调次数错误: %d", rejected)
+	}
+
+	// 关闭影子模式后开始真正拦截
+	limiter.SetShadow(false)
+	if limiter.Allow() {
+		t.Error("关闭影子模式后请求应该被拒绝")
+	}
+	if limiter.Stats().Rejected != 1 {
+		t.Errorf("关闭影子模式后拒绝数错误: %+v", limiter.Stats())
+	}
+}
+
+// TestObservedLimiter_Logger 测试结构化日志
+func TestObservedLimiter_Logger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	registry := NewKeyedRegistry(func(key string) RateLimiter {
+		return NewTokenBucket(1, 1)
+	})
+	defer registry.Stop()
+	limiter := NewObservedKeyedLimiter("login", registry, WithLogger(logger))
+
+	limiter.AllowKey("uid:42")
+	if buf.Len() != 0 {
+		t.Errorf("Info 级别下不应该记录通过的请求: %s", buf.String())
+	}
+
+	limiter.AllowKey("uid:42")
+	line := buf.String()
+	for _, want := range []string{"rate limit rejected", "limiter=login", "algorithm=token_bucket", "key=uid:42", "shadow=false"} {
+		if !strings.Contains(line, want) {
+			t.Errorf("日志缺少 %q: %s", want, line)
+		}
+	}
+}
+
+// TestObservedKeyedLimiter_Shadow 测试 key 限流器的影子模式
+func TestObservedKeyedLimiter_Shadow(t *testing.T) {
+	registry := NewKeyedRegistry(func(key string) RateLimiter {
+		return NewFixedWindowCounter(1, time.Second)
+	})
+	defer registry.Stop()
+	var keys []string
+	limiter := NewObservedKeyedLimiter("upload", registry, WithShadow(true),
+		WithOnReject(func(d Decision) { keys = append(keys, d.Key) }))
+
+	limiter.AllowKey("a")
+	limiter.AllowKey("b")
+	if !limiter.AllowKey("a") {
+		t.Error("影子模式下请求应该放行")
+	}
+	if len(keys) != 1 || keys[0] != "a" {
+		t.Errorf("本应被拒绝的 key 错误: %v", keys)
+	}
+	if stats := limiter.Stats(); stats.Allowed != 2 || stats.WouldReject != 1 {
+		t.Errorf("统计错误: %+v", stats)
+	}
+}
@@ -0,0 +1,217 @@
+package limit
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultCooldowns 默认的逐级封禁时长
+var defaultCooldowns = []time.Duration{time.Minute, 10 * time.Minute, time.Hour}
+
+// Ban 封禁信息
+type Ban struct {
+	Key    string    // 被封禁的 key
+	Until  time.Time // 封禁截止时间
+	Level  int       // 第几次被自动封禁，手动封禁为 0
+	Manual bool      // 是否为手动封禁
+}
+
+// PenaltyBox 小黑屋：对反复触发限流的 key 临时封禁
+// 1. 统计每个 key 在窗口内被拒绝的次数
+// 2. 达到阈值后封禁该 key，封禁期间直接拒绝，不再消耗内部限流器
+// 3. 再次违规时封禁时长逐级递增（例如 1m、10m、1h），长时间守规矩后重新从第一级开始
+// 过期的违规记录在访问时删除，另外每个窗口最多全量清理一次，不断更换 key 的客户端不会让记录无限增长
+type PenaltyBox struct {
+	limiter     KeyedLimiter         // 内部限流器
+	threshold   int                  // 窗口内被拒绝多少次后封禁
+	window      time.Duration        // 统计拒绝次数的窗口
+	cooldowns   []time.Duration      // 逐级递增的封禁时长
+	offenders   map[string]*offender // key 到违规记录的映射
+	lastCleanup time.Time            // 上次全量清理的时间
+	clock       Clock                // 时钟
+	mutex       sync.Mutex           // 互斥锁
+}
+
+// offender 单个 key 的违规记录
+type offender struct {
+	windowStart time.Time // 当前统计窗口的开始时间
+	rejections  int       // 当前窗口内的拒绝次数
+	level       int       // 已经被自动封禁的次数
+	until       time.Time // 封禁截止时间
+	manual      bool      // 当前封禁是否为手动封禁
+}
+
+// NewPenaltyBox 创建小黑屋
+// threshold: 窗口内被拒绝多少次后封禁
+// window: 统计拒绝次数的窗口
+// cooldowns: 逐级递增的封禁时长，为空时使用 1m、10m、1h
+func NewPenaltyBox(limiter KeyedLimiter, threshold int, window time.Duration, cooldowns []time.Duration, opts ...Option) *PenaltyBox {
+	if len(cooldowns) == 0 {
+		cooldowns = defaultCooldowns
+	}
+	o := newOptions(opts)
+	return &PenaltyBox{
+		limiter:   limiter,
+		threshold: threshold,
+		window:    window,
+		cooldowns: cooldowns,
+		offenders: make(map[string]*offender),
+		clock:     o.clock,
+	}
+}
+
+// AllowKey 检查 key 的请求是否允许通过，被封禁的 key 直接拒绝
+func (pb *PenaltyBox) AllowKey(key string) bool {
+	now := pb.clock.Now()
+	pb.mutex.Lock()
+	if o, ok := pb.offenders[key]; ok {
+		if now.Before(o.until) {
+			pb.mutex.Unlock()
+			return false
+		}
+		if pb.expired(o, now) {
+			delete(pb.offenders, key)
+		}
+	}
+	pb.mutex.Unlock()
+
+	// 内部限流器可能阻塞（如漏桶），不能持有锁调用
+	if pb.limiter.AllowKey(key) {
+		return true
+	}
+
+	pb.mutex.Lock()
+	defer pb.mutex.Unlock()
+	pb.recordRejection(key, pb.clock.Now())
+	return false
+}
+
+// recordRejection 记录一次拒绝，达到阈值时封禁，调用方需持有锁
+func (pb *PenaltyBox) recordRejection(key string, now time.Time) {
+	if now.Sub(pb.lastCleanup) >= pb.window {
+		pb.cleanup(now)
+	}
+	o, ok := pb.offenders[key]
+	if !ok {
+		o = &offender{}
+		pb.offenders[key] = o
+	}
+	if now.Sub(o.windowStart) >= pb.window {
+		o.windowStart = now
+		o.rejections = 0
+	}
+	o.rejections++
+	if o.rejections < pb.threshold {
+		return
+	}
+
+	// 上次封禁结束后守规矩超过最长封禁时长，重新从第一级开始
+	if !o.until.IsZero() && now.Sub(o.until) > pb.cooldowns[len(pb.cooldowns)-1] {
+		o.level = 0
+	}
+	cooldown := pb.cooldowns[min(o.level, len(pb.cooldowns)-1)]
+	o.level++
+	o.until = now.Add(cooldown)
+	o.manual = false
+	o.rejections = 0
+}
+
+// Ban 手动封禁 key
+func (pb *PenaltyBox) Ban(key string, d time.Duration) {
+	pb.mutex.Lock()
+	defer pb.mutex.Unlock()
+
+	o, ok := pb.offenders[key]
+	if !ok {
+		o = &offender{}
+		pb.offenders[key] = o
+	}
+	o.until = pb.clock.Now().Add(d)
+	o.manual = true
+}
+
+// Unban 解除封禁，同时清空该 key 的违规记录
+func (pb *PenaltyBox) Unban(key string) {
+	pb.mutex.Lock()
+	defer pb.mutex.Unlock()
+	delete(pb.offenders, key)
+}
+
+// IsBanned 查询 key 是否被封禁
+func (pb *PenaltyBox) IsBanned(key string) (Ban, bool) {
+	pb.mutex.Lock()
+	defer pb.mutex.Unlock()
+
+	o, ok := pb.offenders[key]
+	if !ok || !pb.clock.Now().Before(o.until) {
+		return Ban{}, false
+	}
+	return o.ban(key), true
+}
+
+// Bans 获取所有封禁中的 key（按 key 排序），同时清理过期的记录
+func (pb *PenaltyBox) Bans() []Ban {
+	pb.Cleanup()
+
+	now := pb.clock.Now()
+	pb.mutex.Lock()
+	bans := make([]Ban, 0, len(pb.offenders))
+	for key, o := range pb.offenders {
+		if now.Before(o.until) {
+			bans = append(bans, o.ban(key))
+		}
+	}
+	pb.mutex.Unlock()
+
+	sort.Slice(bans, func(i, j int) bool { return bans[i].Key < bans[j].Key })
+	return bans
+}
+
+// Cleanup 清理已经过期且不会再影响封禁等级的违规记录
+func (pb *PenaltyBox) Cleanup() {
+	pb.mutex.Lock()
+	defer pb.mutex.Unlock()
+	pb.cleanup(pb.clock.Now())
+}
+
+// cleanup 清理过期的违规记录，调用方需持有锁
+func (pb *PenaltyBox) cleanup(now time.Time) {
+	pb.lastCleanup = now
+	for key, o := range pb.offenders {
+		if pb.expired(o, now) {
+			delete(pb.offenders, key)
+		}
+	}
+}
+
+// expired 违规记录是否已经过期：封禁结束超过最长封禁时长（不再影响封禁等级），且拒绝次数的统计窗口已经结束
+func (pb *PenaltyBox) expired(o *offender, now time.Time) bool {
+	banExpired := now.Sub(o.until) > pb.cooldowns[len(pb.cooldowns)-1]
+	windowExpired := now.Sub(o.windowStart) >= pb.window
+	return banExpired && windowExpired
+}
+
+// ban 生成封禁信息
+func (o *offender) ban(key string) Ban {
+	level := o.level
+	if o.manual {
+		level = 0
+	}
+	return Ban{Key: key, Until: o.until, Level: level, Manual: o.manual}
+}
+
+// GetKeyStatus 获取内部限流器中 key 的状态
+func (pb *PenaltyBox) GetKeyStatus(key string) (int64, int64) {
+	return pb.limiter.GetKeyStatus(key)
+}
+
+// Algorithm 获取内部限流器的算法
+func (pb *PenaltyBox) Algorithm() string {
+	return KeyedAlgorithm(pb.limiter)
+}
+
+// Unwrap 获取内部限流器
+func (pb *PenaltyBox) Unwrap() KeyedLimiter {
+	return pb.limiter
+}
@@ -0,0 +1,157 @@
+package limit
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingKeyed 记录调用次数的 key 限流器
+type countingKeyed struct {
+	KeyedLimiter
+	calls atomic.Int64
+}
+
+// AllowKey 记录调用次数后转发
+func (c *countingKeyed) AllowKey(key string) bool {
+	c.calls.Add(1)
+	return c.KeyedLimiter.AllowKey(key)
+}
+
+// newDenyAllKeyed 创建除第一个请求外全部拒绝的 key 限流器
+func newDenyAllKeyed(t *testing.T) *countingKeyed {
+	registry := NewKeyedRegistry(func(key string) RateLimiter {
+		return NewFixedWindowCounter(1, time.Hour)
+	})
+	t.Cleanup(registry.Stop)
+	return &countingKeyed{KeyedLimiter: registry}
+}
+
+// TestPenaltyBox_AutoBan 测试反复被拒绝后自动封禁
+func TestPenaltyBox_AutoBan(t *testing.T) {
+	inner := newDenyAllKeyed(t)
+	box := NewPenaltyBox(inner, 3, time.Second, []time.Duration{50 * time.Millisecond, 200 * time.Millisecond})
+
+	if !box.AllowKey("bot") {
+		t.Fatal("第1个请求应该通过")
+	}
+	for i := 0; i < 3; i++ {
+		box.AllowKey("bot")
+	}
+	ban, ok := box.IsBanned("bot")
+	if !ok || ban.Level != 1 || ban.Manual {
+		t.Fatalf("连续被拒绝3次后应该被封禁: %+v, %v", ban, ok)
+	}
+
+	// 封禁期间直接拒绝，不再调用内部限流器
+	calls := inner.calls.Load()
+	for i := 0; i < 10; i++ {
+		if box.AllowKey("bot") {
+			t.Error("封禁期间请求应该被拒绝")
+		}
+	}
+	if inner.calls.Load() != calls {
+		t.Errorf("封禁期间不应该调用内部限流器: %d", inner.calls.Load()-calls)
+	}
+
+	// 其他 key 不受影响
+	if !box.AllowKey("human") {
+		t.Error("其他 key 不应该被封禁")
+	}
+}
+
+// TestPenaltyBox_Escalate 测试再次违规时封禁时长递增
+func TestPenaltyBox_Escalate(t *testing.T) {
+	clock := newManualClock()
+	box := NewPenaltyBox(newDenyAllKeyed(t), 2, time.Second, []time.Duration{30 * time.Millisecond, 300 * time.Millisecond}, WithClock(clock))
+
+	for i := 0; i < 3; i++ {
+		box.AllowKey("bot")
+	}
+	first, _ := box.IsBanned("bot")
+
+	clock.Sleep(40 * time.Millisecond)
+	if _, ok := box.IsBanned("bot"); ok {
+		t.Fatal("第一级封禁应该已经过期")
+	}
+	for i := 0; i < 2; i++ {
+		box.AllowKey("bot")
+	}
+	second, ok := box.IsBanned("bot")
+	if !ok || second.Level != 2 {
+		t.Fatalf("再次违规应该进入第二级封禁: %+v", second)
+	}
+	if d := second.Until.Sub(clock.Now()); d != 300*time.Millisecond {
+		t.Errorf("第二级封禁时长过短: %v (第一级截止 %v)", d, first.Until)
+	}
+}
+
+// TestPenaltyBox_Manual 测试手动封禁和解封
+func TestPenaltyBox_Manual(t *testing.T) {
+	box := NewPenaltyBox(newDenyAllKeyed(t), 3, time.Second, nil)
+
+	box.Ban("uid:2", time.Hour)
+	box.Ban("uid:1", time.Hour)
+	if box.AllowKey("uid:1") {
+		t.Error("手动封禁的 key 应该被拒绝")
+	}
+
+	bans := box.Bans()
+	if len(bans) != 2 || bans[0].Key != "uid:1" || !bans[0].Manual {
+		t.Fatalf("封禁列表错误: %+v", bans)
+	}
+
+	box.Unban("uid:1")
+	if !box.AllowKey("uid:1") {
+		t.Error("解封后请求应该通过")
+	}
+	if bans := box.Bans(); len(bans) != 1 || bans[0].Key != "uid:2" {
+		t.Errorf("解封后封禁列表错误: %+v", bans)
+	}
+}
+
+// TestPenaltyBox_Expiry 测试封禁到期和记录清理
+func TestPenaltyBox_Expiry(t *testing.T) {
+	clock := newManualClock()
+	box := NewPenaltyBox(newDenyAllKeyed(t), 1, 10*time.Millisecond, []time.Duration{20 * time.Millisecond}, WithClock(clock))
+
+	box.Ban("ip:1.1.1.1", 20*time.Millisecond)
+	clock.Sleep(30 * time.Millisecond)
+	if _, ok := box.IsBanned("ip:1.1.1.1"); ok {
+		t.Error("封禁应该已经到期")
+	}
+
+	clock.Sleep(20 * time.Millisecond)
+	box.Cleanup()
+	box.mutex.Lock()
+	remaining := len(box.offenders)
+	box.mutex.Unlock()
+	if remaining != 0 {
+		t.Errorf("过期记录应该被清理，剩余 %d 条", remaining)
+	}
+}
+
+// TestPenaltyBox_PruneOnReject 测试不断更换 key 时过期记录被自动清理
+func TestPenaltyBox_PruneOnReject(t *testing.T) {
+	clock := newManualClock()
+	box := NewPenaltyBox(newDenyAllKeyed(t), 100, 10*time.Millisecond, []time.Duration{10 * time.Millisecond}, WithClock(clock))
+
+	// 每个 key 被拒绝一次，达不到封禁阈值，但会留下违规记录
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("ip:%d", i)
+		box.AllowKey(key)
+		box.AllowKey(key)
+	}
+	clock.Sleep(30 * time.Millisecond)
+	// 下一次拒绝触发全量清理，只剩下新的记录
+	box.AllowKey("ip:new")
+	box.AllowKey("ip:new")
+
+	box.mutex.Lock()
+	remaining := len(box.offenders)
+	box.mutex.Unlock()
+	if remaining != 1 {
+		t.Errorf("过期记录应该被清理，剩余 %d 条", remaining)
+	}
+}
@@ -0,0 +1,231 @@
+package limit
+
+import (
+	"context"
+	"sort"
+	"sync/atomic"
+)
+
+// priorityKey 请求优先级在 context 中的 key
+type priorityKey struct{}
+
+// WithPriorityClass 在 ctx 中设置请求的优先级类别
+func WithPriorityClass(ctx context.Context, class string) context.Context {
+	return context.WithValue(ctx, priorityKey{}, class)
+}
+
+// PriorityClassFrom 从 ctx 中获取请求的优先级类别
+func PriorityClassFrom(ctx context.Context) (string, bool) {
+	class, ok := ctx.Value(priorityKey{}).(string)
+	return class, ok
+}
+
+// PriorityClass 优先级类别
+// Threshold 是该类别能使用的容量比例：被包装限流器的使用率达到 Threshold 后该类别的请求被丢弃，
+// 剩下的 1-Threshold 留给阈值更高的类别。最关键的类别应该设置为 1
+// Guarantee 是每秒在被包装限流器的容量中预留给该类别的请求数：其他类别在剩余配额只够各类别未用完的预留时被丢弃，
+// 该类别超过阈值后仍然可以用完自己的预留。该类别通过的请求都先算作预留，预留是最低保障而不是额外的配额，
+// 总的通过数不会超过被包装限流器的限制
+type PriorityClass struct {
+	Name      string  `json:"name" yaml:"name"`                               // 类别名称
+	Threshold float64 `json:"threshold" yaml:"threshold"`                     // 使用率阈值（0~1）
+	Guarantee int64   `json:"guarantee,omitempty" yaml:"guarantee,omitempty"` // 每秒预留的请求数
+}
+
+// PriorityStats 单个优先级类别的判定统计
+type PriorityStats struct {
+	Class      string `json:"class"`                // 类别名称
+	Allowed    uint64 `json:"allowed"`              // 允许通过的请求数，包含 Guaranteed
+	Guaranteed uint64 `json:"guaranteed,omitempty"` // 使用预留容量通过的请求数
+	Rejected   uint64 `json:"rejected"`             // 被限流器拒绝的请求数
+	Shed       uint64 `json:"shed"`                 // 因为优先级被提前丢弃的请求数
+}
+
+// PriorityOption PriorityLimiter 的可选配置
+type PriorityOption func(*PriorityLimiter)
+
+// WithPriorityClock 设置预留容量（Guarantee）按秒补充使用的时钟，默认使用系统时间
+func WithPriorityClock(clock Clock) PriorityOption {
+	return func(pl *PriorityLimiter) {
+		pl.clock = clock
+	}
+}
+
+// WithDefaultClass 设置 ctx 中没有类别或类别未知时使用的类别，默认为阈值最低的类别
+func WithDefaultClass(name string) PriorityOption {
+	return func(pl *PriorityLimiter) {
+		pl.defaultClass = name
+	}
+}
+
+// priorityClass 优先级类别的运行状态
+type priorityClass struct {
+	PriorityClass
+	guarantee  *TokenBucket // 本秒还没有用完的预留，没有预留时为 nil
+	allowed    atomic.Uint64
+	guaranteed atomic.Uint64
+	rejected   atomic.Uint64
+	shed       atomic.Uint64
+}
+
+// PriorityLimiter 按优先级分配容量的限流器，包装任意 RateLimiter
+// 1. 请求的类别通过 WithPriorityClass 放在 ctx 中，使用 AllowContext 判定
+// 2. 被包装限流器的使用率接近上限时，阈值低的类别先被丢弃，容量留给阈值高的类别
+// 3. 使用率由 GetStatus 计算；无法计算剩余配额的限流器（如预热令牌桶）不会提前丢弃任何请求，也不能预留
+// 4. 各类别的预留（Guarantee）从被包装限流器的容量中扣除，剩余配额只够其他类别未用完的预留时只能使用自己的预留
+//
+// 检查使用率和消耗配额不是原子的，并发时各类别的实际占比会有少量偏差
+type PriorityLimiter struct {
+	limiter      RateLimiter
+	classes      []*priorityClass          // 按阈值从高到低排列
+	byName       map[string]*priorityClass // 类别名称到类别的映射
+	defaultClass string                    // 默认类别
+	clock        Clock                     // 预留容量使用的时钟
+}
+
+// NewPriorityLimiter 创建按优先级分配容量的限流器
+// classes 为空时所有请求都属于阈值为 1 的 default 类别
+func NewPriorityLimiter(limiter RateLimiter, classes []PriorityClass, opts ...PriorityOption) *PriorityLimiter {
+	if len(classes) == 0 {
+		classes = []PriorityClass{{Name: "default", Threshold: 1}}
+	}
+	pl := &PriorityLimiter{
+		limiter: limiter,
+		byName:  make(map[string]*priorityClass, len(classes)),
+		clock:   realClock{},
+	}
+	for _, opt := range opts {
+		opt(pl)
+	}
+	for _, c := range classes {
+		pc := &priorityClass{PriorityClass: c}
+		if c.Guarantee > 0 {
+			pc.guarantee = NewTokenBucket(c.Guarantee, c.Guarantee, WithClock(pl.clock))
+		}
+		pl.classes = append(pl.classes, pc)
+		pl.byName[c.Name] = pc
+	}
+	sort.SliceStable(pl.classes, func(i, j int) bool { return pl.classes[i].Threshold > pl.classes[j].Threshold })
+	if pl.defaultClass == "" {
+		pl.defaultClass = pl.classes[len(pl.classes)-1].Name
+	}
+	return pl
+}
+
+// class 获取 ctx 中请求的类别
+func (pl *PriorityLimiter) class(ctx context.Context) *priorityClass {
+	if name, ok := PriorityClassFrom(ctx); ok {
+		if pc, ok := pl.byName[name]; ok {
+			return pc
+		}
+	}
+	if pc, ok := pl.byName[pl.defaultClass]; ok {
+		return pc
+	}
+	return pl.classes[len(pl.classes)-1]
+}
+
+// Allow 以默认类别检查是否允许请求通过
+func (pl *PriorityLimiter) Allow() bool {
+	return pl.AllowContext(context.Background())
+}
+
+// AllowContext 按 ctx 中的类别检查是否允许请求通过
+func (pl *PriorityLimiter) AllowContext(ctx context.Context) bool {
+	pc := pl.class(ctx)
+	// 超过阈值，或者剩余配额只够其他类别未用完的预留时，只能使用本类别的预留
+	shared := true
+	if left, capacity, ok := pl.headroom(); ok {
+		reserved := pl.reserved(pc)
+		shared = !saturated(pc.Threshold, left, capacity) && (reserved == 0 || left > reserved)
+	}
+	guaranteed := !shared && pc.unused() > 0
+	if !shared && !guaranteed {
+		pc.shed.Add(1)
+		return false
+	}
+	if !AllowContext(ctx, pl.limiter) {
+		pc.rejected.Add(1)
+		return false
+	}
+	// 通过的请求先算作本类别的预留，预留用完后才占用共享的容量
+	if pc.guarantee != nil {
+		pc.guarantee.Allow()
+	}
+	if guaranteed {
+		pc.guaranteed.Add(1)
+	}
+	pc.allowed.Add(1)
+	return true
+}
+
+// unused 本秒还没有用完的预留
+func (pc *priorityClass) unused() int64 {
+	if pc.guarantee == nil {
+		return 0
+	}
+	current, _ := pc.guarantee.GetStatus()
+	return max(current, 0)
+}
+
+// reserved 除 pc 以外的类别还没有用完的预留之和
+func (pl *PriorityLimiter) reserved(pc *priorityClass) int64 {
+	var n int64
+	for _, c := range pl.classes {
+		if c != pc {
+			n += c.unused()
+		}
+	}
+	return n
+}
+
+// headroom 被包装限流器的剩余配额和容量，无法计算剩余配额时返回 false
+func (pl *PriorityLimiter) headroom() (left, capacity int64, ok bool) {
+	current, capacity := pl.limiter.GetStatus()
+	left, ok = remaining(Algorithm(pl.limiter), current, capacity)
+	return left, capacity, ok && capacity > 0
+}
+
+// saturated 被包装限流器的使用率是否已经达到阈值
+func saturated(threshold float64, left, capacity int64) bool {
+	if threshold >= 1 {
+		return false
+	}
+	used := float64(capacity-left) / float64(capacity)
+	return used >= threshold
+}
+
+// ClassStats 获取各类别的判定统计，按阈值从高到低排列
+func (pl *PriorityLimiter) ClassStats() []PriorityStats {
+	stats := make([]PriorityStats, len(pl.classes))
+	for i, pc := range pl.classes {
+		stats[i] = PriorityStats{
+			Class:      pc.Name,
+			Allowed:    pc.allowed.Load(),
+			Guaranteed: pc.guaranteed.Load(),
+			Rejected:   pc.rejected.Load(),
+			Shed:       pc.shed.Load(),
+		}
+	}
+	return stats
+}
+
+// GetStatus 获取被包装限流器的状态
+func (pl *PriorityLimiter) GetStatus() (int64, int64) {
+	return pl.limiter.GetStatus()
+}
+
+// Algorithm 获取被包装限流器的算法
+func (pl *PriorityLimiter) Algorithm() string {
+	return Algorithm(pl.limiter)
+}
+
+// Unwrap 获取被包装的限流器
+func (pl *PriorityLimiter) Unwrap() RateLimiter {
+	return pl.limiter
+}
+
+// Stop 停止被包装的限流器
+func (pl *PriorityLimiter) Stop() {
+	stopLimiter(pl.limiter)
+}
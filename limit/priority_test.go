@@ -0,0 +1,166 @@
+package limit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// testClasses 支付回调可以用满容量，推荐刷新只能用前一半
+var testClasses = []PriorityClass{
+	{Name: "recommend", Threshold: 0.5},
+	{Name: "payment", Threshold: 1},
+}
+
+// TestPriorityLimiter_Shed 测试低优先级先被丢弃，容量留给高优先级
+func TestPriorityLimiter_Shed(t *testing.T) {
+	limiter := NewPriorityLimiter(NewFixedWindowCounter(10, time.Minute), testClasses)
+	recommend := WithPriorityClass(context.Background(), "recommend")
+	payment := WithPriorityClass(context.Background(), "payment")
+
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		if limiter.AllowContext(recommend) {
+			allowed++
+		}
+	}
+	if allowed != 5 {
+		t.Errorf("推荐刷新只能使用一半容量: %d", allowed)
+	}
+	for i := 0; i < 5; i++ {
+		if !limiter.AllowContext(payment) {
+			t.Errorf("第%d个支付回调应该使用预留的容量", i+1)
+		}
+	}
+	if limiter.AllowContext(payment) {
+		t.Error("容量用完后支付回调也应该被拒绝")
+	}
+
+	stats := limiter.ClassStats()
+	if len(stats) != 2 || stats[0].Class != "payment" || stats[1].Class != "recommend" {
+		t.Fatalf("统计应该按阈值从高到低排列: %+v", stats)
+	}
+	if stats[0].Allowed != 5 || stats[0].Rejected != 1 || stats[0].Shed != 0 {
+		t.Errorf("支付回调的统计错误: %+v", stats[0])
+	}
+	if stats[1].Allowed != 5 || stats[1].Shed != 5 {
+		t.Errorf("推荐刷新的统计错误: %+v", stats[1])
+	}
+}
+
+// TestPriorityLimiter_Default 测试没有类别或类别未知的请求使用默认类别
+func TestPriorityLimiter_Default(t *testing.T) {
+	limiter := NewPriorityLimiter(NewFixedWindowCounter(4, time.Minute), testClasses)
+	for i := 0; i < 4; i++ {
+		limiter.AllowContext(WithPriorityClass(context.Background(), "unknown"))
+	}
+	if stats := limiter.ClassStats(); stats[1].Allowed != 2 || stats[1].Shed != 2 {
+		t.Errorf("默认应该使用阈值最低的类别: %+v", stats)
+	}
+
+	limiter = NewPriorityLimiter(NewFixedWindowCounter(4, time.Minute), testClasses, WithDefaultClass("payment"))
+	for i := 0; i < 4; i++ {
+		if !limiter.Allow() {
+			t.Errorf("默认类别为 payment 时第%d个请求应该通过", i+1)
+		}
+	}
+}
+
+// TestPriorityLimiter_Guarantee 测试超过阈值后仍然可以用完自己的预留
+func TestPriorityLimiter_Guarantee(t *testing.T) {
+	limiter := NewPriorityLimiter(NewTokenBucket(10, 1), []PriorityClass{
+		{Name: "recommend", Threshold: 0.2, Guarantee: 3},
+		{Name: "payment", Threshold: 1},
+	})
+	defer limiter.Stop()
+	recommend := WithPriorityClass(context.Background(), "recommend")
+
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		if limiter.AllowContext(recommend) {
+			allowed++
+		}
+	}
+	// 阈值内的2个先算作预留，超过阈值后再用完剩下的1个预留
+	if allowed != 3 {
+		t.Errorf("超过阈值后应该只能用完自己的预留: %d", allowed)
+	}
+	if stats := limiter.ClassStats(); stats[1].Guaranteed != 1 || stats[1].Shed != 7 {
+		t.Errorf("推荐刷新的统计错误: %+v", stats[1])
+	}
+}
+
+// TestPriorityLimiter_GuaranteeReserved 测试预留从被包装限流器的容量中扣除，其他类别不能占用
+func TestPriorityLimiter_GuaranteeReserved(t *testing.T) {
+	limiter := NewPriorityLimiter(NewFixedWindowCounter(4, time.Minute), []PriorityClass{
+		{Name: "recommend", Threshold: 0.5, Guarantee: 2},
+		{Name: "payment", Threshold: 1},
+	})
+	recommend := WithPriorityClass(context.Background(), "recommend")
+	payment := WithPriorityClass(context.Background(), "payment")
+
+	for i := 0; i < 2; i++ {
+		if !limiter.AllowContext(payment) {
+			t.Fatalf("第%d个支付回调应该通过", i+1)
+		}
+	}
+	if limiter.AllowContext(payment) {
+		t.Error("剩余的配额是推荐刷新的预留，支付回调不能占用")
+	}
+	for i := 0; i < 2; i++ {
+		if !limiter.AllowContext(recommend) {
+			t.Errorf("超过阈值后第%d个推荐刷新应该使用预留", i+1)
+		}
+	}
+	if limiter.AllowContext(recommend) {
+		t.Error("预留用完后应该被丢弃")
+	}
+	// 预留的请求计入被包装的限流器，总的通过数不超过限制
+	if current, _ := limiter.GetStatus(); current != 4 {
+		t.Errorf("预留的请求应该计入被包装的限流器: %d", current)
+	}
+	if limiter.AllowContext(payment) {
+		t.Error("容量用完后支付回调应该被拒绝")
+	}
+
+	stats := limiter.ClassStats()
+	if stats[0].Allowed != 2 || stats[0].Shed != 1 || stats[0].Rejected != 1 {
+		t.Errorf("支付回调的统计错误: %+v", stats[0])
+	}
+	if stats[1].Allowed != 2 || stats[1].Guaranteed != 2 || stats[1].Shed != 1 {
+		t.Errorf("推荐刷新的统计错误: %+v", stats[1])
+	}
+}
+
+// TestPriorityLimiter_GuaranteeClock 测试预留按 WithPriorityClock 的时钟每秒补充
+func TestPriorityLimiter_GuaranteeClock(t *testing.T) {
+	clock := newManualClock()
+	limiter := NewPriorityLimiter(NewFixedWindowCounter(100, time.Minute), []PriorityClass{
+		{Name: "batch", Threshold: 0, Guarantee: 2},
+	}, WithPriorityClock(clock))
+
+	for second := 0; second < 2; second++ {
+		for i := 0; i < 2; i++ {
+			if !limiter.Allow() {
+				t.Errorf("第%d秒第%d个请求应该使用预留", second+1, i+1)
+			}
+		}
+		if limiter.Allow() {
+			t.Errorf("第%d秒的预留用完后应该被丢弃", second+1)
+		}
+		clock.Sleep(time.Second)
+	}
+}
+
+// TestPriorityLimiter_Unknown 测试无法计算使用率的限流器不会提前丢弃请求
+func TestPriorityLimiter_Unknown(t *testing.T) {
+	limiter := NewPriorityLimiter(NewWarmUpTokenBucket(1000, time.Second), testClasses)
+	recommend := WithPriorityClass(context.Background(), "recommend")
+	limiter.AllowContext(recommend)
+	if stats := limiter.ClassStats(); stats[1].Shed != 0 {
+		t.Errorf("不应该提前丢弃请求: %+v", stats)
+	}
+	if got := Algorithm(limiter); got != "warmup_token_bucket" {
+		t.Errorf("算法名称错误: %s", got)
+	}
+}
@@ -0,0 +1,252 @@
+package limit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrRetryBudgetExhausted 重试预算用完，放弃重试
+var ErrRetryBudgetExhausted = errors.New("limit: retry budget exhausted")
+
+// RetryBudget 重试预算，限制重试占请求的比例，避免下游故障时重试把流量放大成雪崩
+// 每个请求按 ratio 向令牌桶存入令牌（例如 0.1 表示每10个请求存入1个），每次重试消耗1个令牌
+// 令牌桶自身的补充速率是独立于请求数的重试下限（floor）：请求很少时也能每秒重试这么多次，
+// 但它会叠加在 ratio 之上，下游故障时实际重试数最多为 ratio*请求数 + 补充速率*时间
+// 需要严格按比例限制时补充速率设为 0（没有下限），桶里只有初始令牌和请求存入的令牌
+type RetryBudget struct {
+	bucket *TokenBucket // 重试令牌桶
+	ratio  int64        // 每个请求存入的令牌数（按 tokenScale 缩放）
+	credit int64        // 不足一个令牌的存入进度（按 tokenScale 缩放）
+	mutex  sync.Mutex   // 互斥锁
+}
+
+// NewRetryBudget 创建重试预算
+// bucket: 重试令牌桶，容量是可以积攒的重试数，补充速率是每秒至少允许的重试数（下限），0 表示没有下限
+// ratio: 初始令牌用完后，重试数占请求数的最大比例（不含下限），如 0.1
+func NewRetryBudget(bucket *TokenBucket, ratio float64) *RetryBudget {
+	return &RetryBudget{
+		bucket: bucket,
+		ratio:  int64(max(ratio, 0) * float64(tokenScale)),
+	}
+}
+
+// Deposit 记录一个请求，按比例存入重试令牌
+func (rb *RetryBudget) Deposit() {
+	rb.mutex.Lock()
+	rb.credit += rb.ratio
+	n := rb.credit / tokenScale
+	rb.credit %= tokenScale
+	rb.mutex.Unlock()
+	rb.bucket.Deposit(n)
+}
+
+// Withdraw 尝试消耗一个重试令牌
+func (rb *RetryBudget) Withdraw() bool {
+	return rb.bucket.Allow()
+}
+
+// Allow 尝试消耗一个重试令牌，实现 RateLimiter
+func (rb *RetryBudget) Allow() bool {
+	return rb.Withdraw()
+}
+
+// GetStatus 获取重试令牌桶的状态
+func (rb *RetryBudget) GetStatus() (int64, int64) {
+	return rb.bucket.GetStatus()
+}
+
+// Algorithm 获取算法名称，计量方式和令牌桶相同
+func (rb *RetryBudget) Algorithm() string {
+	return "token_bucket"
+}
+
+// Unwrap 获取内部的令牌桶
+func (rb *RetryBudget) Unwrap() RateLimiter {
+	return rb.bucket
+}
+
+// Stop 停止令牌桶
+func (rb *RetryBudget) Stop() {
+	rb.bucket.Stop()
+}
+
+// RetryAfterError 服务端要求至少等待 After 后再重试的错误
+type RetryAfterError struct {
+	Err   error         // 原始错误
+	After time.Duration // 服务端要求的等待时间
+}
+
+// Error 实现 error
+func (e *RetryAfterError) Error() string {
+	return fmt.Sprintf("%v (retry after %s)", e.Err, e.After)
+}
+
+// Unwrap 获取原始错误
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
+
+// RetryAfter 给 err 附加服务端要求的等待时间，Retrier 会至少等待 d 再重试
+func RetryAfter(err error, d time.Duration) error {
+	return &RetryAfterError{Err: err, After: d}
+}
+
+// ResponseRetryAfter 解析响应的 Retry-After，支持秒数和 HTTP 日期两种格式
+func ResponseRetryAfter(resp *http.Response) (time.Duration, bool) {
+	return parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+}
+
+// RetryStats 重试的计数
+type RetryStats struct {
+	Calls           int64 `json:"calls"`            // Do 的调用次数
+	Attempts        int64 `json:"attempts"`         // fn 的调用次数
+	Retries         int64 `json:"retries"`          // 重试次数
+	BudgetExhausted int64 `json:"budget_exhausted"` // 因为重试预算用完放弃的次数
+	Deadline        int64 `json:"deadline"`         // 因为等待会超过 ctx 的截止时间放弃的次数
+}
+
+// RetryOption Retrier 的可选配置
+type RetryOption func(*Retrier)
+
+// WithBackoff 设置指数退避的参数，第 i 次重试前等待 min(base*multiplier^(i-1), max)，默认 100ms、10s、2
+func WithBackoff(base, maxDelay time.Duration, multiplier float64) RetryOption {
+	return func(r *Retrier) {
+		r.base = base
+		r.maxDelay = maxDelay
+		r.multiplier = max(multiplier, 1)
+	}
+}
+
+// WithJitter 设置抖动比例，实际等待时间在 [delay*(1-jitter), delay] 之间随机，默认 0.5
+// 抖动让同时失败的客户端错开重试的时间
+func WithJitter(jitter float64) RetryOption {
+	return func(r *Retrier) {
+		r.jitter = min(max(jitter, 0), 1)
+	}
+}
+
+// WithMaxAttempts 设置最多调用 fn 的次数（包含第一次），默认 3
+func WithMaxAttempts(n int) RetryOption {
+	return func(r *Retrier) {
+		r.maxAttempts = max(n, 1)
+	}
+}
+
+// WithRetryable 设置哪些错误可以重试，默认除了 ctx 的错误都可以重试
+func WithRetryable(fn func(err error) bool) RetryOption {
+	return func(r *Retrier) {
+		r.retryable = fn
+	}
+}
+
+// WithRetryClock 设置 Retrier 使用的时钟，默认使用系统时间
+func WithRetryClock(clock Clock) RetryOption {
+	return func(r *Retrier) {
+		r.clock = clock
+	}
+}
+
+// Retrier 带指数退避和抖动的重试
+// 1. 每次调用 Do 向重试预算存入令牌，每次重试消耗令牌，预算用完时放弃重试
+// 2. 错误带有 RetryAfterError 时至少等待服务端要求的时间
+// 3. 等待会超过 ctx 的截止时间时直接放弃，不做注定超时的重试
+type Retrier struct {
+	budget      *RetryBudget         // 重试预算，为 nil 时不限制
+	base        time.Duration        // 第一次重试前的等待时间
+	maxDelay    time.Duration        // 最长等待时间
+	multiplier  float64              // 每次重试等待时间的倍数
+	jitter      float64              // 抖动比例
+	maxAttempts int                  // 最多调用 fn 的次数
+	retryable   func(err error) bool // 错误是否可以重试
+	clock       Clock                // 时钟
+	calls       atomic.Int64         // Do 的调用次数
+	attempts    atomic.Int64         // fn 的调用次数
+	retries     atomic.Int64         // 重试次数
+	exhausted   atomic.Int64         // 重试预算用完的次数
+	deadline    atomic.Int64         // 等待会超过截止时间的次数
+}
+
+// NewRetrier 创建重试器，budget 为 nil 时不限制重试比例
+func NewRetrier(budget *RetryBudget, opts ...RetryOption) *Retrier {
+	r := &Retrier{
+		budget:      budget,
+		base:        100 * time.Millisecond,
+		maxDelay:    10 * time.Second,
+		multiplier:  2,
+		jitter:      0.5,
+		maxAttempts: 3,
+		retryable:   defaultRetryable,
+		clock:       realClock{},
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// defaultRetryable 除了 ctx 的错误都可以重试
+func defaultRetryable(err error) bool {
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+// Do 调用 fn，失败时按退避策略重试，返回最后一次的错误
+// 预算用完时返回的错误同时包装了 ErrRetryBudgetExhausted 和 fn 的错误
+func (r *Retrier) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	r.calls.Add(1)
+	if r.budget != nil {
+		r.budget.Deposit()
+	}
+	for attempt := 1; ; attempt++ {
+		r.attempts.Add(1)
+		err := fn(ctx)
+		if err == nil || attempt >= r.maxAttempts || !r.retryable(err) || ctx.Err() != nil {
+			return err
+		}
+
+		delay := r.delay(attempt)
+		var after *RetryAfterError
+		if errors.As(err, &after) {
+			delay = max(delay, after.After)
+		}
+		// ctx 的截止时间是系统时间，不使用 r.clock
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			r.deadline.Add(1)
+			return err
+		}
+		if r.budget != nil && !r.budget.Withdraw() {
+			r.exhausted.Add(1)
+			return fmt.Errorf("%w: %w", ErrRetryBudgetExhausted, err)
+		}
+		if sleepContext(ctx, r.clock, delay) != nil {
+			return err
+		}
+		r.retries.Add(1)
+	}
+}
+
+// delay 计算第 attempt 次失败后的等待时间
+func (r *Retrier) delay(attempt int) time.Duration {
+	d := float64(r.base)
+	for i := 1; i < attempt && d < float64(r.maxDelay); i++ {
+		d *= r.multiplier
+	}
+	d = min(d, float64(r.maxDelay))
+	return time.Duration(d * (1 - r.jitter*rand.Float64()))
+}
+
+// Stats 获取重试的计数
+func (r *Retrier) Stats() RetryStats {
+	return RetryStats{
+		Calls:           r.calls.Load(),
+		Attempts:        r.attempts.Load(),
+		Retries:         r.retries.Load(),
+		BudgetExhausted: r.exhausted.Load(),
+		Deadline:        r.deadline.Load(),
+	}
+}
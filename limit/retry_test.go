@@ -0,0 +1,230 @@
+package limit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+var errTemporary = errors.New("temporary")
+
+// manualClock 测试用的时钟，Sleep 不阻塞而是直接把时间拨快
+type manualClock struct {
+	now   time.Time
+	mutex sync.Mutex
+}
+
+func newManualClock() *manualClock {
+	return &manualClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *manualClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *manualClock) Sleep(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// TestRetrier_Backoff 测试指数退避
+func TestRetrier_Backoff(t *testing.T) {
+	clock := newManualClock()
+	start := clock.Now()
+	r := NewRetrier(nil, WithBackoff(100*time.Millisecond, 300*time.Millisecond, 2), WithJitter(0),
+		WithMaxAttempts(4), WithRetryClock(clock))
+
+	var at []time.Duration
+	err := r.Do(context.Background(), func(ctx context.Context) error {
+		at = append(at, clock.Now().Sub(start))
+		return errTemporary
+	})
+	if !errors.Is(err, errTemporary) {
+		t.Fatalf("应该返回最后一次的错误: %v", err)
+	}
+	// 等待 100ms、200ms、300ms（封顶）
+	want := []time.Duration{0, 100 * time.Millisecond, 300 * time.Millisecond, 600 * time.Millisecond}
+	if len(at) != len(want) {
+		t.Fatalf("调用次数错误: %v", at)
+	}
+	for i := range want {
+		if at[i] != want[i] {
+			t.Errorf("第%d次调用的时间错误: %s", i+1, at[i])
+		}
+	}
+	if s := r.Stats(); s.Calls != 1 || s.Attempts != 4 || s.Retries != 3 {
+		t.Errorf("计数错误: %+v", s)
+	}
+}
+
+// TestRetrier_Jitter 测试抖动后的等待时间在范围内
+func TestRetrier_Jitter(t *testing.T) {
+	r := NewRetrier(nil, WithBackoff(time.Second, time.Minute, 2), WithJitter(0.5))
+	for i := 0; i < 100; i++ {
+		if d := r.delay(2); d < time.Second || d > 2*time.Second {
+			t.Fatalf("等待时间超出范围: %s", d)
+		}
+	}
+}
+
+// TestRetrier_Success 测试成功和不可重试的错误不会重试
+func TestRetrier_Success(t *testing.T) {
+	clock := newManualClock()
+	permanent := errors.New("permanent")
+	r := NewRetrier(nil, WithRetryClock(clock), WithRetryable(func(err error) bool {
+		return !errors.Is(err, permanent)
+	}))
+
+	calls := 0
+	err := r.Do(context.Background(), func(ctx context.Context) error {
+		calls++
+		if calls < 2 {
+			return errTemporary
+		}
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Errorf("第二次应该成功: err=%v, calls=%d", err, calls)
+	}
+
+	calls = 0
+	err = r.Do(context.Background(), func(ctx context.Context) error {
+		calls++
+		return permanent
+	})
+	if !errors.Is(err, permanent) || calls != 1 {
+		t.Errorf("不可重试的错误不应该重试: err=%v, calls=%d", err, calls)
+	}
+}
+
+// TestRetrier_Budget 测试重试不超过请求数的比例
+func TestRetrier_Budget(t *testing.T) {
+	clock := newManualClock()
+	// 没有初始令牌，也没有下限，只靠请求存入
+	bucket := NewTokenBucket(100, 0, WithClock(clock))
+	bucket.AllowN(100)
+	budget := NewRetryBudget(bucket, 0.1)
+	r := NewRetrier(budget, WithRetryClock(clock), WithMaxAttempts(2))
+
+	var exhausted int
+	for i := 0; i < 100; i++ {
+		err := r.Do(context.Background(), func(ctx context.Context) error {
+			return errTemporary
+		})
+		if errors.Is(err, ErrRetryBudgetExhausted) {
+			exhausted++
+			if !errors.Is(err, errTemporary) {
+				t.Fatalf("应该同时包装 fn 的错误: %v", err)
+			}
+		}
+	}
+	s := r.Stats()
+	if s.Retries != 10 || s.BudgetExhausted != 90 || exhausted != 90 {
+		t.Errorf("重试应该是请求数的10%%: %+v", s)
+	}
+	if got := Algorithm(budget); got != "token_bucket" {
+		t.Errorf("算法名称错误: %s", got)
+	}
+}
+
+// TestRetryBudget_Ratio 测试初始令牌用完后重试数不超过请求数的比例，补充速率是额外的下限
+func TestRetryBudget_Ratio(t *testing.T) {
+	clock := newManualClock()
+	const burst, ratio = 20, 0.2
+	run := func(budget *RetryBudget) RetryStats {
+		r := NewRetrier(budget, WithRetryClock(clock), WithMaxAttempts(4), WithBackoff(time.Millisecond, time.Millisecond, 1))
+		for i := 0; i < 500; i++ {
+			_ = r.Do(context.Background(), func(ctx context.Context) error { return errTemporary })
+		}
+		return r.Stats()
+	}
+
+	// 没有下限：初始令牌之外的重试不超过 ratio
+	s := run(NewRetryBudget(NewTokenBucket(burst, 0, WithClock(clock)), ratio))
+	if float64(s.Retries-burst) > ratio*float64(s.Calls) {
+		t.Errorf("初始令牌用完后重试比例超过 %.1f: %+v", ratio, s)
+	}
+	if s.Retries < burst+int64(ratio*float64(s.Calls))-1 {
+		t.Errorf("存入的令牌应该都能用于重试: %+v", s)
+	}
+
+	// 有下限：每秒补充的令牌叠加在 ratio 之上，补充量按实际经过的时间计算
+	start := clock.Now()
+	s = run(NewRetryBudget(NewTokenBucket(burst, 100, WithClock(clock)), ratio))
+	floor := 100 * clock.Now().Sub(start).Seconds()
+	if float64(s.Retries-burst) > ratio*float64(s.Calls)+floor+1 {
+		t.Errorf("重试数超过比例加下限: %+v, floor=%.0f", s, floor)
+	}
+	if float64(s.Retries-burst) <= ratio*float64(s.Calls) {
+		t.Errorf("有下限时重试数应该超过比例: %+v", s)
+	}
+}
+
+// TestRetrier_RetryAfter 测试服务端要求的等待时间
+func TestRetrier_RetryAfter(t *testing.T) {
+	clock := newManualClock()
+	start := clock.Now()
+	r := NewRetrier(nil, WithBackoff(time.Millisecond, time.Second, 2), WithRetryClock(clock), WithMaxAttempts(2))
+
+	var second time.Duration
+	calls := 0
+	r.Do(context.Background(), func(ctx context.Context) error {
+		calls++
+		if calls == 1 {
+			return RetryAfter(errTemporary, 5*time.Second)
+		}
+		second = clock.Now().Sub(start)
+		return nil
+	})
+	if second != 5*time.Second {
+		t.Errorf("应该等待服务端要求的时间: %s", second)
+	}
+
+	resp := &http.Response{Header: http.Header{"Retry-After": []string{"3"}}}
+	if d, ok := ResponseRetryAfter(resp); !ok || d != 3*time.Second {
+		t.Errorf("解析 Retry-After 错误: %s", d)
+	}
+}
+
+// TestRetrier_Deadline 测试等待会超过截止时间时放弃
+func TestRetrier_Deadline(t *testing.T) {
+	r := NewRetrier(nil)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	calls := 0
+	begin := time.Now()
+	err := r.Do(ctx, func(ctx context.Context) error {
+		calls++
+		return RetryAfter(errTemporary, time.Minute)
+	})
+	if !errors.Is(err, errTemporary) || calls != 1 {
+		t.Errorf("等待会超过截止时间时不应该重试: err=%v, calls=%d", err, calls)
+	}
+	if time.Since(begin) > 100*time.Millisecond {
+		t.Error("应该立即放弃")
+	}
+	if s := r.Stats(); s.Deadline != 1 {
+		t.Errorf("计数错误: %+v", s)
+	}
+}
+
+// TestTokenBucket_Deposit 测试存入令牌
+func TestTokenBucket_Deposit(t *testing.T) {
+	tb := NewTokenBucket(3, 1)
+	tb.AllowN(3)
+	tb.Deposit(2)
+	if current, _ := tb.GetStatus(); current != 2 {
+		t.Errorf("令牌数错误: %d", current)
+	}
+	tb.Deposit(5)
+	if current, _ := tb.GetStatus(); current != 3 {
+		t.Errorf("不能超过桶容量: %d", current)
+	}
+}
@@ -0,0 +1,230 @@
+package limit
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Schedule 一条按时间生效的限流配置
+// 对 FixedWindowCounter 生效的是 Limit 和 Window，对 TokenBucket 生效的是 Limit（桶容量）和 Rate
+type Schedule struct {
+	Name     string         // 配置名称，例如 "evening-peak"
+	Weekdays []time.Weekday // 生效的星期，为空表示每天
+	Start    string         // 每天生效的开始时间，格式 "HH:MM"，为空表示 00:00
+	End      string         // 每天生效的结束时间（不含），格式 "HH:MM"，为空表示 24:00；早于 Start 时跨越午夜
+	From     time.Time      // 生效的起始日期（含），为零值表示不限制，用于大型活动
+	To       time.Time      // 生效的截止日期（不含），为零值表示不限制
+	Limit    int64          // 窗口内的请求数 / 桶容量
+	Window   time.Duration  // 固定窗口的时间窗口
+	Rate     int64          // 令牌桶每秒补充的令牌数
+
+	start, end time.Duration // 解析后的每日起止时间（距午夜）
+}
+
+// parse 解析并校验每日起止时间
+func (s *Schedule) parse() error {
+	var err error
+	if s.start, err = parseClock(s.Start, 0); err != nil {
+		return fmt.Errorf("limit: schedule %q: %w", s.Name, err)
+	}
+	if s.end, err = parseClock(s.End, 24*time.Hour); err != nil {
+		return fmt.Errorf("limit: schedule %q: %w", s.Name, err)
+	}
+	return nil
+}
+
+// parseClock 解析 "HH:MM" 格式的时间，返回距午夜的时长
+func parseClock(s string, def time.Duration) (time.Duration, error) {
+	if s == "" {
+		return def, nil
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// matches 判断时刻是否命中该配置，now 需已转换到配置的时区
+func (s *Schedule) matches(now time.Time) bool {
+	if !s.From.IsZero() && now.Before(s.From) {
+		return false
+	}
+	if !s.To.IsZero() && !now.Before(s.To) {
+		return false
+	}
+
+	// 按钟面时间计算，夏令时切换当天从午夜经过的时长和钟面时间相差一小时
+	offset := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute +
+		time.Duration(now.Second())*time.Second + time.Duration(now.Nanosecond())
+	day := now.Weekday()
+	if s.start <= s.end {
+		return offset >= s.start && offset < s.end && s.onDay(day)
+	}
+	// 跨越午夜：今天 start 之后，或者昨天开始的时段延续到今天 end 之前
+	if offset >= s.start {
+		return s.onDay(day)
+	}
+	return offset < s.end && s.onDay((day+6)%7)
+}
+
+// onDay 判断星期是否生效
+func (s *Schedule) onDay(day time.Weekday) bool {
+	if len(s.Weekdays) == 0 {
+		return true
+	}
+	for _, d := range s.Weekdays {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// ScheduleStatus 定时限流器状态
+type ScheduleStatus struct {
+	Active  string // 当前生效的配置名称
+	Current int64  // 被包装限流器的当前值
+	Limit   int64  // 被包装限流器的限制
+}
+
+// ScheduledLimiter 按时间段切换限流配置的限流器
+// 1. 按顺序匹配配置，第一个命中的生效，都不命中时使用默认配置
+// 2. 切换配置时只调整参数，不重置计数和令牌
+type ScheduledLimiter struct {
+	limiter   RateLimiter    // 被包装的限流器
+	apply     func(Schedule) // 将配置应用到限流器
+	location  *time.Location // 配置使用的时区
+	fallback  Schedule       // 默认配置
+	schedules []Schedule     // 按优先级排列的配置
+	active    int            // 当前生效的配置在 schedules 中的下标，-1 为默认配置
+	clock     Clock          // 时钟
+	mutex     sync.Mutex     // 互斥锁
+}
+
+// NewScheduledLimiter 创建定时限流器
+// limiter: 被包装的 *FixedWindowCounter 或 *TokenBucket
+// location: 配置使用的时区，为 nil 时使用 time.Local
+// fallback: 没有配置命中时使用的默认配置
+// schedules: 按优先级排列的配置
+// opts: 支持 WithClock（判断当前时间命中哪个配置）
+func NewScheduledLimiter(limiter RateLimiter, location *time.Location, fallback Schedule, schedules []Schedule, opts ...Option) (*ScheduledLimiter, error) {
+	o := newOptions(opts)
+	sl := &ScheduledLimiter{
+		limiter:   limiter,
+		location:  location,
+		fallback:  fallback,
+		schedules: make([]Schedule, len(schedules)),
+		clock:     o.clock,
+	}
+	if sl.location == nil {
+		sl.location = time.Local
+	}
+	if sl.fallback.Name == "" {
+		sl.fallback.Name = "default"
+	}
+
+	// validate 校验配置中对该限流器生效的参数
+	var validate func(Schedule) error
+	switch l := limiter.(type) {
+	case *FixedWindowCounter:
+		sl.apply = func(s Schedule) { l.SetLimit(s.Limit, s.Window) }
+		validate = func(s Schedule) error {
+			if s.Limit <= 0 || s.Window <= 0 {
+				return fmt.Errorf("limit: schedule %q: fixed window needs positive limit and window", s.Name)
+			}
+			return nil
+		}
+	case *TokenBucket:
+		sl.apply = func(s Schedule) { l.SetRate(s.Limit, s.Rate) }
+		validate = func(s Schedule) error {
+			if s.Limit <= 0 || s.Rate <= 0 {
+				return fmt.Errorf("limit: schedule %q: token bucket needs positive limit and rate", s.Name)
+			}
+			return nil
+		}
+	default:
+		return nil, fmt.Errorf("limit: scheduled limiter does not support %s", Algorithm(limiter))
+	}
+
+	if err := validate(sl.fallback); err != nil {
+		return nil, err
+	}
+	copy(sl.schedules, schedules)
+	for i := range sl.schedules {
+		if err := sl.schedules[i].parse(); err != nil {
+			return nil, err
+		}
+		if err := validate(sl.schedules[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	sl.active = sl.match()
+	sl.apply(sl.schedule(sl.active))
+	return sl, nil
+}
+
+// match 获取当前时间命中的第一个配置的下标，都不命中时返回 -1
+func (sl *ScheduledLimiter) match() int {
+	now := sl.clock.Now().In(sl.location)
+	for i := range sl.schedules {
+		if sl.schedules[i].matches(now) {
+			return i
+		}
+	}
+	return -1
+}
+
+// schedule 获取下标对应的配置，-1 为默认配置
+func (sl *ScheduledLimiter) schedule(i int) Schedule {
+	if i < 0 {
+		return sl.fallback
+	}
+	return sl.schedules[i]
+}
+
+// sync 根据当前时间切换配置，调用方需持有锁
+// 按下标而不是名称判断配置是否变化，名称为空或重复的配置之间也能正确切换
+func (sl *ScheduledLimiter) sync() {
+	if i := sl.match(); i != sl.active {
+		sl.apply(sl.schedule(i))
+		sl.active = i
+	}
+}
+
+// Allow 检查是否允许请求通过，必要时先切换配置
+func (sl *ScheduledLimiter) Allow() bool {
+	sl.mutex.Lock()
+	sl.sync()
+	sl.mutex.Unlock()
+	return sl.limiter.Allow()
+}
+
+// GetStatus 获取被包装限流器的状态
+func (sl *ScheduledLimiter) GetStatus() (int64, int64) {
+	status := sl.Status()
+	return status.Current, status.Limit
+}
+
+// Status 获取当前生效的配置和被包装限流器的状态
+func (sl *ScheduledLimiter) Status() ScheduleStatus {
+	sl.mutex.Lock()
+	sl.sync()
+	active := sl.schedule(sl.active).Name
+	sl.mutex.Unlock()
+
+	current, limit := sl.limiter.GetStatus()
+	return ScheduleStatus{Active: active, Current: current, Limit: limit}
+}
+
+// Algorithm 获取被包装限流器的算法
+func (sl *ScheduledLimiter) Algorithm() string {
+	return Algorithm(sl.limiter)
+}
+
+// Stop 停止被包装的限流器
+func (sl *ScheduledLimiter) Stop() {
+	stopLimiter(sl.limiter)
+}
@@ -0,0 +1,202 @@
+package limit
+
+import (
+	"testing"
+	"time"
+)
+
+// TestSchedule_Matches 测试时间段匹配
+func TestSchedule_Matches(t *testing.T) {
+	shanghai := time.FixedZone("CST", 8*3600)
+	peak := Schedule{Name: "peak", Start: "19:00", End: "23:00"}
+	night := Schedule{Name: "night", Weekdays: []time.Weekday{time.Friday}, Start: "22:00", End: "02:00"}
+	event := Schedule{
+		Name: "double11",
+		From: time.Date(2026, 11, 11, 0, 0, 0, 0, shanghai),
+		To:   time.Date(2026, 11, 12, 0, 0, 0, 0, shanghai),
+	}
+	for _, s := range []*Schedule{&peak, &night, &event} {
+		if err := s.parse(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		schedule *Schedule
+		at       time.Time
+		want     bool
+	}{
+		{&peak, time.Date(2026, 10, 16, 19, 0, 0, 0, shanghai), true},
+		{&peak, time.Date(2026, 10, 16, 23, 0, 0, 0, shanghai), false},
+		{&peak, time.Date(2026, 10, 16, 4, 0, 0, 0, shanghai), false},
+		{&night, time.Date(2026, 10, 16, 23, 30, 0, 0, shanghai), true}, // 周五晚上
+		{&night, time.Date(2026, 10, 17, 1, 30, 0, 0, shanghai), true},  // 周五的时段延续到周六凌晨
+		{&night, time.Date(2026, 10, 18, 1, 30, 0, 0, shanghai), false}, // 周日凌晨不生效
+		{&night, time.Date(2026, 10, 17, 23, 0, 0, 0, shanghai), false}, // 周六晚上不生效
+		{&event, time.Date(2026, 11, 11, 12, 0, 0, 0, shanghai), true},
+		{&event, time.Date(2026, 11, 12, 0, 0, 0, 0, shanghai), false},
+	}
+	for i, tc := range testCases {
+		if got := tc.schedule.matches(tc.at); got != tc.want {
+			t.Errorf("第%d个用例 %s 在 %v 匹配结果错误: %v", i+1, tc.schedule.Name, tc.at, got)
+		}
+	}
+}
+
+// TestSchedule_MatchesDST 测试夏令时切换当天按钟面时间匹配
+func TestSchedule_MatchesDST(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("没有时区数据: %v", err)
+	}
+	peak := Schedule{Name: "peak", Start: "19:00", End: "23:00"}
+	if err := peak.parse(); err != nil {
+		t.Fatal(err)
+	}
+	// 2026-03-08 凌晨2点拨快到3点，当天午夜到19:00只经过了18小时；11-01 凌晨2点拨回1点，经过了20小时
+	testCases := []struct {
+		at   time.Time
+		want bool
+	}{
+		{time.Date(2026, 3, 8, 19, 0, 0, 0, newYork), true},
+		{time.Date(2026, 3, 8, 18, 59, 0, 0, newYork), false},
+		{time.Date(2026, 11, 1, 19, 0, 0, 0, newYork), true},
+		{time.Date(2026, 11, 1, 18, 59, 0, 0, newYork), false},
+	}
+	for _, tc := range testCases {
+		if got := peak.matches(tc.at); got != tc.want {
+			t.Errorf("%v 匹配结果错误: %v", tc.at, got)
+		}
+	}
+}
+
+// TestScheduledLimiter_Switch 测试到达边界时切换配置且不重置计数
+func TestScheduledLimiter_Switch(t *testing.T) {
+	shanghai := time.FixedZone("CST", 8*3600)
+	clock := &manualClock{now: time.Date(2026, 10, 16, 18, 59, 0, 0, shanghai)}
+
+	counter := NewFixedWindowCounter(0, time.Hour)
+	limiter, err := NewScheduledLimiter(counter, shanghai,
+		Schedule{Limit: 3, Window: time.Hour},
+		[]Schedule{{Name: "evening-peak", Start: "19:00", End: "23:00", Limit: 5, Window: time.Hour}},
+		WithClock(clock),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status := limiter.Status()
+	if status.Active != "default" || status.Limit != 3 {
+		t.Fatalf("默认配置状态错误: %+v", status)
+	}
+	for i := 0; i < 3; i++ {
+		limiter.Allow()
+	}
+	if limiter.Allow() {
+		t.Error("默认配置下第4个请求应该被拒绝")
+	}
+
+	// 进入晚高峰，限额提升到5，已有的3次计数保留
+	clock.Sleep(time.Minute)
+	if !limiter.Allow() || !limiter.Allow() {
+		t.Error("晚高峰时应该还能通过2个请求")
+	}
+	if limiter.Allow() {
+		t.Error("晚高峰限额用完后应该被拒绝")
+	}
+	status = limiter.Status()
+	if status.Active != "evening-peak" || status.Current != 5 || status.Limit != 5 {
+		t.Errorf("晚高峰状态错误: %+v", status)
+	}
+}
+
+// TestScheduledLimiter_TokenBucket 测试令牌桶切换速率不重置令牌
+func TestScheduledLimiter_TokenBucket(t *testing.T) {
+	clock := &manualClock{now: time.Date(2026, 10, 16, 3, 0, 0, 0, time.UTC)}
+	bucket := NewTokenBucket(10, 1)
+	defer bucket.Stop()
+	bucket.AllowN(6)
+
+	limiter, err := NewScheduledLimiter(bucket, time.UTC,
+		Schedule{Name: "day", Limit: 20, Rate: 10},
+		[]Schedule{{Name: "4am", Start: "00:00", End: "06:00", Limit: 2, Rate: 1}},
+		WithClock(clock),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 凌晨容量缩小到2，剩余的4个令牌被截断为2
+	if current, capacity := limiter.GetStatus(); current != 2 || capacity != 2 {
+		t.Errorf("凌晨配置状态错误: current=%d, capacity=%d", current, capacity)
+	}
+
+	clock.Sleep(4 * time.Hour)
+	if status := limiter.Status(); status.Active != "day" || status.Current != 2 || status.Limit != 20 {
+		t.Errorf("白天配置状态错误: %+v", status)
+	}
+}
+
+// TestNewScheduledLimiter_Invalid 测试非法配置
+func TestNewScheduledLimiter_Invalid(t *testing.T) {
+	if _, err := NewScheduledLimiter(NewLeakyBucket(1, time.Second), nil, Schedule{}, nil); err == nil {
+		t.Error("不支持的限流器应该返回错误")
+	}
+	fallback := Schedule{Limit: 1, Window: time.Second}
+	_, err := NewScheduledLimiter(NewFixedWindowCounter(1, time.Second), nil, fallback,
+		[]Schedule{{Name: "bad", Start: "25:00", Limit: 1, Window: time.Second}})
+	if err == nil {
+		t.Error("非法时间应该返回错误")
+	}
+
+	// 缺少对限流器生效的参数
+	cases := []struct {
+		limiter   RateLimiter
+		fallback  Schedule
+		schedules []Schedule
+	}{
+		{NewFixedWindowCounter(1, time.Second), Schedule{Limit: 1}, nil},
+		{NewFixedWindowCounter(1, time.Second), fallback, []Schedule{{Name: "no-window", Start: "19:00", Limit: 5}}},
+		{NewFixedWindowCounter(1, time.Second), fallback, []Schedule{{Name: "no-limit", Start: "19:00", Window: time.Second}}},
+		{NewTokenBucket(1, 1), Schedule{Limit: 10, Rate: 1}, []Schedule{{Name: "no-rate", Start: "19:00", Limit: 10}}},
+		{NewTokenBucket(1, 1), Schedule{Rate: 1}, nil},
+	}
+	for i, tc := range cases {
+		if _, err := NewScheduledLimiter(tc.limiter, nil, tc.fallback, tc.schedules); err == nil {
+			t.Errorf("第%d个用例缺少参数时应该返回错误", i+1)
+		}
+	}
+}
+
+// TestScheduledLimiter_SameName 测试名称为空或重复的配置之间也能切换
+func TestScheduledLimiter_SameName(t *testing.T) {
+	clock := &manualClock{now: time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC)}
+	counter := NewFixedWindowCounter(1, time.Hour)
+	limiter, err := NewScheduledLimiter(counter, time.UTC,
+		Schedule{Name: "peak", Limit: 1, Window: time.Hour},
+		[]Schedule{
+			{Start: "09:00", End: "12:00", Limit: 5, Window: time.Hour},
+			{Name: "peak", Start: "12:00", End: "14:00", Limit: 8, Window: time.Hour},
+		},
+		WithClock(clock),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		at    string
+		limit int64
+	}{
+		{"08:00", 1},
+		{"09:30", 5}, // 名称为空的配置
+		{"12:30", 8}, // 和默认配置同名
+		{"15:00", 1}, // 回到同名的默认配置
+	} {
+		at, _ := time.Parse("15:04", tc.at)
+		clock.Sleep(time.Date(2026, 10, 16, at.Hour(), at.Minute(), 0, 0, time.UTC).Sub(clock.Now()))
+		if _, limit := limiter.GetStatus(); limit != tc.limit {
+			t.Errorf("%s 生效的限额错误: %d，期望 %d", tc.at, limit, tc.limit)
+		}
+	}
+}
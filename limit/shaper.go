@@ -0,0 +1,191 @@
+package limit
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ShaperOption Shaper 的可选配置
+type ShaperOption func(*Shaper)
+
+// WithPanicHandler 设置任务 panic 时的回调，默认只计数（见 Panics）
+func WithPanicHandler(fn func(p any)) ShaperOption {
+	return func(s *Shaper) {
+		s.onPanic = fn
+	}
+}
+
+// Shaper 执行任务的漏桶整形器
+// 与 LeakyBucket 让调用方 Sleep 不同，Shaper 把任务放入有界队列，
+// 由单个 worker 按漏出速率依次执行，调用方提交后立即返回
+// 任务 panic 时 worker 恢复后继续执行后续任务
+type Shaper struct {
+	capacity  int             // 队列容量
+	rate      time.Duration   // 漏出速率（每个任务的执行间隔）
+	queue     chan shaperTask // 任务队列
+	pending   atomic.Int64    // 排队的任务数，包括 worker 已经取出、正在等待漏出的任务
+	closed    bool            // 是否已关闭，不再接收新任务
+	mutex     sync.RWMutex    // 保护 closed 与向 queue 发送
+	discardCh chan struct{}   // 关闭后 worker 丢弃剩余任务
+	discard   sync.Once
+	discarded atomic.Int64  // 被丢弃的任务数
+	panics    atomic.Int64  // panic 的任务数
+	onPanic   func(p any)   // 任务 panic 时的回调
+	done      chan struct{} // worker 退出信号
+}
+
+// shaperTask 排队中的任务
+type shaperTask struct {
+	ctx context.Context
+	fn  func()
+}
+
+// NewShaper 创建任务整形器
+// capacity: 最多排队的任务数，小于 1 时按 1 处理
+// rate: 漏出速率，例如 100ms 表示每100毫秒执行一个任务，不大于 0 时任务之间不间隔
+func NewShaper(capacity int, rate time.Duration, opts ...ShaperOption) *Shaper {
+	capacity = max(capacity, 1)
+	s := &Shaper{
+		capacity:  capacity,
+		rate:      max(rate, 0),
+		queue:     make(chan shaperTask, capacity),
+		discardCh: make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	go s.run()
+	return s
+}
+
+// Submit 提交任务，队列已满时立即返回 ErrQueueFull
+// 任务执行前 ctx 已经结束时，任务会被跳过
+func (s *Shaper) Submit(ctx context.Context, fn func()) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.closed {
+		return ErrLimiterStopped
+	}
+	// worker 等待漏出时手里的任务也占用容量，pending 不超过 capacity，向 queue 发送不会阻塞
+	if s.pending.Add(1) > int64(s.capacity) {
+		s.pending.Add(-1)
+		return ErrQueueFull
+	}
+	s.queue <- shaperTask{ctx: ctx, fn: fn}
+	return nil
+}
+
+// run 按漏出速率依次执行任务
+func (s *Shaper) run() {
+	defer close(s.done)
+
+	var last time.Time
+	for task := range s.queue {
+		ok := s.wait(task, last)
+		s.pending.Add(-1)
+		if !ok {
+			continue
+		}
+		s.call(task.fn)
+		last = time.Now()
+	}
+}
+
+// wait 等待到任务可以执行，任务被丢弃或已经取消时返回 false
+func (s *Shaper) wait(task shaperTask, last time.Time) bool {
+	if s.discarding() {
+		s.discarded.Add(1)
+		return false
+	}
+	if task.ctx.Err() != nil {
+		return false
+	}
+	if wait := time.Until(last.Add(s.rate)); wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-s.discardCh:
+			timer.Stop()
+			s.discarded.Add(1)
+			return false
+		}
+	}
+	// 等待期间任务可能已经被取消
+	return task.ctx.Err() == nil
+}
+
+// call 执行任务，任务 panic 时恢复，不影响后续任务
+func (s *Shaper) call(fn func()) {
+	defer func() {
+		if p := recover(); p != nil {
+			s.panics.Add(1)
+			if s.onPanic != nil {
+				s.onPanic(p)
+			}
+		}
+	}()
+	fn()
+}
+
+// Panics 获取累计 panic 的任务数
+func (s *Shaper) Panics() int64 {
+	return s.panics.Load()
+}
+
+// discarding 是否正在丢弃剩余任务
+func (s *Shaper) discarding() bool {
+	select {
+	case <-s.discardCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// close 停止接收新任务
+func (s *Shaper) close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+}
+
+// Shutdown 优雅关闭：停止接收新任务，按速率执行完队列中剩余的任务
+// ctx 结束时丢弃尚未执行的任务并返回 ctx 的错误
+func (s *Shaper) Shutdown(ctx context.Context) error {
+	s.close()
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		s.discard.Do(func() { close(s.discardCh) })
+		<-s.done
+		return ctx.Err()
+	}
+}
+
+// ShutdownNow 立即关闭：停止接收新任务并丢弃队列中剩余的任务
+// 正在执行的任务会执行完，返回累计被丢弃的任务数
+func (s *Shaper) ShutdownNow() int64 {
+	s.close()
+	s.discard.Do(func() { close(s.discardCh) })
+	<-s.done
+	return s.discarded.Load()
+}
+
+// GetStatus 获取当前队列状态
+// current: 当前排队的任务数，包括 worker 已经取出、正在等待漏出的任务
+// capacity: 队列容量
+func (s *Shaper) GetStatus() (current int64, capacity int64) {
+	return s.pending.Load(), int64(s.capacity)
+}
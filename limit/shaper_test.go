@@ -0,0 +1,188 @@
+package limit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestShaper_Rate 测试任务按漏出速率执行
+func TestShaper_Rate(t *testing.T) {
+	shaper := NewShaper(10, 30*time.Millisecond)
+	defer shaper.ShutdownNow()
+
+	var mu sync.Mutex
+	var times []time.Time
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		err := shaper.Submit(context.Background(), func() {
+			defer wg.Done()
+			mu.Lock()
+			times = append(times, time.Now())
+			mu.Unlock()
+		})
+		if err != nil {
+			t.Fatalf("第%d个任务提交失败: %v", i+1, err)
+		}
+	}
+	// Submit 不阻塞调用方
+	if elapsed := time.Since(start); elapsed > 10*time.Millisecond {
+		t.Errorf("提交任务不应该阻塞，实际耗时: %v", elapsed)
+	}
+	wg.Wait()
+
+	for i := 1; i < len(times); i++ {
+		if gap := times[i].Sub(times[i-1]); gap < 25*time.Millisecond {
+			t.Errorf("第%d个任务与前一个间隔过短: %v", i+1, gap)
+		}
+	}
+}
+
+// TestShaper_Full 测试队列已满时立即返回错误
+func TestShaper_Full(t *testing.T) {
+	shaper := NewShaper(2, 100*time.Millisecond)
+	defer shaper.ShutdownNow()
+
+	block := make(chan struct{})
+	// 第1个任务被 worker 取走执行，后2个占满队列
+	_ = shaper.Submit(context.Background(), func() { <-block })
+	time.Sleep(10 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if err := shaper.Submit(context.Background(), func() {}); err != nil {
+			t.Fatalf("队列未满时提交失败: %v", err)
+		}
+	}
+
+	if current, capacity := shaper.GetStatus(); current != 2 || capacity != 2 {
+		t.Errorf("队列状态错误: current=%d, capacity=%d", current, capacity)
+	}
+	if err := shaper.Submit(context.Background(), func() {}); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("队列已满时应该返回 ErrQueueFull，实际: %v", err)
+	}
+	close(block)
+}
+
+// TestShaper_SkipCanceled 测试执行前被取消的任务会被跳过
+func TestShaper_SkipCanceled(t *testing.T) {
+	shaper := NewShaper(5, 50*time.Millisecond)
+
+	var ran atomic.Int32
+	_ = shaper.Submit(context.Background(), func() { ran.Add(1) })
+	ctx, cancel := context.WithCancel(context.Background())
+	_ = shaper.Submit(ctx, func() { ran.Add(10) })
+	cancel()
+
+	if err := shaper.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown 失败: %v", err)
+	}
+	if ran.Load() != 1 {
+		t.Errorf("被取消的任务不应该执行: %d", ran.Load())
+	}
+}
+
+// TestShaper_ShutdownDrain 测试优雅关闭会执行完剩余任务
+func TestShaper_ShutdownDrain(t *testing.T) {
+	shaper := NewShaper(5, 10*time.Millisecond)
+
+	var ran atomic.Int32
+	for i := 0; i < 5; i++ {
+		_ = shaper.Submit(context.Background(), func() { ran.Add(1) })
+	}
+	if err := shaper.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown 失败: %v", err)
+	}
+	if ran.Load() != 5 {
+		t.Errorf("优雅关闭应该执行完所有任务，实际执行 %d 个", ran.Load())
+	}
+	if err := shaper.Submit(context.Background(), func() {}); !errors.Is(err, ErrLimiterStopped) {
+		t.Errorf("关闭后提交应该返回 ErrLimiterStopped，实际: %v", err)
+	}
+}
+
+// TestShaper_ShutdownTimeout 测试关闭超时后丢弃剩余任务
+func TestShaper_ShutdownTimeout(t *testing.T) {
+	shaper := NewShaper(10, 50*time.Millisecond)
+
+	var ran atomic.Int32
+	for i := 0; i < 10; i++ {
+		_ = shaper.Submit(context.Background(), func() { ran.Add(1) })
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 75*time.Millisecond)
+	defer cancel()
+	if err := shaper.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("关闭超时应该返回 DeadlineExceeded，实际: %v", err)
+	}
+
+	discarded := shaper.ShutdownNow()
+	if int64(ran.Load())+discarded != 10 {
+		t.Errorf("执行数与丢弃数之和应该为10: ran=%d, discarded=%d", ran.Load(), discarded)
+	}
+	if ran.Load() > 3 {
+		t.Errorf("超时前不应该执行这么多任务: %d", ran.Load())
+	}
+}
+
+// TestShaper_PendingWaiting 测试 worker 等待漏出时手里的任务计入排队数并占用容量
+func TestShaper_PendingWaiting(t *testing.T) {
+	shaper := NewShaper(2, time.Hour)
+
+	_ = shaper.Submit(context.Background(), func() {})
+	time.Sleep(10 * time.Millisecond)
+	// 第2个任务被 worker 取出后等待漏出，第3个在队列中
+	for i := 0; i < 2; i++ {
+		if err := shaper.Submit(context.Background(), func() {}); err != nil {
+			t.Fatalf("队列未满时提交失败: %v", err)
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	if current, capacity := shaper.GetStatus(); current != 2 || capacity != 2 {
+		t.Errorf("等待漏出的任务应该计入排队数: current=%d, capacity=%d", current, capacity)
+	}
+	if err := shaper.Submit(context.Background(), func() {}); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("等待漏出的任务应该占用容量，实际: %v", err)
+	}
+	if discarded := shaper.ShutdownNow(); discarded != 2 {
+		t.Errorf("应该丢弃2个任务: %d", discarded)
+	}
+	if current, _ := shaper.GetStatus(); current != 0 {
+		t.Errorf("关闭后排队数应该为0: %d", current)
+	}
+}
+
+// TestShaper_Panic 测试任务 panic 后 worker 继续执行后续任务
+func TestShaper_Panic(t *testing.T) {
+	var recovered atomic.Value
+	shaper := NewShaper(5, 0, WithPanicHandler(func(p any) { recovered.Store(p) }))
+
+	var ran atomic.Int32
+	_ = shaper.Submit(context.Background(), func() { panic("boom") })
+	_ = shaper.Submit(context.Background(), func() { ran.Add(1) })
+	if err := shaper.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if ran.Load() != 1 || shaper.Panics() != 1 || recovered.Load() != "boom" {
+		t.Errorf("panic 后应该继续执行: ran=%d, panics=%d, recovered=%v", ran.Load(), shaper.Panics(), recovered.Load())
+	}
+}
+
+// TestShaper_Invalid 测试非法参数按最小值处理
+func TestShaper_Invalid(t *testing.T) {
+	shaper := NewShaper(0, -time.Second)
+	var ran atomic.Int32
+	for i := 0; i < 3; i++ {
+		for shaper.Submit(context.Background(), func() { ran.Add(1) }) != nil {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if err := shaper.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, capacity := shaper.GetStatus(); capacity != 1 || ran.Load() != 3 {
+		t.Errorf("容量应该按1处理: capacity=%d, ran=%d", capacity, ran.Load())
+	}
+}
@@ -6,62 +6,97 @@ import (
 )
 
 // SlidingWindowCounter 滑动窗口计数器限流器
+// 子窗口按时间顺序保存在环形缓冲区中，只保存有请求的子窗口，并维护窗口内的请求总数
+// 稳定运行后 Allow 不分配内存，缓冲区只在有请求的子窗口数超过容量时扩容
 type SlidingWindowCounter struct {
-	limit     int64           // 限制数量
-	window    time.Duration   // 时间窗口
-	requests  map[int64]int64 // 时间戳到请求数的映射
-	mutex     sync.Mutex      // 互斥锁
-	precision time.Duration   // 精度（子窗口大小）
+	limit     int64         // 限制数量
+	window    time.Duration // 时间窗口
+	slots     []slot        // 子窗口的环形缓冲区，按开始时间递增
+	head      int           // 最早的子窗口的下标
+	size      int           // 子窗口的数量
+	total     int64         // 窗口内的请求总数
+	mutex     sync.Mutex    // 互斥锁
+	precision time.Duration // 精度（子窗口大小）
+	clock     Clock         // 时钟
+}
+
+// slot 滑动窗口的子窗口
+type slot struct {
+	start int64 // 开始时间（纳秒）
+	count int64 // 请求数
 }
 
 // NewSlidingWindowCounter 创建滑动窗口计数器
-func NewSlidingWindowCounter(limit int64, window time.Duration, precision time.Duration) *SlidingWindowCounter {
+func NewSlidingWindowCounter(limit int64, window time.Duration, precision time.Duration, opts ...Option) *SlidingWindowCounter {
 	return &SlidingWindowCounter{
 		limit:     limit,
 		window:    window,
-		requests:  make(map[int64]int64),
+		slots:     make([]slot, 8),
 		precision: precision,
+		clock:     newOptions(opts).clock,
 	}
 }
 
 // Allow 检查是否允许请求通过
 func (s *SlidingWindowCounter) Allow() bool {
+	return s.AllowN(1)
+}
+
+// AllowN 检查是否允许 n 个请求同时通过，不足时一个也不计数
+func (s *SlidingWindowCounter) AllowN(n int64) bool {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
-	now := time.Now()
-	currentWindow := now.Truncate(s.precision).Unix()
-	s.cleanExpiredWindows(now)                    // 清理过期的窗口数据
-	totalRequests := s.countRequestsInWindow(now) // 计算当前窗口内的总请求数
-	if totalRequests >= s.limit {                 // 检查是否超过限制
+	now := s.clock.Now().UnixNano()
+	s.cleanExpiredWindows(now) // 清理过期的窗口数据
+	if s.total+n > s.limit {   // 检查是否超过限制
 		return false
 	}
-	s.requests[currentWindow]++ // 增加当前窗口的计数
+	s.add(now, n) // 增加当前窗口的计数
 	return true
 }
 
-// cleanExpiredWindows 清理过期的窗口数据
-func (s *SlidingWindowCounter) cleanExpiredWindows(now time.Time) {
-	cutoff := now.Add(-s.window).Unix()
-	for timestamp := range s.requests {
-		if timestamp < cutoff {
-			delete(s.requests, timestamp)
-		}
+// cleanExpiredWindows 清理过期的子窗口，调用方需持有锁
+// 子窗口整个落在窗口之外才过期，部分仍在窗口内的子窗口继续计数，保证任意一个窗口内的请求数都不超过限制
+func (s *SlidingWindowCounter) cleanExpiredWindows(now int64) {
+	cutoff := now - int64(s.window)
+	precision := max(int64(s.precision), 1)
+	for s.size > 0 && s.slots[s.head].start+precision <= cutoff {
+		s.total -= s.slots[s.head].count
+		s.slots[s.head] = slot{}
+		s.head = (s.head + 1) % len(s.slots)
+		s.size--
 	}
 }
 
-// countRequestsInWindow 计算窗口内的请求总数
-func (s *SlidingWindowCounter) countRequestsInWindow(now time.Time) int64 {
-	cutoff := now.Add(-s.window)
-	total := int64(0)
-
-	for timestamp, count := range s.requests {
-		windowTime := time.Unix(timestamp, 0)
-		if windowTime.After(cutoff) {
-			total += count
+// add 把 n 个请求计入 now 所在的子窗口，调用方需持有锁
+func (s *SlidingWindowCounter) add(now int64, n int64) {
+	precision := max(int64(s.precision), 1)
+	start := now - now%precision
+	s.total += n
+	if s.size > 0 {
+		// 时钟回拨时计入最新的子窗口
+		if last := &s.slots[(s.head+s.size-1)%len(s.slots)]; last.start >= start {
+			last.count += n
+			return
 		}
 	}
+	if s.size == len(s.slots) {
+		slots := make([]slot, 2*len(s.slots))
+		for i := 0; i < s.size; i++ {
+			slots[i] = s.slots[(s.head+i)%len(s.slots)]
+		}
+		s.slots, s.head = slots, 0
+	}
+	s.slots[(s.head+s.size)%len(s.slots)] = slot{start: start, count: n}
+	s.size++
+}
 
-	return total
+// SetLimit 调整限制数量和时间窗口，保留已有的请求记录
+func (s *SlidingWindowCounter) SetLimit(limit int64, window time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.limit = limit
+	s.window = window
 }
 
 // GetStatus 获取当前状态
@@ -69,9 +104,6 @@ func (s *SlidingWindowCounter) GetStatus() (int64, int64) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	now := time.Now()
-	s.cleanExpiredWindows(now)
-	current := s.countRequestsInWindow(now)
-
-	return current, s.limit
+	s.cleanExpiredWindows(s.clock.Now().UnixNano())
+	return s.total, s.limit
 }
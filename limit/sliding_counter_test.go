@@ -123,3 +123,22 @@ func BenchmarkSlidingWindowCounter_GetStatus(b *testing.B) {
 		}
 	})
 }
+
+// TestSlidingWindowCounter_AllowN 测试一次通过多个请求
+func TestSlidingWindowCounter_AllowN(t *testing.T) {
+	limiter := NewSlidingWindowCounter(5, time.Second, 100*time.Millisecond)
+
+	if !limiter.AllowN(3) {
+		t.Error("3个请求应该通过")
+	}
+	// 剩余2个名额，不足时一个也不计数
+	if limiter.AllowN(3) {
+		t.Error("名额不足时应该被拒绝")
+	}
+	if current, _ := limiter.GetStatus(); current != 3 {
+		t.Errorf("被拒绝的请求不应该计数: current=%d", current)
+	}
+	if !limiter.AllowN(2) {
+		t.Error("2个请求应该通过")
+	}
+}
@@ -1,75 +1,99 @@
 package limit
 
 import (
+	"context"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // TokenBucket 令牌桶算法实现
+// 令牌在每次访问时按流逝的时间补充，没有后台协程
+// 使用 WithDebt 开启透支模式后，没有欠债时的请求可以把令牌数扣到负数（最多透支 debtLimit 个），
+// 之后的请求被拒绝直到欠债还清
+// 写操作持有互斥锁，GetStatus 通过顺序锁（seqlock）读取状态快照，不和 Allow 争抢锁
 type TokenBucket struct {
 	capacity     int64         // 桶容量（最大令牌数）
 	tokens       int64         // 当前令牌数
 	refillRate   int64         // 令牌补充速率（每秒补充多少个令牌）
 	refillPeriod time.Duration // 补充周期
+	debtLimit    int64         // 最多允许透支的令牌数，为 0 时不允许透支
 	lastRefill   time.Time     // 上次补充时间
+	clock        Clock         // 时钟
 	mutex        sync.Mutex    // 互斥锁
-	stopCh       chan struct{} // 停止信号
-	isRunning    bool          // 是否正在运行
+	stopped      bool          // 是否已经停止补充
+	seq          atomic.Uint64 // 快照的版本号，为奇数时表示正在写入
+	snapshot     tokenSnapshot // 供 GetStatus 无锁读取的状态快照
+}
+
+// tokenSnapshot 令牌桶的状态快照，只在持有锁时写入
+type tokenSnapshot struct {
+	tokens       atomic.Int64 // 当前令牌数
+	capacity     atomic.Int64 // 桶容量
+	refillPeriod atomic.Int64 // 补充周期
+	lastRefill   atomic.Int64 // 上次补充时间（UnixNano）
+	stopped      atomic.Bool  // 是否已经停止补充
 }
 
 // NewTokenBucket 创建新的令牌桶
 // capacity: 桶容量
-// refillRate: 每秒补充的令牌数
-func NewTokenBucket(capacity int64, refillRate int64) *TokenBucket {
-	bucket := &TokenBucket{
+// refillRate: 每秒补充的令牌数，不大于 0 时不自动补充，令牌只能通过 Deposit 存入
+func NewTokenBucket(capacity int64, refillRate int64, opts ...Option) *TokenBucket {
+	o := newOptions(opts)
+	tb := &TokenBucket{
 		capacity:     capacity,
 		tokens:       capacity, // 初始时桶是满的
-		refillRate:   refillRate,
-		refillPeriod: time.Second / time.Duration(refillRate), // 计算每个令牌的补充间隔
-		lastRefill:   time.Now(),
-		stopCh:       make(chan struct{}),
-		isRunning:    false,
+		refillRate:   max(refillRate, 0),
+		refillPeriod: refillPeriod(refillRate), // 计算每个令牌的补充间隔
+		debtLimit:    o.debt,
+		lastRefill:   o.clock.Now(),
+		clock:        o.clock,
 	}
+	tb.publish()
+	return tb
+}
 
-	// 启动令牌补充协程
-	bucket.start()
-	return bucket
+// publish 更新状态快照，调用方需持有锁
+func (tb *TokenBucket) publish() {
+	tb.seq.Add(1)
+	tb.snapshot.tokens.Store(tb.tokens)
+	tb.snapshot.capacity.Store(tb.capacity)
+	tb.snapshot.refillPeriod.Store(int64(tb.refillPeriod))
+	tb.snapshot.lastRefill.Store(tb.lastRefill.UnixNano())
+	tb.snapshot.stopped.Store(tb.stopped)
+	tb.seq.Add(1)
 }
 
-// start 启动令牌补充协程
-func (tb *TokenBucket) start() {
-	tb.mutex.Lock()
-	if tb.isRunning {
-		tb.mutex.Unlock()
-		return
+// refillPeriod 计算每个令牌的补充间隔，最小为 1ns；速率不大于 0 时返回 0，表示不自动补充
+func refillPeriod(refillRate int64) time.Duration {
+	if refillRate <= 0 {
+		return 0
 	}
-	tb.isRunning = true
-	tb.mutex.Unlock()
-
-	go func() {
-		ticker := time.NewTicker(tb.refillPeriod)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-ticker.C:
-				tb.refill()
-			case <-tb.stopCh:
-				return
-			}
-		}
-	}()
+	return max(time.Second/time.Duration(refillRate), time.Nanosecond)
 }
 
-// refill 补充令牌
-func (tb *TokenBucket) refill() {
-	tb.mutex.Lock()
-	defer tb.mutex.Unlock()
-
-	if tb.tokens < tb.capacity {
-		tb.tokens++
-		tb.lastRefill = time.Now()
+// refill 按距离上次补充流逝的时间补充令牌，调用方需持有锁
+func (tb *TokenBucket) refill(now time.Time) {
+	if tb.stopped {
+		return
+	}
+	// 不自动补充或桶满时不积累补充进度，下一个令牌在消耗（或恢复补充）后一个周期才会补充
+	if tb.refillPeriod == 0 || tb.tokens >= tb.capacity {
+		tb.lastRefill = now
+		return
+	}
+	n := int64(now.Sub(tb.lastRefill) / tb.refillPeriod)
+	if n <= 0 {
+		return
 	}
+	if tb.tokens+n >= tb.capacity {
+		tb.tokens = tb.capacity
+		tb.lastRefill = now
+		return
+	}
+	tb.tokens += n
+	tb.lastRefill = tb.lastRefill.Add(time.Duration(n) * tb.refillPeriod)
 }
 
 // Allow 尝试获取一个令牌
@@ -81,28 +105,178 @@ func (tb *TokenBucket) Allow() bool {
 func (tb *TokenBucket) AllowN(n int64) bool {
 	tb.mutex.Lock()
 	defer tb.mutex.Unlock()
+	defer tb.publish()
 
+	tb.refill(tb.clock.Now())
 	if tb.tokens >= n {
 		tb.tokens -= n
 		return true
 	}
+	// 透支模式：没有欠债时可以透支，透支后不能超过上限
+	if tb.debtLimit > 0 && tb.tokens >= 0 && tb.tokens-n >= -tb.debtLimit {
+		tb.tokens -= n
+		return true
+	}
 	return false
 }
 
-// GetStatus 获取当前桶的状态
-func (tb *TokenBucket) GetStatus() (current int64, capacity int64) {
+// take 尝试获取 n 个令牌，令牌不足时返回预计还要等待的时间
+func (tb *TokenBucket) take(n int64) (time.Duration, bool) {
 	tb.mutex.Lock()
 	defer tb.mutex.Unlock()
-	return tb.tokens, tb.capacity
+	defer tb.publish()
+
+	now := tb.clock.Now()
+	tb.refill(now)
+	if tb.tokens >= n {
+		tb.tokens -= n
+		return 0, true
+	}
+	if tb.stopped || tb.refillPeriod == 0 {
+		// 不再补充令牌，只能等其他调用方归还或存入，按轮询间隔重试
+		return waitPollInterval, false
+	}
+	wait := time.Duration(n-tb.tokens)*tb.refillPeriod - now.Sub(tb.lastRefill)
+	return max(wait, time.Nanosecond), false
 }
 
-// Stop 停止令牌桶
-func (tb *TokenBucket) Stop() {
+// Wait 阻塞直到获取一个令牌或 ctx 结束
+// 按 take 算出的下一个令牌的补充时间等待，而不是轮询 Allow
+func (tb *TokenBucket) Wait(ctx context.Context) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		wait, ok := tb.take(1)
+		if ok {
+			return nil
+		}
+		if err := sleepContext(ctx, tb.clock, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// giveBack 归还获取后没有使用的令牌
+func (tb *TokenBucket) giveBack(n int64) {
 	tb.mutex.Lock()
 	defer tb.mutex.Unlock()
+	defer tb.publish()
+	tb.tokens = min(tb.tokens+n, tb.capacity)
+}
 
-	if tb.isRunning {
-		close(tb.stopCh)
-		tb.isRunning = false
+// Deposit 向桶中存入 n 个令牌，不会超过桶容量，透支模式下先偿还欠下的令牌
+// 用于令牌由外部事件产生的场景，如 RetryBudget 按请求数存入重试令牌
+func (tb *TokenBucket) Deposit(n int64) {
+	if n <= 0 {
+		return
 	}
+	tb.mutex.Lock()
+	defer tb.mutex.Unlock()
+	defer tb.publish()
+	tb.refill(tb.clock.Now())
+	tb.tokens = min(tb.tokens+n, tb.capacity)
+}
+
+// Permits 返回按令牌补充速率发放许可的 channel，适合 for range 的流水线写法
+// 桶中有令牌时立即发放（保留突发能力），与并发的 Allow 调用共享同一个桶
+// 发放 n 个许可（n <= 0 时不限数量）或 ctx 结束后关闭 channel；ctx 结束时已经获取但没有发出的令牌会归还
+func (tb *TokenBucket) Permits(ctx context.Context, n int64) <-chan time.Time {
+	ch := make(chan time.Time)
+	go func() {
+		defer close(ch)
+		for i := int64(0); n <= 0 || i < n; i++ {
+			for {
+				wait, ok := tb.take(1)
+				if ok {
+					break
+				}
+				if sleepContext(ctx, tb.clock, wait) != nil {
+					return
+				}
+			}
+			select {
+			case ch <- tb.clock.Now():
+			case <-ctx.Done():
+				tb.giveBack(1)
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// SetDebtLimit 调整最多允许透支的令牌数，为 0 时关闭透支模式，已经欠下的令牌仍然需要补回
+func (tb *TokenBucket) SetDebtLimit(limit int64) {
+	tb.mutex.Lock()
+	defer tb.mutex.Unlock()
+	tb.debtLimit = max(limit, 0)
+}
+
+// TimeToRepay 欠下的令牌全部补回（令牌数回到 0）还需要的时间，没有欠债时返回 0，停止或不自动补充时无法补回，返回 -1
+func (tb *TokenBucket) TimeToRepay() time.Duration {
+	tb.mutex.Lock()
+	defer tb.mutex.Unlock()
+	defer tb.publish()
+
+	now := tb.clock.Now()
+	tb.refill(now)
+	if tb.tokens >= 0 {
+		return 0
+	}
+	if tb.stopped || tb.refillPeriod == 0 {
+		return -1
+	}
+	return max(time.Duration(-tb.tokens)*tb.refillPeriod-now.Sub(tb.lastRefill), 0)
+}
+
+// SetRate 调整桶容量和补充速率，保留当前令牌数（超出新容量的部分会被丢弃）
+// refillRate 不大于 0 时停止自动补充，和 NewTokenBucket 相同
+func (tb *TokenBucket) SetRate(capacity int64, refillRate int64) {
+	tb.mutex.Lock()
+	defer tb.mutex.Unlock()
+	defer tb.publish()
+
+	// 先按原速率结算已经流逝的时间
+	tb.refill(tb.clock.Now())
+	tb.capacity = capacity
+	if tb.tokens > capacity {
+		tb.tokens = capacity
+	}
+	tb.refillRate = max(refillRate, 0)
+	tb.refillPeriod = refillPeriod(refillRate)
+}
+
+// GetStatus 获取当前桶的状态，透支模式下 current 可能为负数（欠下的令牌数）
+// 不加锁，根据最近一次写入的快照和流逝的时间计算
+func (tb *TokenBucket) GetStatus() (current int64, capacity int64) {
+	for {
+		seq := tb.seq.Load()
+		if seq&1 == 1 {
+			// 写入很快就会完成，让出处理器后重试
+			runtime.Gosched()
+			continue
+		}
+		current = tb.snapshot.tokens.Load()
+		capacity = tb.snapshot.capacity.Load()
+		period := tb.snapshot.refillPeriod.Load()
+		lastRefill := tb.snapshot.lastRefill.Load()
+		stopped := tb.snapshot.stopped.Load()
+		if tb.seq.Load() != seq {
+			continue
+		}
+		if !stopped && period > 0 && current < capacity {
+			elapsed := tb.clock.Now().UnixNano() - lastRefill
+			current = min(current+max(elapsed/period, 0), capacity)
+		}
+		return current, capacity
+	}
+}
+
+// Stop 停止令牌桶，停止后不再补充令牌，剩余的令牌仍然可以使用
+func (tb *TokenBucket) Stop() {
+	tb.mutex.Lock()
+	defer tb.mutex.Unlock()
+	defer tb.publish()
+	tb.stopped = true
 }
@@ -1,6 +1,8 @@
 package limit
 
 import (
+	"context"
+	"errors"
 	"sync"
 	"testing"
 	"time"
@@ -98,6 +100,38 @@ func TestTokenBucket_ZeroTokens(t *testing.T) {
 	}
 }
 
+// TestTokenBucket_ZeroRate 测试补充速率为 0 时不自动补充
+func TestTokenBucket_ZeroRate(t *testing.T) {
+	clock := newManualClock()
+	bucket := NewTokenBucket(2, 0, WithClock(clock))
+	defer bucket.Stop()
+
+	bucket.AllowN(2)
+	clock.Sleep(time.Hour)
+	if bucket.Allow() {
+		t.Error("速率为 0 时不应该补充令牌")
+	}
+	if current, _ := bucket.GetStatus(); current != 0 {
+		t.Errorf("速率为 0 时状态不应该增加令牌: %d", current)
+	}
+
+	// 令牌只能通过 Deposit 存入
+	bucket.Deposit(1)
+	if !bucket.Allow() {
+		t.Error("存入令牌后请求应该通过")
+	}
+
+	// 恢复补充后不会补上速率为 0 期间的令牌
+	bucket.SetRate(2, 1)
+	if bucket.Allow() {
+		t.Error("恢复补充时不应该补上停止补充期间的令牌")
+	}
+	clock.Sleep(time.Second)
+	if !bucket.Allow() {
+		t.Error("恢复补充1秒后应该有1个令牌")
+	}
+}
+
 // TestTokenBucket_HighRefillRate 测试高补充速率
 func TestTokenBucket_HighRefillRate(t *testing.T) {
 	bucket := NewTokenBucket(10, 1000) // 容量10，每秒补充1000个
@@ -215,6 +249,29 @@ func TestTokenBucket_RefillLimit(t *testing.T) {
 	}
 }
 
+// TestTokenBucket_SetRate 测试调整速率不重置令牌
+func TestTokenBucket_SetRate(t *testing.T) {
+	bucket := NewTokenBucket(5, 1) // 每秒补充1个
+	defer bucket.Stop()
+	bucket.AllowN(5)
+
+	// 提高到每秒补充100个（每10ms一个）
+	bucket.SetRate(5, 100)
+	if current, capacity := bucket.GetStatus(); current != 0 || capacity != 5 {
+		t.Errorf("调整后状态错误: current=%d, capacity=%d", current, capacity)
+	}
+	time.Sleep(55 * time.Millisecond)
+	if current, _ := bucket.GetStatus(); current < 3 {
+		t.Errorf("提高速率后应该快速补充令牌: %d", current)
+	}
+
+	// 缩小容量时多余的令牌被丢弃
+	bucket.SetRate(2, 100)
+	if current, capacity := bucket.GetStatus(); current > 2 || capacity != 2 {
+		t.Errorf("缩小容量后状态错误: current=%d, capacity=%d", current, capacity)
+	}
+}
+
 // BenchmarkTokenBucket_Allow 性能测试
 func BenchmarkTokenBucket_Allow(b *testing.B) {
 	bucket := NewTokenBucket(int64(b.N), 1000000) // 高补充速率避免限制
@@ -253,3 +310,154 @@ func BenchmarkTokenBucket_GetStatus(b *testing.B) {
 		}
 	})
 }
+
+// TestTokenBucket_Permits 测试按速率发放许可
+func TestTokenBucket_Permits(t *testing.T) {
+	bucket := NewTokenBucket(3, 50) // 突发3个，之后每20ms一个
+	defer bucket.Stop()
+
+	start := time.Now()
+	var times []time.Duration
+	for range bucket.Permits(context.Background(), 6) {
+		times = append(times, time.Since(start))
+	}
+	if len(times) != 6 {
+		t.Fatalf("应该发放6个许可: %d", len(times))
+	}
+	if times[2] > 10*time.Millisecond {
+		t.Errorf("前3个许可应该立即发放: %v", times[2])
+	}
+	if times[5] < 50*time.Millisecond {
+		t.Errorf("之后的许可应该按速率发放: %v", times[5])
+	}
+}
+
+// TestTokenBucket_PermitsShared 测试许可和 Allow 共享同一个桶
+func TestTokenBucket_PermitsShared(t *testing.T) {
+	bucket := NewTokenBucket(5, 10) // 突发5个，之后每100ms一个
+	defer bucket.Stop()
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+
+	var mutex sync.Mutex
+	total := 0
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for ctx.Err() == nil {
+			if bucket.Allow() {
+				mutex.Lock()
+				total++
+				mutex.Unlock()
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	for range bucket.Permits(ctx, 0) {
+		mutex.Lock()
+		total++
+		mutex.Unlock()
+	}
+	wg.Wait()
+
+	// 250ms 内最多 5 + 2 个
+	if total > 7 {
+		t.Errorf("许可和 Allow 加起来不应该超过限制: %d", total)
+	}
+}
+
+// TestTokenBucket_PermitsCancel 测试 ctx 取消后关闭 channel 并归还未发出的令牌
+func TestTokenBucket_PermitsCancel(t *testing.T) {
+	bucket := NewTokenBucket(2, 1)
+	defer bucket.Stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	permits := bucket.Permits(ctx, 0)
+	<-permits
+
+	// 没有人读取时，第2个令牌已经被取出等待发送
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	for range permits {
+	}
+	if current, _ := bucket.GetStatus(); current != 1 {
+		t.Errorf("没有发出的令牌应该归还: %d", current)
+	}
+}
+
+// TestTokenBucket_Debt 测试透支模式
+func TestTokenBucket_Debt(t *testing.T) {
+	if NewTokenBucket(5, 100).AllowN(20) {
+		t.Error("默认不允许超过桶容量")
+	}
+
+	bucket := NewTokenBucket(5, 100, WithDebt(20)) // 每10ms补充1个，最多透支20个
+	if bucket.AllowN(26) {
+		t.Error("不能超过透支上限")
+	}
+	if !bucket.AllowN(20) {
+		t.Fatal("透支模式下可以超过桶容量")
+	}
+	if current, capacity := bucket.GetStatus(); current != -15 || capacity != 5 {
+		t.Errorf("应该报告负数余额: current=%d, capacity=%d", current, capacity)
+	}
+	if bucket.Allow() {
+		t.Error("欠债还清之前应该拒绝")
+	}
+	if d := bucket.TimeToRepay(); d <= 100*time.Millisecond || d > 150*time.Millisecond {
+		t.Errorf("还清时间错误: %v", d)
+	}
+
+	time.Sleep(160 * time.Millisecond)
+	if d := bucket.TimeToRepay(); d != 0 {
+		t.Errorf("欠债应该已经还清: %v", d)
+	}
+	if !bucket.Allow() {
+		t.Error("还清后应该放行")
+	}
+}
+
+// TestTokenBucket_DebtConfig 测试通过配置开启透支模式
+func TestTokenBucket_DebtConfig(t *testing.T) {
+	c := Config{Algorithm: "token_bucket", Limit: 5, Rate: 1, Debt: 10}
+	limiter, err := NewFromConfig(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ConfigOf(limiter); got != c {
+		t.Errorf("配置错误: %+v", got)
+	}
+	if err := Reconfigure(limiter, Config{Algorithm: "token_bucket", Limit: 5, Rate: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if limiter.(*TokenBucket).AllowN(10) {
+		t.Error("关闭透支后不能超过桶容量")
+	}
+	if err := (Config{Algorithm: "token_bucket", Limit: 5, Rate: 1, Debt: -1}).Validate(); err == nil {
+		t.Error("透支上限不能为负数")
+	}
+}
+
+// TestTokenBucket_Wait 测试 Wait 按下一个令牌的补充时间等待，而不是轮询
+func TestTokenBucket_Wait(t *testing.T) {
+	clock := newManualClock()
+	bucket := NewTokenBucket(1, 10, WithClock(clock)) // 每100ms补充一个
+	bucket.Allow()
+
+	start := clock.Now()
+	if err := bucket.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait 应该成功: %v", err)
+	}
+	if elapsed := clock.Now().Sub(start); elapsed != 100*time.Millisecond {
+		t.Errorf("应该只等待到下一个令牌补充: %v", elapsed)
+	}
+	if current, _ := bucket.GetStatus(); current != 0 {
+		t.Errorf("Wait 应该消耗补充的令牌: %d", current)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := bucket.Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("ctx 结束后应该返回错误: %v", err)
+	}
+}
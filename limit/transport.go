@@ -0,0 +1,178 @@
+package limit
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTransportPause = time.Second // 429 没有 Retry-After 时的暂停时长
+	maxTransportPause     = time.Minute // Retry-After 的最长暂停时长
+)
+
+// TransportOption Transport 的可选配置
+type TransportOption func(*Transport)
+
+// WithTransportKey 设置出站请求的限流 key，默认按 HostKey 限流
+// 例如按接口限流：CompositeKey(HostKey, RouteKey("/v1/sms/{template}"))
+func WithTransportKey(keyFunc KeyFunc) TransportOption {
+	return func(t *Transport) {
+		t.keyFunc = keyFunc
+	}
+}
+
+// WithPause 设置服务端要求降速时的暂停时长
+// defaultPause: 429 没有 Retry-After 时暂停多久，默认 1s
+// maxPause: Retry-After 的上限，防止服务端返回过大的值，默认 1m
+func WithPause(defaultPause, maxPause time.Duration) TransportOption {
+	return func(t *Transport) {
+		t.defaultPause = defaultPause
+		t.maxPause = maxPause
+	}
+}
+
+// WithTransportClock 设置 Transport 计算暂停时间使用的时钟，默认使用系统时间
+func WithTransportClock(clock Clock) TransportOption {
+	return func(t *Transport) {
+		t.clock = clock
+	}
+}
+
+// Transport 出站请求限流，包装 http.RoundTripper
+// 1. 发送请求前按 key（默认为目标 host）等待对应的限流器放行
+// 2. 服务端返回 429，或返回带 Retry-After 的 503 时，暂停该 key 的所有请求直到约定的时间
+// Transport 不负责停止限流器，使用完毕后由调用方调用 KeyedRegistry.Stop
+type Transport struct {
+	base         http.RoundTripper    // 底层 RoundTripper
+	limiters     *KeyedRegistry       // key 到限流器的映射
+	keyFunc      KeyFunc              // 提取限流 key
+	defaultPause time.Duration        // 429 没有 Retry-After 时的暂停时长
+	maxPause     time.Duration        // Retry-After 的上限
+	pauses       map[string]time.Time // key 到暂停截止时间的映射
+	clock        Clock                // 时钟
+	mutex        sync.Mutex           // 互斥锁
+}
+
+// NewTransport 创建出站限流 Transport
+// base 为 nil 时使用 http.DefaultTransport；不同 host 需要不同的配额时，在 limiters 的工厂函数中按 key 区分
+func NewTransport(base http.RoundTripper, limiters *KeyedRegistry, opts ...TransportOption) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	t := &Transport{
+		base:         base,
+		limiters:     limiters,
+		keyFunc:      HostKey,
+		defaultPause: defaultTransportPause,
+		maxPause:     maxTransportPause,
+		pauses:       make(map[string]time.Time),
+		clock:        realClock{},
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// HostKey 以请求的目标 host（包含端口）作为 key
+func HostKey(r *http.Request) (string, bool) {
+	host := r.URL.Host
+	if host == "" {
+		host = r.Host
+	}
+	return host, host != ""
+}
+
+// RoundTrip 实现 http.RoundTripper，等待限流器放行后再发送请求
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key, ok := t.keyFunc(req)
+	if !ok {
+		return t.base.RoundTrip(req)
+	}
+	if err := t.wait(req.Context(), key); err != nil {
+		// RoundTripper 即使返回错误也要关闭请求体
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if d, ok := t.backoff(resp); ok {
+		t.Pause(key, d)
+	}
+	return resp, nil
+}
+
+// wait 等待暂停结束，再等待限流器放行
+func (t *Transport) wait(ctx context.Context, key string) error {
+	if until, ok := t.Paused(key); ok {
+		if err := sleepContext(ctx, t.clock, until.Sub(t.clock.Now())); err != nil {
+			return err
+		}
+	}
+	return Wait(ctx, t.limiters.Get(key))
+}
+
+// backoff 根据响应计算需要暂停多久
+func (t *Transport) backoff(resp *http.Response) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0, false
+	}
+	d, ok := parseRetryAfter(resp.Header.Get("Retry-After"), t.clock.Now())
+	if !ok {
+		// 503 可能只是服务端故障，只有明确要求时才暂停
+		if resp.StatusCode != http.StatusTooManyRequests {
+			return 0, false
+		}
+		d = t.defaultPause
+	}
+	return min(d, t.maxPause), d > 0
+}
+
+// parseRetryAfter 解析 Retry-After，支持秒数和 HTTP 日期两种格式
+// 秒数超过 time.Duration 能表示的范围时按最大值处理
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Duration(min(max(seconds, 0), math.MaxInt64/int64(time.Second))) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// Pause 暂停 key 的所有请求，已经暂停时只会延长不会缩短
+func (t *Transport) Pause(key string, d time.Duration) {
+	until := t.clock.Now().Add(d)
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if until.After(t.pauses[key]) {
+		t.pauses[key] = until
+	}
+}
+
+// Paused 查询 key 是否处于暂停中，返回暂停截止时间
+func (t *Transport) Paused(key string) (time.Time, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	until, ok := t.pauses[key]
+	if !ok {
+		return time.Time{}, false
+	}
+	if !t.clock.Now().Before(until) {
+		delete(t.pauses, key)
+		return time.Time{}, false
+	}
+	return until, true
+}
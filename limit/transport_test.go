@@ -0,0 +1,212 @@
+package limit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestTransport_Limit 测试按 host 限流，超出配额的请求等待而不是失败
+func TestTransport_Limit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	limiters := NewKeyedRegistry(func(string) RateLimiter { return NewFixedWindowCounter(2, 200*time.Millisecond) })
+	client := &http.Client{Transport: NewTransport(nil, limiters)}
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("第%d个请求失败: %v", i+1, err)
+		}
+		resp.Body.Close()
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("第3个请求应该等待下一个窗口: %v", elapsed)
+	}
+	if keys := limiters.Keys(); len(keys) != 1 || keys[0] != server.Listener.Addr().String() {
+		t.Errorf("应该按 host 限流: %v", keys)
+	}
+}
+
+// TestTransport_RouteKey 测试按接口限流
+func TestTransport_RouteKey(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	limiters := NewKeyedRegistry(func(string) RateLimiter { return NewFixedWindowCounter(10, time.Minute) })
+	transport := NewTransport(nil, limiters, WithTransportKey(CompositeKey(HostKey, RouteKey("/v1/sms/{template}"))))
+	client := &http.Client{Transport: transport}
+	for _, path := range []string{"/v1/sms/login", "/v1/sms/notify", "/v1/pay"} {
+		resp, err := client.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	// 没有匹配路由模板的请求不限流
+	if limiters.Len() != 1 {
+		t.Errorf("同一个路由模板应该共享限流器: %v", limiters.Keys())
+	}
+}
+
+// TestTransport_RetryAfter 测试服务端返回 429 后暂停该 host
+func TestTransport_RetryAfter(t *testing.T) {
+	var calls atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer server.Close()
+
+	limiters := NewKeyedRegistry(func(string) RateLimiter { return NewFixedWindowCounter(100, time.Second) })
+	// Retry-After 为 1s，上限为 200ms
+	transport := NewTransport(nil, limiters, WithPause(50*time.Millisecond, 200*time.Millisecond))
+	client := &http.Client{Transport: transport}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("429 响应应该原样返回: %d", resp.StatusCode)
+	}
+	if _, ok := transport.Paused(server.Listener.Addr().String()); !ok {
+		t.Error("收到 429 后应该暂停该 host")
+	}
+
+	start := time.Now()
+	resp, err = client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond || elapsed > time.Second {
+		t.Errorf("应该暂停约 200ms: %v", elapsed)
+	}
+}
+
+// TestTransport_Clock 测试暂停时间按 WithTransportClock 的时钟计算
+func TestTransport_Clock(t *testing.T) {
+	clock := newManualClock()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", clock.Now().Add(30*time.Second).UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	limiters := NewKeyedRegistry(func(string) RateLimiter { return NewFixedWindowCounter(100, time.Second) })
+	transport := NewTransport(nil, limiters, WithTransportClock(clock))
+	resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	key := server.Listener.Addr().String()
+	until, ok := transport.Paused(key)
+	if !ok || until.Sub(clock.Now()) != 30*time.Second {
+		t.Fatalf("HTTP 日期格式的 Retry-After 应该按时钟计算: %v %v", until, ok)
+	}
+	clock.Sleep(30 * time.Second)
+	if _, ok := transport.Paused(key); ok {
+		t.Error("时钟走过暂停时长后应该恢复")
+	}
+}
+
+// TestTransport_PauseCanceled 测试暂停期间 ctx 结束
+func TestTransport_PauseCanceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	limiters := NewKeyedRegistry(func(string) RateLimiter { return NewFixedWindowCounter(100, time.Second) })
+	transport := NewTransport(nil, limiters)
+	transport.Pause(server.Listener.Addr().String(), time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	_, err := (&http.Client{Transport: transport}).Do(req)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("应该返回 ctx 超时错误: %v", err)
+	}
+}
+
+// closeRecorder 记录是否被关闭的请求体
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+// Close 记录关闭
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+// TestTransport_CloseBodyOnError 测试等待失败时关闭请求体
+func TestTransport_CloseBodyOnError(t *testing.T) {
+	limiters := NewKeyedRegistry(func(string) RateLimiter { return NewFixedWindowCounter(100, time.Second) })
+	transport := NewTransport(nil, limiters)
+	transport.Pause("example.com", time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	body := &closeRecorder{Reader: strings.NewReader("payload")}
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, "http://example.com/upload", body)
+	if _, err := transport.RoundTrip(req); !errors.Is(err, context.Canceled) {
+		t.Errorf("应该返回 ctx 取消错误: %v", err)
+	}
+	if !body.closed {
+		t.Error("返回错误时应该关闭请求体")
+	}
+}
+
+// TestParseRetryAfter 测试解析 Retry-After
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"120", 2 * time.Minute, true},
+		{"0", 0, true},
+		{"Mon, 01 Jan 2024 00:00:30 GMT", 30 * time.Second, true},
+		{"Sun, 31 Dec 2023 23:00:00 GMT", 0, true},
+		{"", 0, false},
+		{"soon", 0, false},
+		// 超过 time.Duration 的范围时不能溢出成负数
+		{"99999999999999", time.Duration(math.MaxInt64 / int64(time.Second) * int64(time.Second)), true},
+	}
+	for _, c := range cases {
+		got, ok := parseRetryAfter(c.value, now)
+		if got != c.want || ok != c.ok {
+			t.Errorf("%q: 结果错误 %v %v", c.value, got, ok)
+		}
+	}
+}
+
+// TestTransport_ServiceUnavailable 测试 503 只在带 Retry-After 时暂停
+func TestTransport_ServiceUnavailable(t *testing.T) {
+	transport := NewTransport(nil, nil)
+	resp := &http.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{}}
+	if _, ok := transport.backoff(resp); ok {
+		t.Error("没有 Retry-After 的 503 不应该暂停")
+	}
+	resp.Header.Set("Retry-After", "5")
+	if d, ok := transport.backoff(resp); !ok || d != 5*time.Second {
+		t.Errorf("带 Retry-After 的 503 应该暂停 5s: %v", d)
+	}
+}
@@ -0,0 +1,35 @@
+package limit
+
+import (
+	"context"
+	"time"
+)
+
+// waitPollInterval 限流器没有实现等待语义时，轮询 Allow 的间隔
+const waitPollInterval = 5 * time.Millisecond
+
+// Wait 阻塞直到限流器放行或 ctx 结束
+// 限流器实现了 Wait(ctx) error 时直接使用，否则按固定间隔轮询 Allow
+func Wait(ctx context.Context, l RateLimiter) error {
+	if w, ok := l.(interface {
+		Wait(ctx context.Context) error
+	}); ok {
+		return w.Wait(ctx)
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if l.Allow() {
+			return nil
+		}
+		timer := time.NewTimer(waitPollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package limit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestWait_Refill 测试 Wait 阻塞到令牌补充
+func TestWait_Refill(t *testing.T) {
+	bucket := NewTokenBucket(1, 20) // 每50ms补充一个
+	defer bucket.Stop()
+	bucket.Allow()
+
+	start := time.Now()
+	if err := Wait(context.Background(), bucket); err != nil {
+		t.Fatalf("Wait 应该成功: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("Wait 应该等待令牌补充，实际耗时: %v", elapsed)
+	}
+}
+
+// TestWait_ContextDone 测试 ctx 结束时 Wait 返回错误
+func TestWait_ContextDone(t *testing.T) {
+	limiter := NewFixedWindowCounter(0, time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := Wait(ctx, limiter); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ctx 超时后应该返回 DeadlineExceeded，实际: %v", err)
+	}
+}
@@ -0,0 +1,164 @@
+package limit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// defaultColdFactor 冷启动速率系数，冷态时每个请求的间隔是稳定间隔的 3 倍（与 Guava 一致）
+const defaultColdFactor = 3.0
+
+// WarmUpTokenBucket 带预热的令牌桶（参考 Guava SmoothWarmingUp）
+// 1. 冷启动时允许的速率较低（coldFactor 倍的稳定间隔），随着请求持续到来逐步提升到稳定速率
+// 2. 整个从冷到热的过程持续 warmupPeriod
+// 3. 长时间空闲后桶中积攒的许可增多，速率重新回落到冷态
+type WarmUpTokenBucket struct {
+	rate             int64         // 稳定速率（每秒允许的请求数）
+	warmupPeriod     time.Duration // 预热时长
+	stableInterval   float64       // 稳定状态下每个许可的间隔（纳秒）
+	coldInterval     float64       // 冷态下每个许可的间隔（纳秒）
+	thresholdPermits float64       // 进入预热区间的许可阈值
+	maxPermits       float64       // 最大存储许可数
+	slope            float64       // 预热区间内间隔随存储许可增长的斜率
+	storedPermits    float64       // 当前存储的许可数，越多表示越“冷”
+	nextFree         time.Time     // 下一个请求可以通过的时间
+	clock            Clock         // 时钟
+	mutex            sync.Mutex    // 互斥锁
+}
+
+// NewWarmUpTokenBucket 创建带预热的令牌桶
+// rate: 稳定状态下每秒允许的请求数
+// warmupPeriod: 从冷态爬升到稳定速率所需的时间
+func NewWarmUpTokenBucket(rate int64, warmupPeriod time.Duration, opts ...Option) *WarmUpTokenBucket {
+	return NewWarmUpTokenBucketWithColdFactor(rate, warmupPeriod, defaultColdFactor, opts...)
+}
+
+// NewWarmUpTokenBucketWithColdFactor 创建带预热的令牌桶，并指定冷启动系数
+// coldFactor: 冷态速率 = 稳定速率 / coldFactor，必须大于 1
+func NewWarmUpTokenBucketWithColdFactor(rate int64, warmupPeriod time.Duration, coldFactor float64, opts ...Option) *WarmUpTokenBucket {
+	if coldFactor <= 1 {
+		coldFactor = defaultColdFactor
+	}
+	o := newOptions(opts)
+	wb := &WarmUpTokenBucket{
+		rate:         rate,
+		warmupPeriod: warmupPeriod,
+		nextFree:     o.clock.Now(),
+		clock:        o.clock,
+	}
+	if rate <= 0 {
+		return wb
+	}
+
+	wb.stableInterval = float64(time.Second) / float64(rate)
+	wb.coldInterval = wb.stableInterval * coldFactor
+	// 阈值以下按稳定速率发放，阈值到最大值之间是线性变化的预热区间
+	wb.thresholdPermits = 0.5 * float64(warmupPeriod) / wb.stableInterval
+	wb.maxPermits = wb.thresholdPermits + 2.0*float64(warmupPeriod)/(wb.stableInterval+wb.coldInterval)
+	if wb.maxPermits > wb.thresholdPermits {
+		wb.slope = (wb.coldInterval - wb.stableInterval) / (wb.maxPermits - wb.thresholdPermits)
+	}
+	// 初始时是冷态
+	wb.storedPermits = wb.maxPermits
+	return wb
+}
+
+// Allow 尝试获取一个许可
+func (wb *WarmUpTokenBucket) Allow() bool {
+	return wb.AllowN(1)
+}
+
+// AllowN 尝试获取 n 个许可
+// 与 Guava 的 tryAcquire 一致：只要当前时刻已经轮到，请求就可以通过，
+// 其代价（等待时间）由后续请求承担
+func (wb *WarmUpTokenBucket) AllowN(n int64) bool {
+	if n <= 0 {
+		return true
+	}
+	wb.mutex.Lock()
+	defer wb.mutex.Unlock()
+
+	if wb.rate <= 0 {
+		return false
+	}
+	now := wb.clock.Now()
+	wb.resync(now)
+	if wb.nextFree.After(now) {
+		return false
+	}
+
+	// 优先消耗存储的许可，不足部分按稳定速率计算
+	storedToSpend := math.Min(float64(n), wb.storedPermits)
+	freshPermits := float64(n) - storedToSpend
+	wait := wb.storedPermitsToWaitTime(wb.storedPermits, storedToSpend) + freshPermits*wb.stableInterval
+	wb.nextFree = wb.nextFree.Add(time.Duration(wait))
+	wb.storedPermits -= storedToSpend
+	return true
+}
+
+// resync 根据空闲时长补充存储许可（冷却），调用方需持有锁
+func (wb *WarmUpTokenBucket) resync(now time.Time) {
+	if !now.After(wb.nextFree) {
+		return
+	}
+	// 冷却速率：空闲 warmupPeriod 即可从 0 回到 maxPermits
+	coolDownInterval := float64(wb.warmupPeriod) / wb.maxPermits
+	if wb.maxPermits > 0 && coolDownInterval > 0 {
+		newPermits := float64(now.Sub(wb.nextFree)) / coolDownInterval
+		wb.storedPermits = math.Min(wb.maxPermits, wb.storedPermits+newPermits)
+	}
+	wb.nextFree = now
+}
+
+// storedPermitsToWaitTime 计算从 storedPermits 中取出 permitsToTake 个许可需要的时间（纳秒）
+// 即间隔函数在 [storedPermits-permitsToTake, storedPermits] 区间上的积分
+func (wb *WarmUpTokenBucket) storedPermitsToWaitTime(storedPermits, permitsToTake float64) float64 {
+	availableAboveThreshold := storedPermits - wb.thresholdPermits
+	wait := 0.0
+	if availableAboveThreshold > 0 {
+		permitsAboveThresholdToTake := math.Min(availableAboveThreshold, permitsToTake)
+		length := wb.permitsToInterval(availableAboveThreshold) +
+			wb.permitsToInterval(availableAboveThreshold-permitsAboveThresholdToTake)
+		wait = permitsAboveThresholdToTake * length / 2.0
+		permitsToTake -= permitsAboveThresholdToTake
+	}
+	return wait + wb.stableInterval*permitsToTake
+}
+
+// permitsToInterval 计算阈值之上第 permits 个许可对应的间隔（纳秒）
+func (wb *WarmUpTokenBucket) permitsToInterval(permits float64) float64 {
+	return wb.stableInterval + permits*wb.slope
+}
+
+// Rate 获取当前实际生效的速率（每秒允许的请求数）
+func (wb *WarmUpTokenBucket) Rate() float64 {
+	wb.mutex.Lock()
+	defer wb.mutex.Unlock()
+	return wb.currentRate(wb.clock.Now())
+}
+
+// currentRate 计算当前生效速率，调用方需持有锁
+func (wb *WarmUpTokenBucket) currentRate(now time.Time) float64 {
+	if wb.rate <= 0 {
+		return 0
+	}
+	wb.resync(now)
+	interval := wb.stableInterval
+	if above := wb.storedPermits - wb.thresholdPermits; above > 0 {
+		interval = wb.permitsToInterval(above)
+	}
+	return float64(time.Second) / interval
+}
+
+// GetStatus 获取当前状态
+// current: 当前生效的速率（每秒，向下取整）
+// rate: 稳定速率
+func (wb *WarmUpTokenBucket) GetStatus() (current int64, rate int64) {
+	wb.mutex.Lock()
+	defer wb.mutex.Unlock()
+	return int64(wb.currentRate(wb.clock.Now())), wb.rate
+}
+
+// Stop 停止预热令牌桶，预热令牌桶没有后台协程，这里只是为了和其他限流器保持一致
+func (wb *WarmUpTokenBucket) Stop() {}
@@ -0,0 +1,108 @@
+package limit
+
+import (
+	"testing"
+	"time"
+)
+
+// TestWarmUpTokenBucket_ColdStart 测试冷启动时速率较低
+func TestWarmUpTokenBucket_ColdStart(t *testing.T) {
+	bucket := NewWarmUpTokenBucket(100, 300*time.Millisecond) // 稳定速率100/s，预热300ms
+	defer bucket.Stop()
+
+	// 冷态速率应该是稳定速率的 1/3
+	current, rate := bucket.GetStatus()
+	if current != 33 || rate != 100 {
+		t.Errorf("冷启动状态错误: current=%d, rate=%d", current, rate)
+	}
+
+	// 第一个请求立即通过，紧接着的请求需要等待冷态间隔（30ms）
+	if !bucket.Allow() {
+		t.Error("第1个请求应该通过")
+	}
+	if bucket.Allow() {
+		t.Error("冷态下第2个请求不应该立即通过")
+	}
+}
+
+// TestWarmUpTokenBucket_RampUp 测试持续请求后速率爬升到稳定速率
+func TestWarmUpTokenBucket_RampUp(t *testing.T) {
+	bucket := NewWarmUpTokenBucket(100, 200*time.Millisecond)
+	defer bucket.Stop()
+
+	// 持续请求，先通过预热区间
+	deadline := time.Now().Add(400 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		bucket.Allow()
+		time.Sleep(time.Millisecond)
+	}
+
+	current, rate := bucket.GetStatus()
+	if current < 90 || current > rate {
+		t.Errorf("预热完成后速率应该接近稳定速率: current=%d, rate=%d", current, rate)
+	}
+
+	// 稳定状态下 200ms 内通过的请求数应该接近 20 个
+	count := 0
+	deadline = time.Now().Add(200 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		if bucket.Allow() {
+			count++
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if count < 15 || count > 22 {
+		t.Errorf("稳定状态下通过的请求数异常: %d", count)
+	}
+}
+
+// TestWarmUpTokenBucket_CoolDown 测试空闲后速率回落到冷态
+func TestWarmUpTokenBucket_CoolDown(t *testing.T) {
+	bucket := NewWarmUpTokenBucket(100, 100*time.Millisecond)
+	defer bucket.Stop()
+
+	deadline := time.Now().Add(200 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		bucket.Allow()
+		time.Sleep(time.Millisecond)
+	}
+	if current, _ := bucket.GetStatus(); current < 90 {
+		t.Errorf("预热完成后速率应该接近稳定速率: %d", current)
+	}
+
+	// 空闲超过预热时长，应该回到冷态
+	time.Sleep(150 * time.Millisecond)
+	if current, _ := bucket.GetStatus(); current != 33 {
+		t.Errorf("空闲后速率应该回落到冷态: %d", current)
+	}
+}
+
+// TestWarmUpTokenBucket_ZeroRate 测试零速率
+func TestWarmUpTokenBucket_ZeroRate(t *testing.T) {
+	bucket := NewWarmUpTokenBucket(0, time.Second)
+	defer bucket.Stop()
+
+	if bucket.Allow() {
+		t.Error("零速率时请求应该被拒绝")
+	}
+	if !bucket.AllowN(0) {
+		t.Error("获取0个许可应该总是成功")
+	}
+	current, rate := bucket.GetStatus()
+	if current != 0 || rate != 0 {
+		t.Errorf("零速率状态错误: current=%d, rate=%d", current, rate)
+	}
+}
+
+// BenchmarkWarmUpTokenBucket_Allow 性能测试
+func BenchmarkWarmUpTokenBucket_Allow(b *testing.B) {
+	bucket := NewWarmUpTokenBucket(1000000, time.Millisecond)
+	defer bucket.Stop()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			bucket.Allow()
+		}
+	})
+}
@@ -0,0 +1,44 @@
+package limittest
+
+import (
+	"sync"
+	"time"
+)
+
+// FakeClock 假时钟，实现 limit.Clock
+// 时间只会在调用 Advance 或 Sleep 时前进，Sleep 不会真正阻塞，而是直接把时间拨到醒来的时刻
+type FakeClock struct {
+	now   time.Time  // 当前时间
+	mutex sync.Mutex // 互斥锁
+}
+
+// NewFakeClock 创建假时钟，start 为零值时从一个固定的时间开始
+func NewFakeClock(start time.Time) *FakeClock {
+	if start.IsZero() {
+		// 故意不对齐到整秒，避免实现只在对齐的窗口上恰好正确
+		start = time.Date(2024, 1, 1, 0, 0, 0, 123456789, time.UTC)
+	}
+	return &FakeClock{now: start}
+}
+
+// Now 返回当前时间
+func (c *FakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+// Sleep 把时间拨快 d
+func (c *FakeClock) Sleep(d time.Duration) {
+	c.Advance(d)
+}
+
+// Advance 把时间拨快 d，d 不大于 0 时不变
+func (c *FakeClock) Advance(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+}
@@ -0,0 +1,261 @@
+// Package limittest 为 limit.RateLimiter 的实现提供一致性测试
+//
+// 限流器通过 Spec 声明自己的限制：空闲时最多能立即通过 Burst 个请求，
+// 长期每秒最多通过 Rate 个请求，即任意长度为 T 的时间段内通过的请求数不超过 MaxBurst + Rate*T。
+// 测试使用 FakeClock 驱动时间，不需要真实等待：
+//
+//	func TestMyLimiter(t *testing.T) {
+//		limittest.Run(t, func(clock limit.Clock) limit.RateLimiter {
+//			return NewMyLimiter(10, time.Second, clock)
+//		}, limittest.Spec{Burst: 10, Rate: 10})
+//	}
+package limittest
+
+import (
+	"math"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/CocaineCong/BiliBili-Code/limit"
+)
+
+// Factory 使用给定的时钟创建限流器，每个测试都会创建新的限流器
+type Factory func(clock limit.Clock) limit.RateLimiter
+
+// Spec 限流器声明的限制
+type Spec struct {
+	Burst    int64         // 空闲时能立即通过的请求数
+	MaxBurst int64         // 短时间内最多能通过的请求数，为 0 时等于 Burst；固定窗口在窗口边界上是 2*Burst
+	Rate     float64       // 长期每秒最多通过的请求数
+	Refill   time.Duration // 耗尽后恢复 Burst 个配额所需的最长时间，为 0 时按 Burst/Rate 计算
+}
+
+// maxBurst 短时间内最多能通过的请求数
+func (s Spec) maxBurst() int64 {
+	return max(s.MaxBurst, s.Burst)
+}
+
+// refill 耗尽后恢复所需的时间
+func (s Spec) refill() time.Duration {
+	if s.Refill > 0 {
+		return s.Refill
+	}
+	return time.Duration(float64(s.Burst) / s.Rate * float64(time.Second))
+}
+
+// interval 平均每个请求的间隔
+func (s Spec) interval() time.Duration {
+	return max(time.Duration(float64(time.Second)/s.Rate), time.Nanosecond)
+}
+
+// Run 对限流器运行所有一致性测试
+//   - Burst: 空闲时恰好能立即通过 Burst 个请求，耗尽后经过 Refill 完全恢复
+//   - NeverExceeds: 随机到达的请求在任意时间段内都不超过 MaxBurst + Rate*T
+//   - SustainedRate: 持续满负荷时吞吐不低于 Rate 的 80%，也不超过限制
+//   - Concurrent: 并发调用 Allow/GetStatus 时总通过数不超过限制（配合 -race 运行）
+//   - Stop: 实现了 Stop() 的限流器可以重复、并发地停止
+//
+// 另外每次调用 GetStatus 都要求 limit 不为负数、current 不超过 limit
+func Run(t *testing.T, factory Factory, spec Spec) {
+	t.Helper()
+	if spec.Burst <= 0 || spec.Rate <= 0 {
+		t.Fatalf("Spec 的 Burst 和 Rate 必须大于 0: %+v", spec)
+	}
+	t.Run("Burst", func(t *testing.T) { testBurst(t, factory, spec) })
+	t.Run("NeverExceeds", func(t *testing.T) { testNeverExceeds(t, factory, spec) })
+	t.Run("SustainedRate", func(t *testing.T) { testSustainedRate(t, factory, spec) })
+	t.Run("Concurrent", func(t *testing.T) { testConcurrent(t, factory, spec) })
+	t.Run("Stop", func(t *testing.T) { testStop(t, factory) })
+}
+
+// newLimiter 创建假时钟和限流器，测试结束时停止限流器
+func newLimiter(t *testing.T, factory Factory) (*FakeClock, limit.RateLimiter) {
+	clock := NewFakeClock(time.Time{})
+	l := factory(clock)
+	if s, ok := l.(interface{ Stop() }); ok {
+		t.Cleanup(s.Stop)
+	}
+	return clock, l
+}
+
+// burstAt 统计在当前时刻能立即通过多少个请求
+// 会排队等待的限流器（如漏桶）通过 Sleep 拨动时钟，之后通过的请求不计入
+func burstAt(t *testing.T, clock *FakeClock, l limit.RateLimiter, spec Spec) int64 {
+	now := clock.Now()
+	var count int64
+	for i := int64(0); i < 2*spec.Burst+10 && clock.Now().Equal(now); i++ {
+		if l.Allow() && clock.Now().Equal(now) {
+			count++
+		}
+		checkStatus(t, l)
+	}
+	return count
+}
+
+// testBurst 测试突发容量和完全恢复
+func testBurst(t *testing.T, factory Factory, spec Spec) {
+	clock, l := newLimiter(t, factory)
+	if got := burstAt(t, clock, l, spec); got != spec.Burst {
+		t.Fatalf("空闲时应该恰好通过 %d 个请求，实际通过 %d 个", spec.Burst, got)
+	}
+	clock.Advance(spec.refill())
+	if got := burstAt(t, clock, l, spec); got != spec.Burst {
+		t.Errorf("经过 %v 后应该恢复 %d 个配额，实际通过 %d 个", spec.refill(), spec.Burst, got)
+	}
+}
+
+// testNeverExceeds 按随机间隔发送请求，检查任意时间段内的通过数
+func testNeverExceeds(t *testing.T, factory Factory, spec Spec) {
+	clock, l := newLimiter(t, factory)
+	rng := rand.New(rand.NewPCG(1, 2))
+	interval := spec.interval()
+
+	var allowed []time.Time
+	for i := 0; i < 2000; i++ {
+		switch rng.IntN(4) {
+		case 0:
+			// 连续多个请求同时到达
+		case 1:
+			clock.Advance(time.Duration(rng.Int64N(int64(interval))))
+		case 2:
+			clock.Advance(time.Duration(rng.Int64N(int64(3 * interval))))
+		default:
+			// 偶尔空闲较长时间
+			if rng.IntN(20) == 0 {
+				clock.Advance(time.Duration(rng.Int64N(int64(2*spec.refill()) + 1)))
+			}
+		}
+		if l.Allow() {
+			allowed = append(allowed, clock.Now())
+		}
+		checkStatus(t, l)
+	}
+	if len(allowed) == 0 {
+		t.Fatal("没有任何请求通过")
+	}
+	checkEnvelope(t, allowed, spec)
+}
+
+// testSustainedRate 持续满负荷发送请求，检查吞吐
+func testSustainedRate(t *testing.T, factory Factory, spec Spec) {
+	clock, l := newLimiter(t, factory)
+	duration := max(100*spec.interval(), 10*spec.refill())
+	step := max(spec.interval()/4, time.Nanosecond)
+	start := clock.Now()
+	end := start.Add(duration)
+	maxAttempts := 10*(spec.Burst+int64(spec.Rate*duration.Seconds())) + int64(duration/step) + 1000
+
+	var allowed []time.Time
+	for attempts := int64(0); clock.Now().Before(end); attempts++ {
+		if attempts > maxAttempts {
+			t.Fatalf("时间没有前进却一直放行，共尝试 %d 次", attempts)
+		}
+		if l.Allow() {
+			allowed = append(allowed, clock.Now())
+			continue
+		}
+		checkStatus(t, l)
+		clock.Advance(step)
+	}
+
+	elapsed := clock.Now().Sub(start)
+	want := 0.8 * spec.Rate * elapsed.Seconds()
+	if float64(len(allowed)) < want {
+		t.Errorf("持续 %v 应该至少通过 %.0f 个请求，实际通过 %d 个", elapsed, want, len(allowed))
+	}
+	checkEnvelope(t, allowed, spec)
+}
+
+// testConcurrent 并发调用，检查总通过数
+func testConcurrent(t *testing.T, factory Factory, spec Spec) {
+	clock, l := newLimiter(t, factory)
+	start := clock.Now()
+	const goroutines = 8
+	const calls = 200
+
+	var total atomic.Int64
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < calls; i++ {
+				if l.Allow() {
+					total.Add(1)
+				}
+				checkStatus(t, l)
+				// 其中一个协程负责推动时间
+				if g == 0 && i%10 == 0 {
+					clock.Advance(spec.interval())
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	elapsed := clock.Now().Sub(start)
+	if limit := bound(spec, elapsed); float64(total.Load()) > limit {
+		t.Errorf("%v 内最多通过 %.0f 个请求，实际通过 %d 个", elapsed, limit, total.Load())
+	}
+	if total.Load() == 0 {
+		t.Error("没有任何请求通过")
+	}
+}
+
+// testStop 测试 Stop 可以重复、并发调用
+func testStop(t *testing.T, factory Factory) {
+	_, l := newLimiter(t, factory)
+	s, ok := l.(interface{ Stop() })
+	if !ok {
+		t.Skip("限流器没有实现 Stop")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Stop()
+		}()
+	}
+	wg.Wait()
+	s.Stop()
+
+	// 停止后调用不应该 panic
+	l.Allow()
+	checkStatus(t, l)
+}
+
+// checkStatus 检查 GetStatus 的返回值
+func checkStatus(t *testing.T, l limit.RateLimiter) {
+	current, max := l.GetStatus()
+	if max < 0 || current > max {
+		t.Errorf("GetStatus 返回值异常: current=%d, limit=%d", current, max)
+	}
+}
+
+// bound 长度为 d 的时间段内最多允许通过的请求数
+func bound(spec Spec, d time.Duration) float64 {
+	return float64(spec.maxBurst()) + spec.Rate*d.Seconds() + 1e-6
+}
+
+// checkEnvelope 检查任意两个通过的请求之间（包含两端）的请求数都不超过限制
+func checkEnvelope(t *testing.T, allowed []time.Time, spec Spec) {
+	t.Helper()
+	worst, worstI, worstJ := math.Inf(-1), 0, 0
+	for j := range allowed {
+		for i := 0; i <= j; i++ {
+			excess := float64(j-i+1) - bound(spec, allowed[j].Sub(allowed[i]))
+			if excess > worst {
+				worst, worstI, worstJ = excess, i, j
+			}
+		}
+	}
+	if worst > 0 {
+		d := allowed[worstJ].Sub(allowed[worstI])
+		t.Errorf("%v 内通过了 %d 个请求，超过限制 %.2f", d, worstJ-worstI+1, bound(spec, d))
+	}
+}
@@ -0,0 +1,82 @@
+package limittest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CocaineCong/BiliBili-Code/limit"
+)
+
+// TestFixedWindowCounter 固定窗口在窗口边界上最多可以通过 2 倍的请求
+func TestFixedWindowCounter(t *testing.T) {
+	Run(t, func(clock limit.Clock) limit.RateLimiter {
+		return limit.NewFixedWindowCounter(5, time.Second, limit.WithClock(clock))
+	}, Spec{Burst: 5, MaxBurst: 10, Rate: 5, Refill: 1100 * time.Millisecond})
+}
+
+// TestSlidingWindowCounter 滑动窗口在任意一个窗口内都不会超过限制，耗尽后要等子窗口整个离开窗口（窗口加一个精度）才完全恢复
+func TestSlidingWindowCounter(t *testing.T) {
+	Run(t, func(clock limit.Clock) limit.RateLimiter {
+		return limit.NewSlidingWindowCounter(10, time.Second, 100*time.Millisecond, limit.WithClock(clock))
+	}, Spec{Burst: 10, Rate: 10, Refill: 1100 * time.Millisecond})
+}
+
+// TestTokenBucket 令牌桶
+func TestTokenBucket(t *testing.T) {
+	Run(t, func(clock limit.Clock) limit.RateLimiter {
+		return limit.NewTokenBucket(10, 100, limit.WithClock(clock))
+	}, Spec{Burst: 10, Rate: 100})
+}
+
+// TestTokenBucketDebt 透支模式的令牌桶在没有欠债时还能多透支一个令牌
+func TestTokenBucketDebt(t *testing.T) {
+	Run(t, func(clock limit.Clock) limit.RateLimiter {
+		return limit.NewTokenBucket(10, 100, limit.WithDebt(5), limit.WithClock(clock))
+	}, Spec{Burst: 11, Rate: 100})
+}
+
+// TestLeakyBucket 漏桶通过排队整形，每个间隔只放行一个请求
+func TestLeakyBucket(t *testing.T) {
+	Run(t, func(clock limit.Clock) limit.RateLimiter {
+		return limit.NewLeakyBucket(5, 10*time.Millisecond, limit.WithClock(clock))
+	}, Spec{Burst: 1, Rate: 100})
+}
+
+// TestLeakyBucketPolicer 监管模式的漏桶不排队，空闲时能立即通过桶容量个请求
+func TestLeakyBucketPolicer(t *testing.T) {
+	Run(t, func(clock limit.Clock) limit.RateLimiter {
+		return limit.NewLeakyBucketPolicer(5, 10*time.Millisecond, limit.WithClock(clock))
+	}, Spec{Burst: 5, Rate: 100})
+}
+
+// TestWarmUpTokenBucket 预热令牌桶冷启动时每个请求的间隔是稳定间隔的 3 倍
+func TestWarmUpTokenBucket(t *testing.T) {
+	Run(t, func(clock limit.Clock) limit.RateLimiter {
+		return limit.NewWarmUpTokenBucket(20, 500*time.Millisecond, limit.WithClock(clock))
+	}, Spec{Burst: 1, Rate: 20, Refill: 150 * time.Millisecond})
+}
+
+// TestSingleRateMarker 单速率三色标记器放行绿色和黄色请求，总突发为两个桶之和
+func TestSingleRateMarker(t *testing.T) {
+	Run(t, func(clock limit.Clock) limit.RateLimiter {
+		return limit.NewSingleRateMarker(100, 10, 5, limit.WithClock(clock))
+	}, Spec{Burst: 15, Rate: 100})
+}
+
+// TestTwoRateMarker 双速率三色标记器放行的请求受峰值桶限制
+func TestTwoRateMarker(t *testing.T) {
+	Run(t, func(clock limit.Clock) limit.RateLimiter {
+		return limit.NewTwoRateMarker(50, 5, 100, 10, limit.WithClock(clock))
+	}, Spec{Burst: 10, Rate: 100})
+}
+
+// TestFakeClock 测试假时钟
+func TestFakeClock(t *testing.T) {
+	clock := NewFakeClock(time.Time{})
+	start := clock.Now()
+	clock.Sleep(time.Second)
+	clock.Advance(-time.Hour)
+	if got := clock.Now().Sub(start); got != time.Second {
+		t.Errorf("时间前进错误: %v", got)
+	}
+}